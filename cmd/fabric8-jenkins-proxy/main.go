@@ -1,18 +1,25 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"os"
 
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/api"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/auth"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/certs"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/configuration"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/health"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/jenkinsapi"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/proxy"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/router"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tenant"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tracing"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/wit"
 
 	"github.com/rs/cors"
@@ -33,28 +40,18 @@ const (
 	// defaultStatsLoggingInterval determines the default Duration for logging the store stats.
 	defaultStatsLoggingInterval = 5 * time.Minute
 	shutdownTimeout             = 5
-	apiRouterPort               = ":9091"
-	jenkinsAPIRouterPort        = ":9092"
-	proxyPort                   = ":8080"
-	profilerPort                = ":6060"
 )
 
 var mainLogger = log.WithFields(log.Fields{"component": "main"})
 
 func init() {
 	log.SetFormatter(&log.JSONFormatter{})
+}
 
-	level := log.InfoLevel
-	switch levelStr, _ := os.LookupEnv("JC_LOG_LEVEL"); levelStr {
-	case "info":
-		level = log.InfoLevel
-	case "debug":
-		level = log.DebugLevel
-	case "warning":
-		level = log.WarnLevel
-	case "error":
-		level = log.ErrorLevel
-	default:
+// setLogLevel sets the configured log level, info unless another one is configured.
+func setLogLevel(config configuration.Configuration) {
+	level, err := log.ParseLevel(config.GetLogLevel())
+	if err != nil {
 		level = log.InfoLevel
 	}
 	log.SetLevel(level)
@@ -69,17 +66,37 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	setLogLevel(config)
+
+	// Redact secrets from logged requests as configured
+	logging.SetRedactor(logging.NewRedactor(config.GetLogRedactedHeaders(), config.GetLogRedactedCookies(), config.GetLogRedactedQueryParams()))
 
 	mainLogger.Infof("Proxy config: %s", config.String())
 
-	// Connect to DB
-	db, err := storage.Connect(config)
+	// Export traces unless disabled, flushing the remaining spans on shutdown
+	shutdownTracing, err := tracing.Setup(config)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			mainLogger.WithField("error", err).Error("Failure to flush traces")
+		}
+	}()
 
-	store := storage.NewDBStorage(db)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(config)
+		return
+	}
+
+	// Open the store, connecting to the DB unless another backend is configured
+	store, closeStore, err := storage.Open(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closeStore()
 
 	// Create auth client and set it as default; can be accessed by
 	// auth.DefaultClient() in other packages
@@ -95,7 +112,7 @@ func main() {
 	idler := idler.New(config.GetIdlerURL())
 
 	// Get the cluster view from the Idler
-	clusters, err := idler.Clusters()
+	clusters, err := idler.Clusters(context.Background())
 	if err != nil {
 		mainLogger.WithField("error", err).Fatalf("Failure to retrieve cluster view")
 	}
@@ -104,6 +121,28 @@ func main() {
 	start(config, idler, &tenant, wit, store, clusters)
 }
 
+// migrate upgrades the DB schema to the latest version and exits, so that it can
+// run ahead of a rollout instead of on the start of the first replica.
+func migrate(config configuration.Configuration) {
+	if config.GetStorageBackend() != configuration.StoragePostgres {
+		mainLogger.Infof("Nothing to migrate for storage backend %s", config.GetStorageBackend())
+		return
+	}
+
+	// connecting migrates the schema
+	db, err := storage.Connect(config)
+	if err != nil {
+		mainLogger.WithField("error", err).Fatal("Failure to migrate DB schema")
+	}
+	defer db.Close()
+
+	version, err := storage.SchemaVersion(db)
+	if err != nil {
+		mainLogger.WithField("error", err).Fatal("Failure to read DB schema version")
+	}
+	mainLogger.Infof("DB schema is at version %d", version)
+}
+
 func start(config configuration.Configuration, idler idler.Service, tenant tenant.Service, wit wit.Service, store storage.Store, clusters map[string]string) {
 	proxy, err := proxy.New(idler, tenant, wit, store, config, clusters)
 	if err != nil {
@@ -115,14 +154,16 @@ func start(config configuration.Configuration, idler idler.Service, tenant tenan
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	startWorkers(ctx, &wg, cancel, store, &proxy, defaultStatsLoggingInterval, config)
+	checker := newHealthChecker(config, store, clusters)
+	startWorkers(ctx, &wg, cancel, store, &proxy, checker, defaultStatsLoggingInterval, config)
 	setupSignalChannel(cancel)
 	wg.Wait()
 }
 
 func listenAndServe(srv *http.Server, cancel context.CancelFunc, enableHTTPS bool) {
 	if enableHTTPS {
-		if err := srv.ListenAndServeTLS("server.crt", "server.key"); err != nil {
+		// the certificate is served by srv.TLSConfig
+		if err := srv.ListenAndServeTLS("", ""); err != nil {
 			log.Error(err)
 			cancel()
 			return
@@ -138,7 +179,7 @@ func listenAndServe(srv *http.Server, cancel context.CancelFunc, enableHTTPS boo
 
 func startWorkers(
 	ctx context.Context, wg *sync.WaitGroup, cancel context.CancelFunc,
-	store storage.Store, proxy *proxy.Proxy, interval time.Duration,
+	store storage.Store, proxy *proxy.Proxy, checker *health.Checker, interval time.Duration,
 	config configuration.Configuration) {
 
 	mainLogger.Info("Starting  all workers")
@@ -152,101 +193,100 @@ func startWorkers(
 		}
 	}()
 
-	api := api.NewAPI(store)
+	janitor := storage.NewJanitor(store, storage.Retention{
+		RequestMaxAge:    config.GetRequestMaxAge(),
+		StatisticsMaxAge: config.GetStatisticsMaxAge(),
+	}, metric.DefaultRecorder())
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		srv := newAPIServer(api)
-
-		go func() {
-			mainLogger.Infof("Starting API router on port %s", apiRouterPort)
-			listenAndServe(srv, cancel, config.GetHTTPSEnabled())
-		}()
-
-		for {
-			select {
-			case <-ctx.Done():
-				mainLogger.Infof("Shutting down API router on port %s", apiRouterPort)
-				ctx, cancel := context.WithTimeout(ctx, shutdownTimeout*time.Second)
-				srv.Shutdown(ctx)
-				cancel()
-				return
-			}
-		}
+		mainLogger.Info("Starting janitor")
+		janitor.Run(ctx, config.GetRetentionInterval())
 	}()
 
-	tenant := tenant.New(config.GetTenantURL(), config.GetAuthToken())
-	idler := idler.New(config.GetIdlerURL())
-	jenkinsAPI := jenkinsapi.NewJenkinsAPI(&tenant, idler)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		srv := newJenkinsAPIServer(jenkinsAPI, config)
+		mainLogger.Info("Starting buffered request replay")
+		proxy.ProcessBuffer(ctx)
+	}()
 
-		go func() {
-			mainLogger.Infof("Starting Jenkins Status API router on port %s", jenkinsAPIRouterPort)
-			listenAndServe(srv, cancel, config.GetHTTPSEnabled())
-		}()
+	tenant := tenant.New(config.GetTenantURL(), config.GetAuthToken())
+	authorizer := newAPIAuthorizer(config, &tenant)
+	api := api.NewAPI(store, proxy, janitor)
+	serve(ctx, wg, cancel, "API router", newAPIServer(api, authorizer, checker), config.GetAPIListener())
 
-		for {
-			select {
-			case <-ctx.Done():
-				mainLogger.Infof("Shutting down Jenkins Status API router on port %s", jenkinsAPIRouterPort)
-				ctx, cancel := context.WithTimeout(ctx, shutdownTimeout*time.Second)
-				srv.Shutdown(ctx)
-				cancel()
-				return
-			}
-		}
-	}()
+	idler := idler.New(config.GetIdlerURL())
+	jenkinsAPI := jenkinsapi.NewJenkinsAPI(&tenant, idler)
+	origins := newCORSPolicy(config)
+	serve(ctx, wg, cancel, "Jenkins Status API router", newJenkinsAPIServer(jenkinsAPI, origins), config.GetJenkinsAPIListener())
+
+	serve(ctx, wg, cancel, "proxy", newProxyServer(proxy), config.GetProxyListener())
 
+	// Apply the settings changed in the config file which may change while the proxy runs
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		srv := newProxyServer(proxy)
-		go func() {
-			mainLogger.Infof("Starting proxy on port %s", proxyPort)
-			listenAndServe(srv, cancel, config.GetHTTPSEnabled())
-		}()
-
-		for {
-			select {
-			case <-ctx.Done():
-				mainLogger.Infof("Shutting down proxy on port %s", proxyPort)
-				ctx, cancel := context.WithTimeout(ctx, shutdownTimeout*time.Second)
-				srv.Shutdown(ctx)
-				cancel()
-				return
-			}
+		err := configuration.WatchConfigFile(ctx, func(changed []string) {
+			setLogLevel(config)
+			proxy.Reconfigure(config)
+			origins.Reconfigure(config)
+		})
+		if err != nil {
+			mainLogger.WithField("error", err).Error("Failure to watch config file, its changes take effect on restart")
 		}
 	}()
 
 	// add profile if debug mode is enabled
 	if config.GetDebugMode() {
+		serve(ctx, wg, cancel, "profiler", &http.Server{}, config.GetProfilerListener())
+	}
+}
+
+// serve starts serving the server as configured by its listener unless the listener is disabled,
+// reloading its certificate whenever it changes, and shuts the server down once the context is cancelled.
+func serve(
+	ctx context.Context, wg *sync.WaitGroup, cancel context.CancelFunc,
+	name string, srv *http.Server, listener configuration.Listener) {
+
+	if !listener.Enabled() {
+		mainLogger.Infof("Not starting %s, its listener is disabled", name)
+		return
+	}
+	srv.Addr = listener.Address
+
+	if listener.TLS() {
+		reloader, err := certs.NewReloader(listener.CertFile, listener.KeyFile, listener.ClientCAFile)
+		if err != nil {
+			mainLogger.WithField("error", err).Errorf("Failure to start %s", name)
+			cancel()
+			return
+		}
+		srv.TLSConfig = reloader.TLSConfig()
+
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			srv := &http.Server{
-				Addr: profilerPort,
-			}
-
-			go func() {
-				mainLogger.Infof("Starting profiler on port %s", profilerPort)
-				listenAndServe(srv, cancel, config.GetHTTPSEnabled())
-			}()
-
-			for {
-				select {
-				case <-ctx.Done():
-					mainLogger.Infof("Shutting down profiler on port %s", profilerPort)
-					ctx, cancel := context.WithTimeout(ctx, shutdownTimeout*time.Second)
-					srv.Shutdown(ctx)
-					cancel()
-					return
-				}
+			if err := reloader.Watch(ctx); err != nil {
+				mainLogger.WithField("error", err).Errorf("Failure to watch certificate of %s, its changes take effect on restart", name)
 			}
 		}()
 	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		go func() {
+			mainLogger.Infof("Starting %s on port %s", name, srv.Addr)
+			listenAndServe(srv, cancel, listener.TLS())
+		}()
+
+		<-ctx.Done()
+		mainLogger.Infof("Shutting down %s on port %s", name, srv.Addr)
+		ctx, cancel := context.WithTimeout(ctx, shutdownTimeout*time.Second)
+		srv.Shutdown(ctx)
+		cancel()
+	}()
 }
 
 // setupSignalChannel registers a listener for Unix signals for a ordered shutdown
@@ -261,30 +301,95 @@ func setupSignalChannel(cancel context.CancelFunc) {
 	}()
 }
 
-func newAPIServer(api api.ProxyAPI) *http.Server {
+func newAPIServer(proxyAPI api.ProxyAPI, authorizer *api.Authorizer, checker *health.Checker) *http.Server {
 	return &http.Server{
-		Addr:    apiRouterPort,
-		Handler: router.CreateAPIRouter(api),
+		Handler: requestid.Handler(router.CreateAPIRouter(proxyAPI, authorizer, checker)),
+	}
+}
+
+// newHealthChecker creates the checks of the readiness probe: the store, the upstream services,
+// whose results are cached not to flood them with probes, and the cluster view.
+func newHealthChecker(config configuration.Configuration, store storage.Store, clusters map[string]string) *health.Checker {
+	checker := health.NewChecker(config.GetHealthCheckTimeout())
+	checker.Add("store", store.Ping)
+
+	ttl := config.GetHealthCheckCacheTTL()
+	checker.Add(metric.UpstreamIdler, health.Cached(health.Reachable(config.GetIdlerURL()), ttl))
+	checker.Add(metric.UpstreamTenant, health.Cached(health.Reachable(config.GetTenantURL()), ttl))
+	checker.Add(metric.UpstreamWIT, health.Cached(health.Reachable(config.GetWitURL()), ttl))
+	checker.Add(metric.UpstreamAuth, health.Cached(health.Reachable(config.GetAuthURL()), ttl))
+
+	checker.Add("clusters", func(ctx context.Context) error {
+		if len(clusters) == 0 {
+			return errors.New("the cluster view of the idler is empty")
+		}
+		return nil
+	})
+	return checker
+}
+
+// newAPIAuthorizer creates the authorizer of the API router, or nil if its requests need no authentication
+func newAPIAuthorizer(config configuration.Configuration, tenant tenant.Service) *api.Authorizer {
+	if !config.GetAPIAuthEnabled() {
+		mainLogger.Warn("API router authentication is disabled")
+		return nil
+	}
+
+	authClient, err := auth.DefaultClient()
+	if err != nil {
+		mainLogger.WithField("error", err).Fatal("Failure to create API router authorizer")
 	}
+	return api.NewAuthorizer(authClient, tenant, config.GetAPIServiceAccounts())
 }
 
-func newJenkinsAPIServer(jenkinsAPI jenkinsapi.JenkinsAPI, config configuration.Configuration) *http.Server {
-	c := cors.New(cors.Options{
+// corsPolicy is the CORS policy of the Jenkins API router. Its allowed origins may be
+// reconfigured while the proxy runs.
+type corsPolicy struct {
+	lock sync.RWMutex
+	cors *cors.Cors
+}
+
+func newCORSPolicy(config configuration.Configuration) *corsPolicy {
+	c := &corsPolicy{}
+	c.Reconfigure(config)
+	return c
+}
+
+// Reconfigure applies the configured allowed origins.
+func (c *corsPolicy) Reconfigure(config configuration.Configuration) {
+	policy := cors.New(cors.Options{
 		AllowedOrigins: config.GetAllowedOrigins(),
 		AllowedMethods: []string{"HEAD", "GET", "POST", "PUT", "PATCH", "DELETE"},
 		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{requestid.Header},
 		Debug:          config.GetDebugMode(),
 	})
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cors = policy
+}
+
+// Handler applies the current CORS policy to the requests of the given handler.
+func (c *corsPolicy) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.lock.RLock()
+		policy := c.cors
+		c.lock.RUnlock()
+
+		policy.Handler(h).ServeHTTP(w, r)
+	})
+}
+
+func newJenkinsAPIServer(jenkinsAPI jenkinsapi.JenkinsAPI, origins *corsPolicy) *http.Server {
 	srv := &http.Server{
-		Addr:    jenkinsAPIRouterPort,
-		Handler: c.Handler(router.CreateJenkinsAPIRouter(jenkinsAPI)),
+		Handler: origins.Handler(requestid.Handler(router.CreateJenkinsAPIRouter(jenkinsAPI))),
 	}
 	return srv
 }
 
 func newProxyServer(p *proxy.Proxy) *http.Server {
 	srv := &http.Server{
-		Addr:    proxyPort,
 		Handler: router.CreateProxyRouter(p),
 	}
 	return srv
@@ -28,7 +28,7 @@ func (api *MockJenkinsAPIImpl) Status(w http.ResponseWriter, r *http.Request, _
 
 func TestAPIServerCORSHeaders(t *testing.T) {
 	config := configuration.NewMock()
-	apiServer := newJenkinsAPIServer(&MockJenkinsAPIImpl{}, &config)
+	apiServer := newJenkinsAPIServer(&MockJenkinsAPIImpl{}, newCORSPolicy(&config))
 
 	reader, _ := http.NewRequest("POST", "/doesntmatter", nil)
 
@@ -53,6 +53,20 @@ func TestAPIServerCORSHeaders(t *testing.T) {
 	}
 }
 
+func TestAPIServerCORSReconfigure(t *testing.T) {
+	config := configuration.NewMock()
+	origins := newCORSPolicy(&config)
+	apiServer := newJenkinsAPIServer(&MockJenkinsAPIImpl{}, origins)
+
+	reader, _ := http.NewRequest("POST", "/doesntmatter", nil)
+	assertCorsHeaders(reader, "https://example.com", "", apiServer, t)
+
+	config.AllowedOrigins = []string{"https://example.com"}
+	origins.Reconfigure(&config)
+	assertCorsHeaders(reader, "https://example.com", "https://example.com", apiServer, t)
+	assertCorsHeaders(reader, "https://openshift.io", "", apiServer, t)
+}
+
 func assertCorsHeaders(r *http.Request, given string, expected string, apiServer *http.Server, t *testing.T) {
 	// GIVEN
 	r.Header.Set("Origin", given)
@@ -120,6 +120,7 @@ func TestProxy(t *testing.T) {
 	logMessages := testutils.ExtractLogMessages(hook.Entries)
 	assert.Contains(t, logMessages, "Shutting down proxy on port :8080", "Proxy should shut down gracefully")
 	assert.Contains(t, logMessages, "Shutting down API router on port :9091", "API router should shutdown gracefully")
+	assert.Contains(t, logMessages, "Stopped replaying buffered requests", "Replay should stop gracefully")
 }
 
 func contains(list []string, s string) bool {
@@ -13,16 +13,31 @@ import (
 //ProxyAPI is an API to serve user statistics
 type ProxyAPI interface {
 	Info(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
+	DeadLetters(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
+	DeadLetter(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
+	RequeueDeadLetter(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
+	Requests(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
+	Request(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
+	DeleteRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
+	ReplayRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
+	PurgeRequests(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
+	PurgeExpired(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
+	Readiness(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 }
 
 type proxy struct {
 	storageService storage.Store
+	replayer       Replayer
+	purger         Purger
 }
 
-// NewAPI creates an instance of ProxyAPI on taking a storage/database service as input.
-func NewAPI(storageService storage.Store) ProxyAPI {
+// NewAPI creates an instance of ProxyAPI on taking a storage/database service,
+// the replayer of buffered requests and the purger of expired rows as input.
+func NewAPI(storageService storage.Store, replayer Replayer, purger Purger) ProxyAPI {
 	return &proxy{
 		storageService: storageService,
+		replayer:       replayer,
+		purger:         purger,
 	}
 }
 
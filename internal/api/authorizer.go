@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/auth"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tenant"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const jenkinsNamespaceSuffix = "-jenkins"
+
+var authzLogger = log.WithFields(log.Fields{"component": "api-authz"})
+
+// Authorizer checks the bearer tokens of requests to the API router. Tokens are
+// verified with the public keys of the auth service. Service accounts on the
+// allow-list may use every endpoint, users may only read their own namespace.
+// A nil Authorizer lets all requests pass.
+type Authorizer struct {
+	auth            auth.Service
+	tenant          tenant.Service
+	serviceAccounts map[string]bool
+}
+
+// NewAuthorizer creates an Authorizer allowing the service accounts with the given subjects.
+func NewAuthorizer(auth auth.Service, tenant tenant.Service, serviceAccounts []string) *Authorizer {
+	a := &Authorizer{
+		auth:            auth,
+		tenant:          tenant,
+		serviceAccounts: make(map[string]bool),
+	}
+	for _, sub := range serviceAccounts {
+		if sub = strings.TrimSpace(sub); sub != "" {
+			a.serviceAccounts[sub] = true
+		}
+	}
+	return a
+}
+
+// ServiceAccount wraps a handler so that it only serves requests of allowed service accounts.
+func (a *Authorizer) ServiceAccount(h httprouter.Handle) httprouter.Handle {
+	if a == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		_, sub, err := a.authenticate(r)
+		if err != nil {
+			a.deny(w, http.StatusUnauthorized, err)
+			return
+		}
+		if !a.serviceAccounts[sub] {
+			a.deny(w, http.StatusForbidden, fmt.Errorf("subject %s is not an allowed service account", sub))
+			return
+		}
+		h(w, r, ps)
+	}
+}
+
+// Namespace wraps a handler so that it serves requests of allowed service accounts
+// and of users whose Jenkins namespace is the namespace parameter of the request.
+func (a *Authorizer) Namespace(h httprouter.Handle) httprouter.Handle {
+	if a == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		token, sub, err := a.authenticate(r)
+		if err != nil {
+			a.deny(w, http.StatusUnauthorized, err)
+			return
+		}
+		if a.serviceAccounts[sub] {
+			h(w, r, ps)
+			return
+		}
+
+		namespace, err := a.tenant.GetNamespace(r.Context(), token)
+		if err != nil {
+			a.deny(w, http.StatusForbidden, err)
+			return
+		}
+		ns := ps.ByName("namespace")
+		if strings.TrimSuffix(namespace.Name, jenkinsNamespaceSuffix) != strings.TrimSuffix(ns, jenkinsNamespaceSuffix) {
+			a.deny(w, http.StatusForbidden, fmt.Errorf("subject %s may not access namespace %s", sub, ns))
+			return
+		}
+		h(w, r, ps)
+	}
+}
+
+// authenticate verifies the bearer token of a request and returns it together with its subject.
+func (a *Authorizer) authenticate(r *http.Request) (token string, sub string, err error) {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return "", "", errors.New("could not find Bearer token in Authorization header")
+	}
+	token = strings.TrimPrefix(authHeader, "Bearer ")
+
+	sub, err = a.auth.UIDFromToken(r.Context(), token)
+	if err != nil {
+		return "", "", err
+	}
+	if sub == "" {
+		return "", "", errors.New("invalid token")
+	}
+	return token, sub, nil
+}
+
+func (a *Authorizer) deny(w http.ResponseWriter, status int, err error) {
+	authzLogger.Warnf("Denying API request: %s", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "{\"error\": %q}\n", http.StatusText(status))
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
+	"github.com/julienschmidt/httprouter"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeadLetterResponse describes a dead letter including the headers and payload of its request.
+// Secrets in its headers, query and request URI are redacted like in logs.
+type DeadLetterResponse struct {
+	storage.DeadLetter
+	Headers map[string][]string `json:"headers"`
+	Payload string              `json:"payload"`
+}
+
+// DeadLetters returns JSON listing the dead letters, of one namespace if the namespace query parameter is set.
+func (api *proxy) DeadLetters(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	deadLetters, err := api.storageService.GetDeadLetters(r.URL.Query().Get("namespace"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if deadLetters == nil {
+		deadLetters = []storage.DeadLetter{}
+	}
+	for i := range deadLetters {
+		deadLetters[i] = redactDeadLetter(deadLetters[i])
+	}
+
+	json.NewEncoder(w).Encode(deadLetters)
+}
+
+// DeadLetter returns JSON describing a dead letter including the headers and payload of its request.
+func (api *proxy) DeadLetter(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	d, ok := api.loadDeadLetter(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+
+	headers, err := d.GetHeaders()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	payload, err := d.GetPayload()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(DeadLetterResponse{
+		DeadLetter: redactDeadLetter(*d),
+		Headers:    logging.RedactHeaders(headers),
+		Payload:    string(payload),
+	})
+}
+
+// RequeueDeadLetter buffers the request of a dead letter again, so that it is replayed with reset retries.
+func (api *proxy) RequeueDeadLetter(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	d, ok := api.loadDeadLetter(w, ps.ByName("id"))
+	if !ok {
+		return
+	}
+
+	err := api.storageService.RequeueDeadLetter(d)
+	if err == storage.ErrDuplicateDelivery {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.WithField("ns", d.Namespace).Infof("Re-enqueued dead letter %s", d.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// redactDeadLetter returns the dead letter with the secrets in its query and request URI redacted.
+func redactDeadLetter(d storage.DeadLetter) storage.DeadLetter {
+	d.RawQuery = logging.RedactQuery(d.RawQuery)
+	d.RequestURI = logging.RedactRequestURI(d.RequestURI)
+	return d
+}
+
+func (api *proxy) loadDeadLetter(w http.ResponseWriter, id string) (*storage.DeadLetter, bool) {
+	if _, err := uuid.FromString(id); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	d, notFound, err := api.storageService.GetDeadLetter(id)
+	if notFound {
+		writeError(w, http.StatusNotFound, fmt.Errorf("dead letter %s not found", id))
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return d, true
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	log.Error(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterIsRedacted(t *testing.T) {
+	api, store, _ := newTestAPI()
+	r := bufferRequest(t, store, "ns", "http://proxy/generic-webhook-trigger/invoke?token="+testSecret)
+	require.NoError(t, store.MoveToDeadLetters(r))
+
+	w := httptest.NewRecorder()
+	api.DeadLetter(w, httptest.NewRequest("GET", "http://api/", nil), params("id", r.ID.String()))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), testSecret, "Secrets should be redacted")
+	var response DeadLetterResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, "token=REDACTED", response.RawQuery)
+	assert.Equal(t, "http://proxy/generic-webhook-trigger/invoke?token=REDACTED", response.RequestURI)
+
+	w = httptest.NewRecorder()
+	api.DeadLetters(w, httptest.NewRequest("GET", "http://api/api/deadletters", nil), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), testSecret, "Secrets should be redacted from listed dead letters")
+}
+
+func TestRequeueDeadLetter(t *testing.T) {
+	api, store, _ := newTestAPI()
+	r := bufferRequest(t, store, "ns", "http://proxy/github-webhook/")
+	require.NoError(t, store.MoveToDeadLetters(r))
+
+	w := httptest.NewRecorder()
+	api.RequeueDeadLetter(w, httptest.NewRequest("POST", "http://api/", nil), params("id", r.ID.String()))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	count, _ := store.GetRequestsCount("ns")
+	assert.Equal(t, 1, count, "Request should be buffered again")
+
+	w = httptest.NewRecorder()
+	api.RequeueDeadLetter(w, httptest.NewRequest("POST", "http://api/", nil), params("id", r.ID.String()))
+	assert.Equal(t, http.StatusNotFound, w.Code, "Requeued dead letter should be gone")
+}
+
+func TestRequeueDeadLetterOfBufferedRedeliveryConflicts(t *testing.T) {
+	api, store, _ := newTestAPI()
+	deliveryID := "72d3162e-cc78-11e3-81ab-4c9367dc0958"
+	r := bufferRequest(t, store, "ns", "http://proxy/github-webhook/")
+	require.NoError(t, store.DeleteRequest(r))
+	r.DeliveryID = &deliveryID
+	require.NoError(t, store.CreateRequest(r))
+	require.NoError(t, store.MoveToDeadLetters(r))
+
+	redelivery := bufferRequest(t, store, "ns", "http://proxy/github-webhook/")
+	require.NoError(t, store.DeleteRequest(redelivery))
+	redelivery.DeliveryID = &deliveryID
+	require.NoError(t, store.CreateRequest(redelivery))
+
+	w := httptest.NewRecorder()
+	api.RequeueDeadLetter(w, httptest.NewRequest("POST", "http://api/", nil), params("id", r.ID.String()))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	_, notFound, err := store.GetDeadLetter(r.ID.String())
+	assert.NoError(t, err)
+	assert.False(t, notFound, "Dead letter should be kept")
+	count, _ := store.GetRequestsCount("ns")
+	assert.Equal(t, 1, count, "Only the redelivery should be buffered")
+}
+
+func TestUnknownDeadLetterIsNotFound(t *testing.T) {
+	api, _, _ := newTestAPI()
+
+	w := httptest.NewRecorder()
+	api.DeadLetter(w, httptest.NewRequest("GET", "http://api/", nil), params("id", "5f2c5a6e-1b2a-4c1e-9a62-2b7d0c9b2a11"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var deadLetters []storage.DeadLetter
+	w = httptest.NewRecorder()
+	api.DeadLetters(w, httptest.NewRequest("GET", "http://api/api/deadletters?namespace=ns", nil), nil)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&deadLetters))
+	assert.Empty(t, deadLetters)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ReadinessResponse describes how long Jenkins took to be ready after it was unidled.
+type ReadinessResponse struct {
+	storage.Readiness
+	// Seconds is how long Jenkins took to be ready, it is omitted while Jenkins is not ready yet.
+	Seconds *float64 `json:"seconds,omitempty"`
+}
+
+// Readiness returns JSON listing the last time-to-ready measurements of a namespace, most recent first.
+func (api *proxy) Readiness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	measurements, err := api.storageService.GetReadiness(ps.ByName("namespace"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp := make([]ReadinessResponse, 0, len(measurements))
+	for _, m := range measurements {
+		item := ReadinessResponse{Readiness: m}
+		if m.ReadyAt != nil {
+			seconds := m.Duration().Seconds()
+			item.Seconds = &seconds
+		}
+		resp = append(resp, item)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
+	"github.com/julienschmidt/httprouter"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// Replayer replays the buffered requests of a namespace on demand.
+type Replayer interface {
+	Replay(ns string)
+}
+
+// RequestSummary describes a buffered request without its headers and payload. Secrets in
+// its request URI are redacted like in logs.
+type RequestSummary struct {
+	ID          uuid.UUID  `json:"id"`
+	Method      string     `json:"method"`
+	Host        string     `json:"host"`
+	Scheme      string     `json:"scheme"`
+	RequestURI  string     `json:"request_uri"`
+	DeliveryID  *string    `json:"delivery_id,omitempty"`
+	RequestID   string     `json:"request_id,omitempty"`
+	Retries     int        `json:"retries"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastStatus  int        `json:"last_status,omitempty"`
+}
+
+// RequestResponse describes a buffered request including its headers and payload. Secrets
+// in its headers are redacted like in logs.
+type RequestResponse struct {
+	RequestSummary
+	Namespace string              `json:"namespace"`
+	Headers   map[string][]string `json:"headers"`
+	Payload   string              `json:"payload"`
+}
+
+// RequestsPage is a page of the buffered requests of a namespace.
+type RequestsPage struct {
+	Namespace string           `json:"namespace"`
+	Total     int              `json:"total"`
+	Offset    int              `json:"offset"`
+	Limit     int              `json:"limit"`
+	Requests  []RequestSummary `json:"requests"`
+}
+
+// PurgeResponse tells how many buffered requests of a namespace were purged.
+type PurgeResponse struct {
+	Namespace string `json:"namespace"`
+	Deleted   int64  `json:"deleted"`
+}
+
+func newRequestSummary(r storage.Request) RequestSummary {
+	return RequestSummary{
+		ID:          r.ID,
+		Method:      r.Method,
+		Host:        r.Host,
+		Scheme:      r.Scheme,
+		RequestURI:  logging.RedactRequestURI(r.RequestURI),
+		DeliveryID:  r.DeliveryID,
+		RequestID:   r.RequestID,
+		Retries:     r.Retries,
+		CreatedAt:   r.CreatedAt,
+		NextAttempt: r.NextAttempt,
+		LastError:   r.LastError,
+		LastStatus:  r.LastStatus,
+	}
+}
+
+// Requests returns JSON listing a page of the buffered requests of a namespace in replay order.
+// The page is selected by the offset and limit query parameters.
+func (api *proxy) Requests(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ns := ps.ByName("namespace")
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultPageLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit < 1 || limit > maxPageLimit {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxPageLimit))
+		return
+	}
+
+	total, err := api.storageService.GetRequestsCount(ns)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	requests, err := api.storageService.GetRequestsPage(ns, offset, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	page := RequestsPage{
+		Namespace: ns,
+		Total:     total,
+		Offset:    offset,
+		Limit:     limit,
+		Requests:  []RequestSummary{},
+	}
+	for _, request := range requests {
+		page.Requests = append(page.Requests, newRequestSummary(request))
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
+// Request returns JSON describing a buffered request including its headers and payload.
+func (api *proxy) Request(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	request, ok := api.loadRequest(w, ps)
+	if !ok {
+		return
+	}
+
+	headers, err := request.GetHeaders()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	payload, err := request.GetPayload()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(RequestResponse{
+		RequestSummary: newRequestSummary(*request),
+		Namespace:      request.Namespace,
+		Headers:        logging.RedactHeaders(headers),
+		Payload:        string(payload),
+	})
+}
+
+// DeleteRequest deletes a buffered request, so that it is never replayed.
+func (api *proxy) DeleteRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	request, ok := api.loadRequest(w, ps)
+	if !ok {
+		return
+	}
+
+	if err := api.storageService.DeleteRequest(request); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.WithField("ns", request.Namespace).Infof("Deleted buffered request %s", request.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReplayRequest makes a buffered request due and replays its namespace right away.
+// Requests buffered before it are still replayed first.
+func (api *proxy) ReplayRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	request, ok := api.loadRequest(w, ps)
+	if !ok {
+		return
+	}
+
+	if err := api.storageService.ResetNextAttempt(request); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	api.replayer.Replay(request.Namespace)
+
+	log.WithField("ns", request.Namespace).Infof("Replaying buffered request %s on demand", request.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// PurgeRequests deletes all buffered requests of a namespace.
+func (api *proxy) PurgeRequests(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ns := ps.ByName("namespace")
+
+	deleted, err := api.storageService.DeleteRequests(ns)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.WithField("ns", ns).Infof("Purged %d buffered requests", deleted)
+	json.NewEncoder(w).Encode(PurgeResponse{Namespace: ns, Deleted: deleted})
+}
+
+// loadRequest loads the buffered request identified by the id and namespace parameters.
+func (api *proxy) loadRequest(w http.ResponseWriter, ps httprouter.Params) (*storage.Request, bool) {
+	id := ps.ByName("id")
+	if _, err := uuid.FromString(id); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	request, notFound, err := api.storageService.GetRequest(id)
+	if notFound || (err == nil && request.Namespace != ps.ByName("namespace")) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("request %s not found in namespace %s", id, ps.ByName("namespace")))
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return request, true
+}
+
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return i, nil
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "s3cr3t"
+
+// replayer records the namespaces asked to be replayed
+type replayer struct {
+	namespaces []string
+}
+
+func (r *replayer) Replay(ns string) {
+	r.namespaces = append(r.namespaces, ns)
+}
+
+func newTestAPI() (*proxy, *storage.MemoryStore, *replayer) {
+	store := storage.NewMemoryStore()
+	r := &replayer{}
+	return &proxy{storageService: store, replayer: r}, store, r
+}
+
+func bufferRequest(t *testing.T, store storage.Store, ns string, target string) *storage.Request {
+	req := httptest.NewRequest("POST", target, bytes.NewBufferString(`{"ref":"refs/heads/master"}`))
+	req.Header.Set("X-Gitlab-Token", testSecret)
+	req.Header.Set("Content-Type", "application/json")
+
+	r, err := storage.NewRequest(req, ns, []byte(`{"ref":"refs/heads/master"}`))
+	require.NoError(t, err)
+	require.NoError(t, store.CreateRequest(r))
+	return r
+}
+
+func params(kv ...string) httprouter.Params {
+	var ps httprouter.Params
+	for i := 0; i+1 < len(kv); i += 2 {
+		ps = append(ps, httprouter.Param{Key: kv[i], Value: kv[i+1]})
+	}
+	return ps
+}
+
+func TestRequestsArePaged(t *testing.T) {
+	api, store, _ := newTestAPI()
+	for i := 0; i < 3; i++ {
+		bufferRequest(t, store, "ns", "http://proxy/gitlab-webhook/")
+	}
+
+	var tt = []struct {
+		query  string
+		status int
+		count  int
+	}{
+		{"", http.StatusOK, 3},
+		{"?offset=1&limit=1", http.StatusOK, 1},
+		{"?offset=2&limit=100", http.StatusOK, 1},
+		{"?offset=3", http.StatusOK, 0},
+		{"?limit=0", http.StatusBadRequest, 0},
+		{"?limit=101", http.StatusBadRequest, 0},
+		{"?offset=-1", http.StatusBadRequest, 0},
+		{"?offset=foo", http.StatusBadRequest, 0},
+	}
+
+	for _, testcase := range tt {
+		t.Run(testcase.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			api.Requests(w, httptest.NewRequest("GET", "http://api/api/requests/ns"+testcase.query, nil), params("namespace", "ns"))
+
+			assert.Equal(t, testcase.status, w.Code)
+			if testcase.status != http.StatusOK {
+				return
+			}
+			var page RequestsPage
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&page))
+			assert.Equal(t, 3, page.Total)
+			assert.Len(t, page.Requests, testcase.count)
+		})
+	}
+}
+
+func TestRequestIsRedacted(t *testing.T) {
+	api, store, _ := newTestAPI()
+	r := bufferRequest(t, store, "ns", "http://proxy/generic-webhook-trigger/invoke?job=a&token="+testSecret)
+
+	w := httptest.NewRecorder()
+	api.Request(w, httptest.NewRequest("GET", "http://api/", nil), params("namespace", "ns", "id", r.ID.String()))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), testSecret, "Secrets should be redacted")
+	var response RequestResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, []string{"REDACTED"}, response.Headers["X-Gitlab-Token"])
+	assert.Equal(t, []string{"application/json"}, response.Headers["Content-Type"])
+	assert.Equal(t, "http://proxy/generic-webhook-trigger/invoke?job=a&token=REDACTED", response.RequestURI)
+
+	w = httptest.NewRecorder()
+	api.Requests(w, httptest.NewRequest("GET", "http://api/api/requests/ns", nil), params("namespace", "ns"))
+	assert.NotContains(t, w.Body.String(), testSecret, "Secrets should be redacted from listed requests")
+}
+
+func TestRequestOfOtherNamespaceIsNotFound(t *testing.T) {
+	api, store, replayer := newTestAPI()
+	r := bufferRequest(t, store, "ns", "http://proxy/gitlab-webhook/")
+	ps := params("namespace", "other-ns", "id", r.ID.String())
+
+	w := httptest.NewRecorder()
+	api.Request(w, httptest.NewRequest("GET", "http://api/", nil), ps)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	api.ReplayRequest(w, httptest.NewRequest("POST", "http://api/", nil), ps)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, replayer.namespaces, "Namespace should not be replayed")
+
+	w = httptest.NewRecorder()
+	api.DeleteRequest(w, httptest.NewRequest("DELETE", "http://api/", nil), ps)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	count, _ := store.GetRequestsCount("ns")
+	assert.Equal(t, 1, count, "Request should not be deleted")
+
+	w = httptest.NewRecorder()
+	api.Request(w, httptest.NewRequest("GET", "http://api/", nil), params("namespace", "ns", "id", "no-uuid"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Purger deletes the stored rows which outlived their retention.
+type Purger interface {
+	Purge() (storage.PurgeResult, error)
+}
+
+// PurgeExpired deletes the stored rows which outlived their retention right away,
+// instead of waiting for the next background purge, and returns JSON telling how many were deleted.
+func (api *proxy) PurgeExpired(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	result, err := api.purger.Purge()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
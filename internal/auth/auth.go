@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"crypto/rsa"
 	"encoding/json"
 	"fmt"
@@ -12,15 +13,20 @@ import (
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tracing"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 	"github.com/matryer/resync"
 	log "github.com/sirupsen/logrus"
 )
 
-// Service talks to fabric8-auth for authentication and authorization
+// Service talks to fabric8-auth for authentication and authorization. Calls to
+// fabric8-auth are cancelled once the given context is done.
 type Service interface {
-	UIDFromToken(accessToken string) (sub string, err error)
-	OSOTokenForCluster(clusterURL, accessToken string) (osoToken string, err error)
+	UIDFromToken(ctx context.Context, accessToken string) (sub string, err error)
+	OSOTokenForCluster(ctx context.Context, clusterURL, accessToken string) (osoToken string, err error)
 	CreateRedirectURL(to string) string
 }
 
@@ -66,13 +72,19 @@ func NewClient(authURL string) *Client {
 		log:        log.WithField("component", "auth"),
 		updateWait: 5 * time.Minute,
 	}
-	go c.updatePublicKeysOnce()
+	go c.updatePublicKeysOnce(context.Background())
 	return c
 }
 
-// UIDFromToken returns user identity given a raw jwt token
-func (c *Client) UIDFromToken(accessToken string) (sub string, err error) {
-	t, err := jwt.Parse(accessToken, c.publicKeyForToken)
+// UIDFromToken returns user identity given a raw jwt token. The public keys of
+// fabric8-auth are fetched with the given context if the key of the token is unknown.
+func (c *Client) UIDFromToken(ctx context.Context, accessToken string) (sub string, err error) {
+	ctx, span := tracing.Start(ctx, "auth.UIDFromToken")
+	defer func() { tracing.End(span, err) }()
+
+	t, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
+		return c.publicKeyForToken(ctx, token)
+	})
 	if err != nil {
 		return
 	}
@@ -84,22 +96,32 @@ func (c *Client) UIDFromToken(accessToken string) (sub string, err error) {
 
 	claims, ok := t.Claims.(jwt.MapClaims)
 	if ok && t.Valid {
-		if claims["sub"].(string) == "" {
+		subject, ok := claims["sub"].(string)
+		if !ok || subject == "" {
 			err = fmt.Errorf("Could not find user id in token")
 			return
 		}
-		sub = claims["sub"].(string)
+		sub = subject
 	}
 	return
 }
 
 // OSOTokenForCluster returns Openshift online token given the clusterURL and raw JWT token
-func (c *Client) OSOTokenForCluster(clusterURL, accessToken string) (osoToken string, err error) {
+func (c *Client) OSOTokenForCluster(ctx context.Context, clusterURL, accessToken string) (osoToken string, err error) {
+	ctx, span := tracing.Start(ctx, "auth.OSOTokenForCluster", tracing.Cluster(clusterURL))
+	defer func(start time.Time) {
+		metric.DefaultRecorder().RecordUpstreamLatency(metric.UpstreamAuth, time.Since(start), err)
+		tracing.End(span, err)
+	}(time.Now())
+
 	url := fmt.Sprintf("%s/api/token?for=%s", strings.TrimRight(c.URL, "/"), clusterURL)
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return
 	}
+	req = req.WithContext(ctx)
+	requestid.Propagate(req)
+	tracing.Inject(req)
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 
 	resp, err := util.HTTPClient().Do(req)
@@ -140,12 +162,12 @@ func (c *Client) CreateRedirectURL(to string) string {
 		strings.TrimRight(c.URL, "/"), url.PathEscape(to))
 }
 
-func (c *Client) rsaPublicKeyForID(kid string) (*rsa.PublicKey, error) {
+func (c *Client) rsaPublicKeyForID(ctx context.Context, kid string) (*rsa.PublicKey, error) {
 	if val, ok := c.publicKeys.Load(kid); ok {
 		return val.(*rsa.PublicKey), nil
 	}
 
-	if err := c.updatePublicKeysOnce(); err != nil {
+	if err := c.updatePublicKeysOnce(ctx); err != nil {
 		return nil, fmt.Errorf("no public key for key-id: %q; err: %s", kid, err)
 	}
 
@@ -156,7 +178,7 @@ func (c *Client) rsaPublicKeyForID(kid string) (*rsa.PublicKey, error) {
 	return nil, fmt.Errorf("no public key for key-id: %q", kid)
 }
 
-func (c *Client) publicKeyForToken(token *jwt.Token) (interface{}, error) {
+func (c *Client) publicKeyForToken(ctx context.Context, token *jwt.Token) (interface{}, error) {
 
 	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -167,7 +189,7 @@ func (c *Client) publicKeyForToken(token *jwt.Token) (interface{}, error) {
 		return nil, fmt.Errorf("missing mandatory kid header: %v", token.Header)
 	}
 
-	if pk, err := c.rsaPublicKeyForID(kid.(string)); err == nil {
+	if pk, err := c.rsaPublicKeyForID(ctx, kid.(string)); err == nil {
 		return pk, nil
 	}
 
@@ -178,10 +200,10 @@ func (c *Client) publicKeyForToken(token *jwt.Token) (interface{}, error) {
 // even if the func is called by several go routines at once. Keys can
 // however be fetched again after the waiting period expires or if
 // updatePublicKeys generates an error
-func (c *Client) updatePublicKeysOnce() error {
+func (c *Client) updatePublicKeysOnce(ctx context.Context) error {
 	var err error
 	c.singleUpdate.Do(func() {
-		err = c.updatePublicKeys()
+		err = c.updatePublicKeys(ctx)
 	})
 
 	if err != nil {
@@ -194,11 +216,24 @@ func (c *Client) updatePublicKeysOnce() error {
 	return err
 }
 
-func (c *Client) updatePublicKeys() error {
+func (c *Client) updatePublicKeys(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "auth.updatePublicKeys")
+	defer func(start time.Time) {
+		metric.DefaultRecorder().RecordUpstreamLatency(metric.UpstreamAuth, time.Since(start), err)
+		tracing.End(span, err)
+	}(time.Now())
+
 	tokenURL := strings.TrimRight(c.URL, "/") + "/api/token/keys?format=pem"
 
-	c.log.Infof("Fetching public keys from %s", tokenURL)
-	resp, err := util.HTTPClient().Get(tokenURL)
+	c.log.Infof("Fetching public keys from %s", logging.RedactURLString(tokenURL))
+	req, err := http.NewRequest("GET", tokenURL, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	requestid.Propagate(req)
+	tracing.Inject(req)
+	resp, err := util.HTTPClient().Do(req)
 	if err != nil {
 		return err
 	}
@@ -1,12 +1,19 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	jwt "github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // created from curl https://auth.prod-preview.openshift.io/api/token/keys?format=pem
@@ -108,7 +115,7 @@ func TestClient_no_update_if_success(t *testing.T) {
 	assert.Equal(t, mockAuth.calls, 1, "client failed to update keys")
 
 	// must not make any more calls since the previous on succeeded
-	c.updatePublicKeysOnce()
+	c.updatePublicKeysOnce(context.Background())
 	assert.Equal(t, mockAuth.calls, 1, "client updated keys when it should not")
 }
 
@@ -134,11 +141,11 @@ func TestClient_can_update_if_failed(t *testing.T) {
 	<-mockAuth.called
 	assert.Equal(t, mockAuth.calls, 1, "client failed to update keys")
 
-	err := c.updatePublicKeysOnce()
+	err := c.updatePublicKeysOnce(context.Background())
 	<-mockAuth.called
 	assert.NotNil(t, err, "auth did not return bad keys")
 
-	err = c.updatePublicKeysOnce()
+	err = c.updatePublicKeysOnce(context.Background())
 	assert.Nil(t, err, "auth did not return good keys")
 	assert.Equal(t, mockAuth.calls, 3, "client failed to update keys")
 }
@@ -154,9 +161,33 @@ func TestNewClient_multiple_updates(t *testing.T) {
 	// first one will fail due to badKeys, and then one of the
 	// following updates must get the good keys
 	for i := 0; i < 10; i++ {
-		go c.updatePublicKeysOnce()
+		go c.updatePublicKeysOnce(context.Background())
 	}
 
 	<-mockAuth.done
 	assert.Equal(t, mockAuth.calls, 2, "client didn't make expected calls")
 }
+
+func TestUIDFromToken_needs_subject(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	c := &Client{log: log.WithField("component", "auth"), updateWait: time.Minute}
+	c.publicKeys.Store("test-kid", &key.PublicKey)
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-kid"
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	sub, err := c.UIDFromToken(context.Background(), sign(jwt.MapClaims{"sub": "user-id"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-id", sub)
+
+	for _, claims := range []jwt.MapClaims{{}, {"sub": ""}, {"sub": 42}} {
+		_, err := c.UIDFromToken(context.Background(), sign(claims))
+		assert.Error(t, err, "Token with claims %v should be rejected", claims)
+	}
+}
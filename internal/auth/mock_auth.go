@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
@@ -19,12 +20,12 @@ func NewMockAuth(authURL string) *MockAuth {
 }
 
 // UIDFromToken returns user identity given a raw jwt token
-func (c *MockAuth) UIDFromToken(accessToken string) (sub string, err error) {
+func (c *MockAuth) UIDFromToken(ctx context.Context, accessToken string) (sub string, err error) {
 	return "test_subject", nil
 }
 
 // OSOTokenForCluster returns Openshift online token given the clusterURL and raw JWT token
-func (c *MockAuth) OSOTokenForCluster(clusterURL, accessToken string) (osoToken string, err error) {
+func (c *MockAuth) OSOTokenForCluster(ctx context.Context, clusterURL, accessToken string) (osoToken string, err error) {
 	return "test_oso_token", nil
 }
 
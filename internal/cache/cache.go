@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"encoding/json"
+)
+
+// Cache stores values by key for the time to live it was created with. Values are stored
+// JSON encoded, so that every implementation returns copies and caches shared by several
+// replicas hold the same values.
+type Cache interface {
+	// Get decodes the value of the given key into value. It returns false if the key is not
+	// cached or expired.
+	Get(key string, value interface{}) (bool, error)
+
+	// Set caches the value for the given key.
+	Set(key string, value interface{}) error
+
+	// Delete removes the given key, it is not an error if the key is not cached.
+	Delete(key string) error
+}
+
+func encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func decode(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a Cache local to the process holding at most a given number of entries.
+// When it is full, the least recently used entry is evicted.
+type LRU struct {
+	lock    sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	// recent orders the entries from the most to the least recently used
+	recent *list.List
+}
+
+type lruEntry struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewLRU creates an in-process cache holding at most size entries.
+func NewLRU(size int, ttl time.Duration) *LRU {
+	if size < 1 {
+		size = 1
+	}
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		recent:  list.New(),
+	}
+}
+
+// Get decodes the value of the given key into value.
+func (c *LRU) Get(key string, value interface{}) (bool, error) {
+	c.lock.Lock()
+	element, found := c.entries[key]
+	if !found {
+		c.lock.Unlock()
+		return false, nil
+	}
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(element)
+		c.lock.Unlock()
+		return false, nil
+	}
+	c.recent.MoveToFront(element)
+	c.lock.Unlock()
+
+	return true, decode(entry.data, value)
+}
+
+// Set caches the value for the given key, evicting the least recently used entry if the cache is full.
+func (c *LRU) Set(key string, value interface{}) error {
+	data, err := encode(value)
+	if err != nil {
+		return err
+	}
+	entry := &lruEntry{key: key, data: data, expiresAt: time.Now().Add(c.ttl)}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, found := c.entries[key]; found {
+		element.Value = entry
+		c.recent.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.recent.PushFront(entry)
+	for c.recent.Len() > c.size {
+		c.remove(c.recent.Back())
+	}
+	return nil
+}
+
+// Delete removes the given key.
+func (c *LRU) Delete(key string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, found := c.entries[key]; found {
+		c.remove(element)
+	}
+	return nil
+}
+
+// Len returns the number of cached entries, including expired ones not evicted yet.
+func (c *LRU) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.recent.Len()
+}
+
+func (c *LRU) remove(element *list.Element) {
+	c.recent.Remove(element)
+	delete(c.entries, element.Value.(*lruEntry).key)
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type session struct {
+	NS    string
+	Route string
+}
+
+func Test_lru_evicts_least_recently_used_entries(t *testing.T) {
+	c := NewLRU(2, time.Hour)
+
+	assert.NoError(t, c.Set("a", session{NS: "a"}))
+	assert.NoError(t, c.Set("b", session{NS: "b"}))
+
+	// using a makes b the least recently used entry
+	var s session
+	found, err := c.Get("a", &s)
+	assert.NoError(t, err)
+	assert.True(t, found, "a should be cached.")
+	assert.Equal(t, session{NS: "a"}, s)
+
+	assert.NoError(t, c.Set("c", session{NS: "c"}))
+	assert.Equal(t, 2, c.Len(), "Cache should not grow beyond its size.")
+
+	found, _ = c.Get("b", &s)
+	assert.False(t, found, "b should have been evicted.")
+	for _, key := range []string{"a", "c"} {
+		found, _ = c.Get(key, &s)
+		assert.True(t, found, "%s should be cached.", key)
+	}
+}
+
+func Test_lru_entries_expire(t *testing.T) {
+	c := NewLRU(10, 10*time.Millisecond)
+	assert.NoError(t, c.Set("a", session{NS: "a"}))
+
+	time.Sleep(20 * time.Millisecond)
+
+	var s session
+	found, err := c.Get("a", &s)
+	assert.NoError(t, err)
+	assert.False(t, found, "a should have expired.")
+	assert.Equal(t, 0, c.Len(), "Expired entry should have been removed.")
+}
+
+func Test_lru_values_are_copies(t *testing.T) {
+	c := NewLRU(10, time.Hour)
+	s := session{NS: "a", Route: "jenkins-a"}
+	assert.NoError(t, c.Set("a", s))
+	s.Route = "changed"
+
+	var cached session
+	_, err := c.Get("a", &cached)
+	assert.NoError(t, err)
+	assert.Equal(t, "jenkins-a", cached.Route, "Cached value should not change with the original.")
+
+	assert.NoError(t, c.Delete("a"))
+	assert.NoError(t, c.Delete("a"), "Deleting a missing key should not fail.")
+	found, _ := c.Get("a", &cached)
+	assert.False(t, found, "a should have been deleted.")
+}
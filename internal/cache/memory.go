@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// Memory is a Cache local to the process. Expired entries are removed every cleanup interval.
+type Memory struct {
+	cache *gocache.Cache
+}
+
+// NewMemory creates an in-process cache.
+func NewMemory(ttl time.Duration, cleanupInterval time.Duration) *Memory {
+	return &Memory{
+		cache: gocache.New(ttl, cleanupInterval),
+	}
+}
+
+// Get decodes the value of the given key into value.
+func (c *Memory) Get(key string, value interface{}) (bool, error) {
+	data, found := c.cache.Get(key)
+	if !found {
+		return false, nil
+	}
+	return true, decode(data.([]byte), value)
+}
+
+// Set caches the value for the given key.
+func (c *Memory) Set(key string, value interface{}) error {
+	data, err := encode(value)
+	if err != nil {
+		return err
+	}
+	c.cache.SetDefault(key, data)
+	return nil
+}
+
+// Delete removes the given key.
+func (c *Memory) Delete(key string) error {
+	c.cache.Delete(key)
+	return nil
+}
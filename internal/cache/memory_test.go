@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_memory_cache_round_trips_values(t *testing.T) {
+	c := NewMemory(time.Hour, time.Hour)
+
+	var s session
+	found, err := c.Get("a", &s)
+	assert.NoError(t, err)
+	assert.False(t, found, "Empty cache should not find anything.")
+
+	assert.NoError(t, c.Set("a", session{NS: "a", Route: "jenkins-a"}))
+	found, err = c.Get("a", &s)
+	assert.NoError(t, err)
+	assert.True(t, found, "a should be cached.")
+	assert.Equal(t, session{NS: "a", Route: "jenkins-a"}, s)
+
+	assert.NoError(t, c.Delete("a"))
+	found, _ = c.Get("a", &s)
+	assert.False(t, found, "a should have been deleted.")
+}
+
+func Test_memory_cache_entries_expire(t *testing.T) {
+	c := NewMemory(10*time.Millisecond, time.Millisecond)
+	assert.NoError(t, c.Set("a", true))
+
+	time.Sleep(20 * time.Millisecond)
+
+	var forwarded bool
+	found, _ := c.Get("a", &forwarded)
+	assert.False(t, found, "a should have expired.")
+}
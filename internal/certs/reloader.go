@@ -0,0 +1,156 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+var logger = log.WithFields(log.Fields{"component": "certs"})
+
+// Reloader serves a TLS certificate and optionally verifies client certificates, reading
+// both again from their files whenever these change, so that renewed certificates are
+// served without restart.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	lock      sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewReloader creates a reloader of the certificate and key in the given files. Client
+// certificates are required and verified with the CAs in clientCAFile, unless it is empty.
+func NewReloader(certFile string, keyFile string, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, its key and the client CAs again. On error the previous
+// ones are kept.
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load certificate %s: %s", r.certFile, err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := ioutil.ReadFile(r.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("could not load client CAs %s: %s", r.clientCAFile, err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no client CA found in %s", r.clientCAFile)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	return nil
+}
+
+// TLSConfig returns the TLS configuration of a server, which always uses the last loaded
+// certificate and client CAs. Servers may change the configuration, e.g. to offer HTTP/2.
+func (r *Reloader) TLSConfig() *tls.Config {
+	config := &tls.Config{GetCertificate: r.getCertificate}
+	if r.clientCAFile != "" {
+		// ClientCAs would be fixed once the server uses the configuration, so client
+		// certificates are verified against the last loaded CAs by verifyClient instead
+		config.ClientAuth = tls.RequireAnyClientCert
+		config.VerifyPeerCertificate = r.verifyClient
+	}
+	return config
+}
+
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+// verifyClient verifies the certificate chain sent by a client against the client CAs.
+func (r *Reloader) verifyClient(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	r.lock.RLock()
+	clientCAs := r.clientCAs
+	r.lock.RUnlock()
+
+	var certs []*x509.Certificate
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("could not parse client certificate: %s", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("client sent no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err
+}
+
+// Watch reloads the certificate, its key and the client CAs whenever one of their files
+// changes, until the context is cancelled.
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// The directories are watched, as secrets replace files by swapping a symlink
+	dirs := map[string]bool{}
+	for _, file := range []string{r.certFile, r.keyFile, r.clientCAFile} {
+		if file == "" || dirs[filepath.Dir(file)] {
+			continue
+		}
+		dirs[filepath.Dir(file)] = true
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-watcher.Events:
+			if err := r.Reload(); err != nil {
+				logger.WithField("error", err).Error("Could not reload certificate, serving the previous one")
+				continue
+			}
+			logger.WithField("cert", r.certFile).Info("Reloaded certificate")
+		case err := <-watcher.Errors:
+			logger.WithField("error", err).Errorf("Failure watching certificate %s", r.certFile)
+		}
+	}
+}
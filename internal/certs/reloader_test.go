@@ -0,0 +1,181 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate for localhost with the given serial number
+// and its key to dir, returning the paths of both.
+func writeCert(t *testing.T, dir string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+// servedSerial returns the serial number of the certificate served by the server.
+// The server name is sent, as httptest serves its own certificate to clients without.
+func servedSerial(t *testing.T, url string, cert *tls.Certificate) int64 {
+	config := &tls.Config{InsecureSkipVerify: true, ServerName: "localhost"}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+}
+
+func newTLSServer(r *Reloader) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = r.TLSConfig()
+	ts.StartTLS()
+	return ts
+}
+
+func TestCertificateIsReloadedOnChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, 1)
+	r, err := NewReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+	ts := newTLSServer(r)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx)
+
+	assert.Equal(t, int64(1), servedSerial(t, ts.URL, nil))
+
+	// give the watcher time to start before changing the certificate
+	time.Sleep(100 * time.Millisecond)
+	writeCert(t, dir, 2)
+	for i := 0; i < 50 && servedSerial(t, ts.URL, nil) != 2; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.Equal(t, int64(2), servedSerial(t, ts.URL, nil), "Changed certificate should have been served")
+}
+
+func TestInvalidCertificateKeepsPrevious(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, 1)
+	r, err := NewReloader(certFile, keyFile, "")
+	require.NoError(t, err)
+	ts := newTLSServer(r)
+	defer ts.Close()
+
+	require.NoError(t, ioutil.WriteFile(certFile, []byte("garbage"), 0600))
+	assert.Error(t, r.Reload())
+	assert.Equal(t, int64(1), servedSerial(t, ts.URL, nil), "Previous certificate should still be served")
+
+	_, err = NewReloader(certFile, keyFile, "")
+	assert.Error(t, err, "Invalid certificate should be rejected")
+}
+
+func TestClientCertificateIsRequired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, 1)
+	clientDir := filepath.Join(dir, "client")
+	require.NoError(t, os.Mkdir(clientDir, 0700))
+	clientCertFile, clientKeyFile := writeCert(t, clientDir, 3)
+
+	r, err := NewReloader(certFile, keyFile, clientCertFile)
+	require.NoError(t, err)
+	ts := newTLSServer(r)
+	defer ts.Close()
+
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), servedSerial(t, ts.URL, &clientCert))
+	assert.Equal(t, int64(0), servedSerial(t, ts.URL, nil), "Client without certificate should be rejected")
+
+	serverCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), servedSerial(t, ts.URL, &serverCert), "Client with untrusted certificate should be rejected")
+}
+
+func TestHTTP2IsNegotiated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, 1)
+	for _, clientCAFile := range []string{"", certFile} {
+		r, err := NewReloader(certFile, keyFile, clientCAFile)
+		require.NoError(t, err)
+
+		// like http.Server, offer HTTP/2 on a clone of the configuration
+		config := r.TLSConfig().Clone()
+		config.NextProtos = []string{"h2", "http/1.1"}
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+		require.NoError(t, err)
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}
+		}()
+
+		clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		require.NoError(t, err)
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       []tls.Certificate{clientCert},
+			NextProtos:         []string{"h2", "http/1.1"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "h2", conn.ConnectionState().NegotiatedProtocol, "HTTP/2 should be negotiated with client CAs %q", clientCAFile)
+		conn.Close()
+		listener.Close()
+	}
+}
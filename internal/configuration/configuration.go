@@ -2,6 +2,53 @@ package configuration
 
 import "time"
 
+const (
+	// StoragePostgres stores in the Postgres database
+	StoragePostgres = "postgres"
+	// StorageMemory stores in memory, nothing survives a restart
+	StorageMemory = "memory"
+	// StorageFile stores in memory and writes everything to a file after every change
+	StorageFile = "file"
+
+	// CacheMemory caches in the process
+	CacheMemory = "memory"
+	// CacheLRU caches in the process, evicting the least recently used entries beyond the cache size
+	CacheLRU = "lru"
+	// CachePostgres caches in the Postgres database, sharing entries between replicas
+	CachePostgres = "postgres"
+
+	// TracingNone exports no traces
+	TracingNone = "none"
+	// TracingStdout writes spans to stdout
+	TracingStdout = "stdout"
+	// TracingFile appends spans to a file
+	TracingFile = "file"
+	// TracingOTLP sends spans to an OpenTelemetry collector over OTLP/HTTP
+	TracingOTLP = "otlp"
+)
+
+// Listener is where a server of the proxy listens and how it serves TLS.
+type Listener struct {
+	// Address is the host:port listened on, empty if the server is disabled
+	Address string
+	// CertFile and KeyFile hold the TLS certificate and its key, both empty to serve plain HTTP
+	CertFile string
+	KeyFile  string
+	// ClientCAFile holds the CAs which client certificates are verified with, empty to accept clients
+	// without certificate
+	ClientCAFile string
+}
+
+// Enabled returns whether the server listens at all.
+func (l Listener) Enabled() bool {
+	return l.Address != ""
+}
+
+// TLS returns whether the server serves TLS.
+func (l Listener) TLS() bool {
+	return l.CertFile != ""
+}
+
 // Configuration declares methods to get configuration of the proxy.
 type Configuration interface {
 	// GetPostgresHost returns the postgres host as set via default, config file, or environment variable
@@ -71,6 +118,135 @@ type Configuration interface {
 	// GetAllowedOrigins returns string containing allowed origins separated with ", "
 	GetAllowedOrigins() []string
 
+	// GetWebhookSecret returns the secret used to verify signatures of webhooks for which no codebase specific
+	// secret is configured. An empty secret disables the verification.
+	GetWebhookSecret() string
+
+	// GetWebhookSecrets returns the webhook secrets keyed by repository clone URL
+	GetWebhookSecrets() map[string]string
+
+	// GetWebhookEventPolicy returns the outcome (unidle, forward or drop) of webhook events keyed by event name
+	GetWebhookEventPolicy() map[string]string
+
+	// GetWebhookEventActions returns the actions, separated by |, for which an event may unidle Jenkins
+	GetWebhookEventActions() map[string]string
+
+	// GetWebhookBranches returns the branch patterns for which an event may unidle Jenkins
+	GetWebhookBranches() []string
+
+	// GetWebhookDeliveryWindow returns for how long IDs of forwarded webhook deliveries are remembered
+	GetWebhookDeliveryWindow() time.Duration
+
+	// GetReplayWorkers returns the number of namespaces whose buffered requests are replayed concurrently
+	GetReplayWorkers() int
+
+	// GetReplayInterval returns how long to wait between two checks for buffered requests
+	GetReplayInterval() time.Duration
+
+	// GetReplayWatchInterval returns how often the Jenkins state of namespaces with buffered requests is checked
+	GetReplayWatchInterval() time.Duration
+
+	// GetReplayBackoff returns how long to wait before replaying a request again after its first failed replay
+	GetReplayBackoff() time.Duration
+
+	// GetReplayMaxBackoff returns the longest wait before replaying a failed request again
+	GetReplayMaxBackoff() time.Duration
+
+	// GetReplayLease returns how long the buffered requests of a namespace are leased to the replica
+	// replaying them, other replicas replay them once the lease expired
+	GetReplayLease() time.Duration
+
+	// GetAPIAuthEnabled returns whether requests to the API router need a bearer token
+	GetAPIAuthEnabled() bool
+
+	// GetAPIServiceAccounts returns the subjects of the service accounts allowed to use the whole API router
+	GetAPIServiceAccounts() []string
+
+	// GetStorageBackend returns where buffered requests and statistics are stored, one of
+	// StoragePostgres, StorageMemory or StorageFile
+	GetStorageBackend() string
+
+	// GetStorageFile returns the file of the StorageFile backend
+	GetStorageFile() string
+
+	// GetRetentionInterval returns how often rows which outlived their retention are purged
+	GetRetentionInterval() time.Duration
+
+	// GetRequestMaxAge returns how long buffered requests and dead letters are kept, 0 keeps them forever
+	GetRequestMaxAge() time.Duration
+
+	// GetStatisticsMaxAge returns how long the statistics of inactive namespaces are kept, 0 keeps them forever
+	GetStatisticsMaxAge() time.Duration
+
+	// GetEncryptionKeys returns the base64 encoded 256 bit keys encrypting buffered requests, keyed by key ID
+	GetEncryptionKeys() map[string]string
+
+	// GetEncryptionKeyID returns the ID of the key encrypting newly buffered requests, empty if they are not encrypted
+	GetEncryptionKeyID() string
+
+	// GetLogLevel returns the level of the log, one of debug, info, warning or error
+	GetLogLevel() string
+
+	// GetLogRedactedHeaders returns the headers whose values are redacted in logs
+	GetLogRedactedHeaders() []string
+
+	// GetLogRedactedCookies returns the cookies whose values are redacted in logs, a trailing * matches cookie name prefixes
+	GetLogRedactedCookies() []string
+
+	// GetLogRedactedQueryParams returns the query parameters whose values are redacted in logs
+	GetLogRedactedQueryParams() []string
+
+	// GetCacheBackend returns where sessions, tenants and webhook deliveries are cached, one of
+	// CacheMemory, CacheLRU or CachePostgres
+	GetCacheBackend() string
+
+	// GetCacheSize returns the maximum number of entries of each CacheLRU cache
+	GetCacheSize() int
+
+	// GetCacheCleanupInterval returns how often expired cache entries are removed
+	GetCacheCleanupInterval() time.Duration
+
+	// GetSessionCacheTTL returns how long Jenkins sessions and idled cookies are cached
+	GetSessionCacheTTL() time.Duration
+
+	// GetTenantCacheTTL returns how long the tenants of repositories are cached
+	GetTenantCacheTTL() time.Duration
+
+	// GetTracingExporter returns where traces are exported to, one of TracingNone,
+	// TracingStdout, TracingFile or TracingOTLP
+	GetTracingExporter() string
+
+	// GetTracingFile returns the file of the TracingFile exporter
+	GetTracingFile() string
+
+	// GetTracingEndpoint returns the URL of the OpenTelemetry collector of the TracingOTLP exporter
+	GetTracingEndpoint() string
+
+	// GetReadinessHistory returns how many time-to-ready measurements are kept per namespace
+	GetReadinessHistory() int
+
+	// GetReadinessTimeout returns how long unidled Jenkins may take to be ready before it is
+	// measured again from its next unidle
+	GetReadinessTimeout() time.Duration
+
+	// GetHealthCheckTimeout returns how long a readiness check may take before it fails
+	GetHealthCheckTimeout() time.Duration
+
+	// GetHealthCheckCacheTTL returns how long the results of readiness checks of upstream services are reused
+	GetHealthCheckCacheTTL() time.Duration
+
+	// GetProxyListener returns where the proxy serves Jenkins and webhooks
+	GetProxyListener() Listener
+
+	// GetAPIListener returns where the API router is served
+	GetAPIListener() Listener
+
+	// GetJenkinsAPIListener returns where the Jenkins API router is served
+	GetJenkinsAPIListener() Listener
+
+	// GetProfilerListener returns where the profiler is served in debug mode
+	GetProfilerListener() Listener
+
 	// String returns a string representation of the configuration
 	String() string
 }
@@ -1,7 +1,9 @@
 package configuration
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net"
 	"os"
 	"runtime"
 	"strconv"
@@ -24,6 +26,49 @@ const (
 	defaultHTTPSEnabled              = "false"
 	defaultGatewayTimeout            = "25s"
 	defaultAllowedOrigins            = "https://*openshift.io,https://localhost:*,http://localhost:*"
+	defaultWebhookSecret             = ""
+	defaultWebhookSecrets            = ""
+	defaultWebhookEventPolicy        = "push=unidle,pull_request=unidle,create=unidle,ping=drop,*=forward"
+	defaultWebhookEventActions       = "pull_request=opened|reopened|synchronize"
+	defaultWebhookBranches           = ""
+	defaultWebhookDeliveryWindow     = "1h"
+	defaultReplayWorkers             = "5"
+	defaultReplayInterval            = "30s"
+	defaultReplayWatchInterval       = "2s"
+	defaultReplayBackoff             = "10s"
+	defaultReplayMaxBackoff          = "15m"
+	defaultReplayLease               = "5m"
+	defaultAPIAuthEnabled            = "false"
+	defaultAPIServiceAccounts        = ""
+	defaultStorageBackend            = StoragePostgres
+	defaultStorageFile               = "fabric8-jenkins-proxy.db"
+	defaultRetentionInterval         = "1h"
+	defaultRequestMaxAge             = "168h"
+	defaultStatisticsMaxAge          = "2160h"
+	defaultEncryptionKeys            = ""
+	defaultEncryptionKeyID           = ""
+	defaultLogRedactedHeaders        = "Authorization,Proxy-Authorization,Set-Cookie,X-Hub-Signature,X-Gitlab-Token"
+	defaultLogRedactedCookies        = "JSESSIONID*,JenkinsIdled,remember-me"
+	defaultLogRedactedQueryParams    = "token_json,access_token,refresh_token,token"
+	defaultLogLevel                  = "info"
+	defaultCacheBackend              = CacheMemory
+	defaultCacheSize                 = "10000"
+	defaultCacheCleanupInterval      = "10m"
+	defaultSessionCacheTTL           = "15m"
+	defaultTenantCacheTTL            = "30m"
+	defaultTracingExporter           = TracingNone
+	defaultTracingFile               = "fabric8-jenkins-proxy-traces.json"
+	defaultTracingEndpoint           = "http://localhost:4318"
+	defaultReadinessHistory          = "10"
+	defaultReadinessTimeout          = "30m"
+	defaultHealthCheckTimeout        = "2s"
+	defaultHealthCheckCacheTTL       = "10s"
+	defaultProxyAddress              = ":8080"
+	defaultAPIAddress                = ":9091"
+	defaultJenkinsAPIAddress         = ":9092"
+	defaultProfilerAddress           = ":6060"
+	defaultTLSCertFile               = "server.crt"
+	defaultTLSKeyFile                = "server.key"
 )
 
 var (
@@ -33,11 +78,11 @@ var (
 
 func init() {
 	// Postgres
-	settings["GetPostgresHost"] = Setting{"JC_POSTGRES_HOST", "", []func(interface{}, string) error{util.IsNotEmpty}}
-	settings["GetPostgresPort"] = Setting{"JC_POSTGRES_PORT", "", []func(interface{}, string) error{util.IsInt}}
-	settings["GetPostgresDatabase"] = Setting{"JC_POSTGRES_DATABASE", "", []func(interface{}, string) error{util.IsNotEmpty}}
-	settings["GetPostgresUser"] = Setting{"JC_POSTGRES_USER", "", []func(interface{}, string) error{util.IsNotEmpty}}
-	settings["GetPostgresPassword"] = Setting{"JC_POSTGRES_PASSWORD", "", []func(interface{}, string) error{util.IsNotEmpty}}
+	settings["GetPostgresHost"] = Setting{"JC_POSTGRES_HOST", "", []func(interface{}, string) error{whenPostgres(util.IsNotEmpty)}}
+	settings["GetPostgresPort"] = Setting{"JC_POSTGRES_PORT", "", []func(interface{}, string) error{whenPostgres(util.IsInt)}}
+	settings["GetPostgresDatabase"] = Setting{"JC_POSTGRES_DATABASE", "", []func(interface{}, string) error{whenPostgres(util.IsNotEmpty)}}
+	settings["GetPostgresUser"] = Setting{"JC_POSTGRES_USER", "", []func(interface{}, string) error{whenPostgres(util.IsNotEmpty)}}
+	settings["GetPostgresPassword"] = Setting{"JC_POSTGRES_PASSWORD", "", []func(interface{}, string) error{whenPostgres(util.IsNotEmpty)}}
 	settings["GetPostgresSSLMode"] = Setting{"JC_POSTGRES_SSL_MODE", defaultPostgresSSLMode, []func(interface{}, string) error{}}
 	settings["GetPostgresConnectionTimeout"] = Setting{"JC_POSTGRES_CONNECTION_TIMEOUT", defaultPostgresConnectionTimeout, []func(interface{}, string) error{util.IsInt}}
 	settings["GetPostgresConnectionMaxIdle"] = Setting{"JC_POSTGRES_CONNECTION_MAX_IDLE", defaultPostgresConnectionMaxIdle, []func(interface{}, string) error{util.IsInt}}
@@ -56,8 +101,85 @@ func init() {
 	settings["GetMaxRequestRetry"] = Setting{"JC_MAX_REQUEST_RETRY", defaultMaxRequestRetry, []func(interface{}, string) error{util.IsInt}}
 	settings["GetDebugMode"] = Setting{"JC_DEBUG_MODE", defaultDebugMode, []func(interface{}, string) error{util.IsBool}}
 	settings["GetHTTPSEnabled"] = Setting{"JC_ENABLE_HTTPS", defaultHTTPSEnabled, []func(interface{}, string) error{util.IsBool}}
-	settings["GetGatewayTimeout"] = Setting{"JC_GATEWAY_TIMEOUT", defaultGatewayTimeout, []func(interface{}, string) error{util.IsDuration}}
+	settings["GetGatewayTimeout"] = Setting{"JC_GATEWAY_TIMEOUT", defaultGatewayTimeout, []func(interface{}, string) error{util.IsPositiveDuration}}
 	settings["GetAllowedOrigins"] = Setting{"JC_ALLOWED_ORIGINS", defaultAllowedOrigins, []func(interface{}, string) error{util.IsNotEmpty}}
+
+	// Webhooks
+	settings["GetWebhookSecret"] = Setting{"JC_WEBHOOK_SECRET", defaultWebhookSecret, []func(interface{}, string) error{}}
+	settings["GetWebhookSecrets"] = Setting{"JC_WEBHOOK_SECRETS", defaultWebhookSecrets, []func(interface{}, string) error{util.IsKeyValueList, isSecretList}}
+	settings["GetWebhookEventPolicy"] = Setting{"JC_WEBHOOK_EVENT_POLICY", defaultWebhookEventPolicy, []func(interface{}, string) error{util.IsKeyValueList}}
+	settings["GetWebhookEventActions"] = Setting{"JC_WEBHOOK_EVENT_ACTIONS", defaultWebhookEventActions, []func(interface{}, string) error{util.IsKeyValueList}}
+	settings["GetWebhookBranches"] = Setting{"JC_WEBHOOK_BRANCHES", defaultWebhookBranches, []func(interface{}, string) error{}}
+	settings["GetWebhookDeliveryWindow"] = Setting{"JC_WEBHOOK_DELIVERY_WINDOW", defaultWebhookDeliveryWindow, []func(interface{}, string) error{util.IsDuration}}
+
+	// Replay
+	settings["GetReplayWorkers"] = Setting{"JC_REPLAY_WORKERS", defaultReplayWorkers, []func(interface{}, string) error{util.IsInt}}
+	settings["GetReplayInterval"] = Setting{"JC_REPLAY_INTERVAL", defaultReplayInterval, []func(interface{}, string) error{util.IsPositiveDuration}}
+	settings["GetReplayWatchInterval"] = Setting{"JC_REPLAY_WATCH_INTERVAL", defaultReplayWatchInterval, []func(interface{}, string) error{util.IsPositiveDuration}}
+	settings["GetReplayBackoff"] = Setting{"JC_REPLAY_BACKOFF", defaultReplayBackoff, []func(interface{}, string) error{util.IsPositiveDuration}}
+	settings["GetReplayMaxBackoff"] = Setting{"JC_REPLAY_MAX_BACKOFF", defaultReplayMaxBackoff, []func(interface{}, string) error{util.IsPositiveDuration}}
+	settings["GetReplayLease"] = Setting{"JC_REPLAY_LEASE", defaultReplayLease, []func(interface{}, string) error{util.IsDuration}}
+
+	// API router
+	settings["GetAPIAuthEnabled"] = Setting{"JC_API_AUTH_ENABLED", defaultAPIAuthEnabled, []func(interface{}, string) error{util.IsBool}}
+	settings["GetAPIServiceAccounts"] = Setting{"JC_API_SERVICE_ACCOUNTS", defaultAPIServiceAccounts, []func(interface{}, string) error{}}
+
+	// Storage
+	settings["GetStorageBackend"] = Setting{"JC_STORAGE_BACKEND", defaultStorageBackend, []func(interface{}, string) error{isStorageBackend}}
+	settings["GetStorageFile"] = Setting{"JC_STORAGE_FILE", defaultStorageFile, []func(interface{}, string) error{util.IsNotEmpty}}
+
+	// Retention
+	settings["GetRetentionInterval"] = Setting{"JC_RETENTION_INTERVAL", defaultRetentionInterval, []func(interface{}, string) error{util.IsPositiveDuration}}
+	settings["GetRequestMaxAge"] = Setting{"JC_REQUEST_MAX_AGE", defaultRequestMaxAge, []func(interface{}, string) error{util.IsDuration}}
+	settings["GetStatisticsMaxAge"] = Setting{"JC_STATISTICS_MAX_AGE", defaultStatisticsMaxAge, []func(interface{}, string) error{util.IsDuration}}
+
+	// Encryption
+	settings["GetEncryptionKeys"] = Setting{"JC_ENCRYPTION_KEYS", defaultEncryptionKeys, []func(interface{}, string) error{util.IsKeyValueList, isEncryptionKeyList}}
+	settings["GetEncryptionKeyID"] = Setting{"JC_ENCRYPTION_KEY_ID", defaultEncryptionKeyID, []func(interface{}, string) error{isEncryptionKeyID}}
+
+	// Logging
+	settings["GetLogLevel"] = Setting{"JC_LOG_LEVEL", defaultLogLevel, []func(interface{}, string) error{isLogLevel}}
+	settings["GetLogRedactedHeaders"] = Setting{"JC_LOG_REDACTED_HEADERS", defaultLogRedactedHeaders, []func(interface{}, string) error{}}
+	settings["GetLogRedactedCookies"] = Setting{"JC_LOG_REDACTED_COOKIES", defaultLogRedactedCookies, []func(interface{}, string) error{}}
+	settings["GetLogRedactedQueryParams"] = Setting{"JC_LOG_REDACTED_QUERY_PARAMS", defaultLogRedactedQueryParams, []func(interface{}, string) error{}}
+
+	// Cache
+	settings["GetCacheBackend"] = Setting{"JC_CACHE_BACKEND", defaultCacheBackend, []func(interface{}, string) error{isCacheBackend}}
+	settings["GetCacheSize"] = Setting{"JC_CACHE_SIZE", defaultCacheSize, []func(interface{}, string) error{util.IsInt}}
+	settings["GetCacheCleanupInterval"] = Setting{"JC_CACHE_CLEANUP_INTERVAL", defaultCacheCleanupInterval, []func(interface{}, string) error{util.IsDuration}}
+	settings["GetSessionCacheTTL"] = Setting{"JC_SESSION_CACHE_TTL", defaultSessionCacheTTL, []func(interface{}, string) error{util.IsDuration}}
+	settings["GetTenantCacheTTL"] = Setting{"JC_TENANT_CACHE_TTL", defaultTenantCacheTTL, []func(interface{}, string) error{util.IsDuration}}
+
+	// Tracing
+	settings["GetTracingExporter"] = Setting{"JC_TRACING_EXPORTER", defaultTracingExporter, []func(interface{}, string) error{isTracingExporter}}
+	settings["GetTracingFile"] = Setting{"JC_TRACING_FILE", defaultTracingFile, []func(interface{}, string) error{util.IsNotEmpty}}
+	settings["GetTracingEndpoint"] = Setting{"JC_TRACING_ENDPOINT", defaultTracingEndpoint, []func(interface{}, string) error{util.IsURL}}
+
+	// Readiness
+	settings["GetReadinessHistory"] = Setting{"JC_READINESS_HISTORY", defaultReadinessHistory, []func(interface{}, string) error{util.IsInt}}
+	settings["GetReadinessTimeout"] = Setting{"JC_READINESS_TIMEOUT", defaultReadinessTimeout, []func(interface{}, string) error{util.IsDuration}}
+
+	// Health checks
+	settings["GetHealthCheckTimeout"] = Setting{"JC_HEALTH_CHECK_TIMEOUT", defaultHealthCheckTimeout, []func(interface{}, string) error{util.IsPositiveDuration}}
+	settings["GetHealthCheckCacheTTL"] = Setting{"JC_HEALTH_CHECK_CACHE_TTL", defaultHealthCheckCacheTTL, []func(interface{}, string) error{util.IsDuration}}
+
+	// Listeners
+	settings["GetProxyAddress"] = Setting{"JC_PROXY_ADDRESS", defaultProxyAddress, []func(interface{}, string) error{isAddress}}
+	settings["GetProxyTLSCert"] = Setting{"JC_PROXY_TLS_CERT", "", []func(interface{}, string) error{requires("GetProxyTLSKey")}}
+	settings["GetProxyTLSKey"] = Setting{"JC_PROXY_TLS_KEY", "", []func(interface{}, string) error{requires("GetProxyTLSCert")}}
+	settings["GetProxyTLSClientCA"] = Setting{"JC_PROXY_TLS_CLIENT_CA", "", []func(interface{}, string) error{needsTLS("GetProxyTLSCert")}}
+	settings["GetAPIAddress"] = Setting{"JC_API_ADDRESS", defaultAPIAddress, []func(interface{}, string) error{isAddress}}
+	settings["GetAPITLSCert"] = Setting{"JC_API_TLS_CERT", "", []func(interface{}, string) error{requires("GetAPITLSKey")}}
+	settings["GetAPITLSKey"] = Setting{"JC_API_TLS_KEY", "", []func(interface{}, string) error{requires("GetAPITLSCert")}}
+	settings["GetAPITLSClientCA"] = Setting{"JC_API_TLS_CLIENT_CA", "", []func(interface{}, string) error{needsTLS("GetAPITLSCert")}}
+	settings["GetJenkinsAPIAddress"] = Setting{"JC_JENKINS_API_ADDRESS", defaultJenkinsAPIAddress, []func(interface{}, string) error{isAddress}}
+	settings["GetJenkinsAPITLSCert"] = Setting{"JC_JENKINS_API_TLS_CERT", "", []func(interface{}, string) error{requires("GetJenkinsAPITLSKey")}}
+	settings["GetJenkinsAPITLSKey"] = Setting{"JC_JENKINS_API_TLS_KEY", "", []func(interface{}, string) error{requires("GetJenkinsAPITLSCert")}}
+	settings["GetJenkinsAPITLSClientCA"] = Setting{"JC_JENKINS_API_TLS_CLIENT_CA", "", []func(interface{}, string) error{needsTLS("GetJenkinsAPITLSCert")}}
+	settings["GetProfilerAddress"] = Setting{"JC_PROFILER_ADDRESS", defaultProfilerAddress, []func(interface{}, string) error{isAddress}}
+	settings["GetProfilerTLSCert"] = Setting{"JC_PROFILER_TLS_CERT", "", []func(interface{}, string) error{requires("GetProfilerTLSKey")}}
+	settings["GetProfilerTLSKey"] = Setting{"JC_PROFILER_TLS_KEY", "", []func(interface{}, string) error{requires("GetProfilerTLSCert")}}
+	settings["GetProfilerTLSClientCA"] = Setting{"JC_PROFILER_TLS_CLIENT_CA", "", []func(interface{}, string) error{needsTLS("GetProfilerTLSCert")}}
 }
 
 // Setting is an element in the proxy configuration. It contains the environment
@@ -76,6 +198,10 @@ type EnvConfig struct {
 
 // NewConfiguration creates a configuration instance.
 func NewConfiguration() (Configuration, error) {
+	if err := loadConfigFile(); err != nil {
+		return nil, err
+	}
+
 	// Check if we have all we need.
 	multiError := verifyEnv()
 	if !multiError.Empty() {
@@ -269,6 +395,380 @@ func (c *EnvConfig) GetAllowedOrigins() []string {
 	return strings.Split(value, ",")
 }
 
+// GetWebhookSecret returns the secret used to verify signatures of webhooks for which no codebase specific
+// secret is configured. An empty secret disables the verification.
+func (c *EnvConfig) GetWebhookSecret() string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return value
+}
+
+// GetWebhookSecrets returns the webhook secrets keyed by repository clone URL. They are set as comma separated
+// list of <repository clone URL>=<secret> pairs.
+func (c *EnvConfig) GetWebhookSecrets() map[string]string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return util.ParseKeyValueList(value)
+}
+
+// GetWebhookEventPolicy returns the outcome (unidle, forward or drop) of webhook events keyed by event name.
+// The key * sets the outcome of events which are not listed.
+func (c *EnvConfig) GetWebhookEventPolicy() map[string]string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return util.ParseKeyValueList(value)
+}
+
+// GetWebhookEventActions returns the actions, separated by |, for which an event may unidle Jenkins
+// keyed by event name.
+func (c *EnvConfig) GetWebhookEventActions() map[string]string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return util.ParseKeyValueList(value)
+}
+
+// GetWebhookBranches returns the branch patterns for which an event may unidle Jenkins.
+// No patterns means all branches.
+func (c *EnvConfig) GetWebhookBranches() []string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	if len(strings.TrimSpace(value)) == 0 {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// GetWebhookDeliveryWindow returns for how long IDs of forwarded webhook deliveries are remembered
+// to skip redeliveries.
+func (c *EnvConfig) GetWebhookDeliveryWindow() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetReplayWorkers returns the number of namespaces whose buffered requests are replayed concurrently.
+func (c *EnvConfig) GetReplayWorkers() int {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	i, _ := strconv.Atoi(value)
+	return i
+}
+
+// GetReplayInterval returns how long to wait between two checks for buffered requests.
+func (c *EnvConfig) GetReplayInterval() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetReplayWatchInterval returns how often the Jenkins state of namespaces with buffered requests is checked.
+func (c *EnvConfig) GetReplayWatchInterval() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetReplayBackoff returns how long to wait before replaying a request again after its first failed replay.
+func (c *EnvConfig) GetReplayBackoff() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetReplayMaxBackoff returns the longest wait before replaying a failed request again.
+func (c *EnvConfig) GetReplayMaxBackoff() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetReplayLease returns how long the buffered requests of a namespace are leased to the replica replaying them.
+func (c *EnvConfig) GetReplayLease() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetAPIAuthEnabled returns whether requests to the API router need a bearer token.
+func (c *EnvConfig) GetAPIAuthEnabled() bool {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	b, _ := strconv.ParseBool(value)
+	return b
+}
+
+// GetAPIServiceAccounts returns the subjects of the service accounts allowed to use the whole API router.
+// They are set as comma separated list.
+func (c *EnvConfig) GetAPIServiceAccounts() []string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	if len(strings.TrimSpace(value)) == 0 {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// GetStorageBackend returns where buffered requests and statistics are stored.
+func (c *EnvConfig) GetStorageBackend() string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return value
+}
+
+// GetStorageFile returns the file of the file storage backend.
+func (c *EnvConfig) GetStorageFile() string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return value
+}
+
+// GetRetentionInterval returns how often rows which outlived their retention are purged.
+func (c *EnvConfig) GetRetentionInterval() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetRequestMaxAge returns how long buffered requests and dead letters are kept, 0 keeps them forever.
+func (c *EnvConfig) GetRequestMaxAge() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetStatisticsMaxAge returns how long the statistics of inactive namespaces are kept, 0 keeps them forever.
+func (c *EnvConfig) GetStatisticsMaxAge() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetEncryptionKeys returns the base64 encoded 256 bit keys encrypting buffered requests, keyed by key ID.
+// They are set as comma separated list of id=key pairs.
+func (c *EnvConfig) GetEncryptionKeys() map[string]string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return util.ParseKeyValueList(value)
+}
+
+// GetEncryptionKeyID returns the ID of the key encrypting newly buffered requests, empty if they are not encrypted.
+func (c *EnvConfig) GetEncryptionKeyID() string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return value
+}
+
+// GetLogLevel returns the level of the log, one of debug, info, warning or error.
+func (c *EnvConfig) GetLogLevel() string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return value
+}
+
+// GetLogRedactedHeaders returns the headers whose values are redacted in logs.
+func (c *EnvConfig) GetLogRedactedHeaders() []string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	if len(strings.TrimSpace(value)) == 0 {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// GetLogRedactedCookies returns the cookies, a trailing * matches cookie name prefixes, whose values are redacted in logs.
+func (c *EnvConfig) GetLogRedactedCookies() []string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	if len(strings.TrimSpace(value)) == 0 {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// GetLogRedactedQueryParams returns the query parameters whose values are redacted in logs.
+func (c *EnvConfig) GetLogRedactedQueryParams() []string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	if len(strings.TrimSpace(value)) == 0 {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+// GetCacheBackend returns where sessions, tenants and webhook deliveries are cached.
+func (c *EnvConfig) GetCacheBackend() string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return value
+}
+
+// GetCacheSize returns the maximum number of entries of each LRU cache.
+func (c *EnvConfig) GetCacheSize() int {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	i, _ := strconv.Atoi(value)
+	return i
+}
+
+// GetCacheCleanupInterval returns how often expired cache entries are removed.
+func (c *EnvConfig) GetCacheCleanupInterval() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetSessionCacheTTL returns how long Jenkins sessions and idled cookies are cached.
+func (c *EnvConfig) GetSessionCacheTTL() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetTenantCacheTTL returns how long the tenants of repositories are cached.
+func (c *EnvConfig) GetTenantCacheTTL() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetTracingExporter returns where traces are exported to.
+func (c *EnvConfig) GetTracingExporter() string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return value
+}
+
+// GetTracingFile returns the file spans are appended to.
+func (c *EnvConfig) GetTracingFile() string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return value
+}
+
+// GetTracingEndpoint returns the URL of the OpenTelemetry collector spans are sent to.
+func (c *EnvConfig) GetTracingEndpoint() string {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	return value
+}
+
+// GetReadinessHistory returns how many time-to-ready measurements are kept per namespace.
+func (c *EnvConfig) GetReadinessHistory() int {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	i, _ := strconv.Atoi(value)
+	return i
+}
+
+// GetReadinessTimeout returns how long unidled Jenkins may take to be ready before it is measured again from its next unidle.
+func (c *EnvConfig) GetReadinessTimeout() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetHealthCheckTimeout returns how long a readiness check may take before it fails.
+func (c *EnvConfig) GetHealthCheckTimeout() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetHealthCheckCacheTTL returns how long the results of readiness checks of upstream services are reused.
+func (c *EnvConfig) GetHealthCheckCacheTTL() time.Duration {
+	callPtr, _, _, _ := runtime.Caller(0)
+	value := getConfigValueFromEnv(util.NameOfFunction(callPtr))
+
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// GetProxyListener returns where the proxy serves Jenkins and webhooks.
+func (c *EnvConfig) GetProxyListener() Listener {
+	return listener("Proxy")
+}
+
+// GetAPIListener returns where the API router is served.
+func (c *EnvConfig) GetAPIListener() Listener {
+	return listener("API")
+}
+
+// GetJenkinsAPIListener returns where the Jenkins API router is served.
+func (c *EnvConfig) GetJenkinsAPIListener() Listener {
+	return listener("JenkinsAPI")
+}
+
+// GetProfilerListener returns where the profiler is served in debug mode.
+func (c *EnvConfig) GetProfilerListener() Listener {
+	return listener("Profiler")
+}
+
+// listener returns the listener settings of the named server. Servers without a certificate
+// of their own serve the default certificate if HTTPS is enabled.
+func listener(name string) Listener {
+	l := Listener{
+		Address:      getConfigValueFromEnv("Get" + name + "Address"),
+		CertFile:     getConfigValueFromEnv("Get" + name + "TLSCert"),
+		KeyFile:      getConfigValueFromEnv("Get" + name + "TLSKey"),
+		ClientCAFile: getConfigValueFromEnv("Get" + name + "TLSClientCA"),
+	}
+	if https, _ := strconv.ParseBool(getConfigValueFromEnv("GetHTTPSEnabled")); https && l.CertFile == "" {
+		l.CertFile = defaultTLSCertFile
+		l.KeyFile = defaultTLSKeyFile
+	}
+	return l
+}
+
 func (c *EnvConfig) String() string {
 	config := map[string]interface{}{}
 	for key, setting := range settings {
@@ -280,12 +780,174 @@ func (c *EnvConfig) String() string {
 		if strings.Contains(setting.key, "PASSWORD") && len(value) > 0 {
 			value = "***"
 		}
+		if strings.Contains(setting.key, "SECRET") && len(value) > 0 {
+			value = "***"
+		}
+		if setting.key == "JC_ENCRYPTION_KEYS" && len(value) > 0 {
+			value = "***"
+		}
 		config[key] = value
 
 	}
 	return fmt.Sprintf("%v", config)
 }
 
+// isStorageBackend checks if value stored at a given key names a storage backend.
+func isStorageBackend(value interface{}, key string) error {
+	switch value {
+	case StoragePostgres, StorageMemory, StorageFile:
+		return nil
+	}
+	return fmt.Errorf("value %v of %s is not one of %s, %s or %s", value, key, StoragePostgres, StorageMemory, StorageFile)
+}
+
+// isCacheBackend checks if value stored at a given key names a cache backend.
+// The Postgres cache needs the Postgres storage backend, whose database it shares.
+func isCacheBackend(value interface{}, key string) error {
+	switch value {
+	case CacheMemory, CacheLRU:
+		return nil
+	case CachePostgres:
+		if storage := getConfigValueFromEnv("GetStorageBackend"); storage != StoragePostgres {
+			return fmt.Errorf("value %v of %s needs storage backend %s, not %s", value, key, StoragePostgres, storage)
+		}
+		return nil
+	}
+	return fmt.Errorf("value %v of %s is not one of %s, %s or %s", value, key, CacheMemory, CacheLRU, CachePostgres)
+}
+
+// isTracingExporter checks if value stored at a given key names a trace exporter.
+func isTracingExporter(value interface{}, key string) error {
+	switch value {
+	case TracingNone, TracingStdout, TracingFile, TracingOTLP:
+		return nil
+	}
+	return fmt.Errorf("value %v of %s is not one of %s, %s, %s or %s", value, key, TracingNone, TracingStdout, TracingFile, TracingOTLP)
+}
+
+// isLogLevel checks if value stored at a given key names a log level.
+// An empty value keeps the info level.
+func isLogLevel(value interface{}, key string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := log.ParseLevel(value.(string)); err != nil {
+		return fmt.Errorf("value %v of %s is not one of debug, info, warning or error", value, key)
+	}
+	return nil
+}
+
+// isSecretList checks if no value of the key=value list stored at a given key is empty, as an empty
+// secret would disable the verification it is configured for.
+func isSecretList(value interface{}, key string) error {
+	for name, secret := range util.ParseKeyValueList(value.(string)) {
+		if secret == "" {
+			return fmt.Errorf("value of key %s in %s cannot be empty", name, key)
+		}
+	}
+	return nil
+}
+
+// isEncryptionKeyList checks if all keys of the key=value list stored at a given key are base64 encoded 256 bit keys.
+func isEncryptionKeyList(value interface{}, key string) error {
+	for id, encoded := range util.ParseKeyValueList(value.(string)) {
+		k, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(k) != 32 {
+			return fmt.Errorf("value of key %s in %s needs to be a base64 encoded 256 bit key", id, key)
+		}
+	}
+	return nil
+}
+
+// isEncryptionKeyID checks if value stored at a given key is the ID of a configured encryption key.
+// It has to be set if encryption keys are configured.
+func isEncryptionKeyID(value interface{}, key string) error {
+	keys := util.ParseKeyValueList(getConfigValueFromEnv("GetEncryptionKeys"))
+	id := value.(string)
+	if id == "" {
+		if len(keys) > 0 {
+			return fmt.Errorf("value for %s needs to be set if encryption keys are configured", key)
+		}
+		return nil
+	}
+	if _, ok := keys[id]; !ok {
+		return fmt.Errorf("value %s of %s is not the ID of a configured encryption key", id, key)
+	}
+	return nil
+}
+
+// isAddress checks if value stored at a given key is a host:port address to listen on.
+// An empty value disables the listener.
+func isAddress(value interface{}, key string) error {
+	address := value.(string)
+	if address == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return fmt.Errorf("value %s of %s is not a host:port address", address, key)
+	}
+	return nil
+}
+
+// requires returns a validation which fails if a value is set, but not the value of the named setting.
+func requires(funcName string) func(interface{}, string) error {
+	return func(value interface{}, key string) error {
+		if value != "" && getConfigValueFromEnv(funcName) == "" {
+			return fmt.Errorf("value for %s needs %s to be set as well", key, settings[funcName].key)
+		}
+		return nil
+	}
+}
+
+// needsTLS returns a validation which fails if a value is set, but the listener of the named
+// certificate setting does not serve TLS.
+func needsTLS(certFuncName string) func(interface{}, string) error {
+	return func(value interface{}, key string) error {
+		if value == "" || getConfigValueFromEnv(certFuncName) != "" {
+			return nil
+		}
+		if https, _ := strconv.ParseBool(getConfigValueFromEnv("GetHTTPSEnabled")); !https {
+			return fmt.Errorf("value for %s needs %s to be set or HTTPS to be enabled", key, settings[certFuncName].key)
+		}
+		return nil
+	}
+}
+
+// whenPostgres applies a validation only if the Postgres storage backend is selected.
+func whenPostgres(validate func(interface{}, string) error) func(interface{}, string) error {
+	return func(value interface{}, key string) error {
+		if getConfigValueFromEnv("GetStorageBackend") != StoragePostgres {
+			return nil
+		}
+		return validate(value, key)
+	}
+}
+
+// crossChecks validate settings against each other. They get the value of a setting by the
+// name of its getter.
+var crossChecks = []func(value func(funcName string) string) error{
+	notLongerThan("GetReplayBackoff", "GetReplayMaxBackoff"),
+}
+
+// notLongerThan returns a check which fails if the duration of a setting is longer than the one
+// of another setting. Invalid durations are left to the validations of the settings.
+func notLongerThan(funcName string, maxFuncName string) func(func(string) string) error {
+	return func(value func(string) string) error {
+		d, err := time.ParseDuration(value(funcName))
+		if err != nil {
+			return nil
+		}
+		max, err := time.ParseDuration(value(maxFuncName))
+		if err != nil {
+			return nil
+		}
+		if d > max {
+			return fmt.Errorf("value for %s must not be longer than %s", settings[funcName].key, settings[maxFuncName].key)
+		}
+		return nil
+	}
+}
+
 // Verify checks whether all needed config options are set.
 func verifyEnv() util.MultiError {
 	var errors util.MultiError
@@ -296,14 +958,28 @@ func verifyEnv() util.MultiError {
 			errors.Collect(validateFunc(value, setting.key))
 		}
 	}
+	for _, check := range crossChecks {
+		errors.Collect(check(getConfigValueFromEnv))
+	}
 
 	return errors
 }
 
+// getConfigValueFromEnv returns the value of a setting from its environment variable,
+// falling back to the config file and then to its default.
 func getConfigValueFromEnv(funcName string) string {
+	return lookupConfigValue(funcName, fileValue)
+}
+
+// lookupConfigValue returns the value of a setting from its environment variable, falling
+// back to the given config file values and then to its default.
+func lookupConfigValue(funcName string, fileValue func(key string) (string, bool)) string {
 	setting := settings[funcName]
 
 	value, ok := os.LookupEnv(setting.key)
+	if !ok {
+		value, ok = fileValue(setting.key)
+	}
 	if !ok {
 		value = setting.defaultValue
 	}
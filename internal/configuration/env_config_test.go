@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 )
 
 func Test_without_required_parameters_new_configuration_returns_error(t *testing.T) {
@@ -44,3 +45,231 @@ func Test_setting_required_parameters_lets_you_create_configuration(t *testing.T
 	assert.NoError(t, err, "There should have been no error.")
 	assert.NotNil(t, config, "There should be a syntactically valid configuration.")
 }
+
+func Test_postgres_parameters_are_only_required_for_postgres_storage(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	os.Setenv("JC_F8TENANT_API_URL", "http://localhost:1234")
+	os.Setenv("JC_AUTH_URL", "http://localhost:1235")
+	os.Setenv("JC_WIT_API_URL", "http://localhost:1236")
+	os.Setenv("JC_IDLER_API_URL", "http://localhost:1238")
+
+	os.Setenv("JC_AUTH_TOKEN", "snafu")
+	os.Setenv("JC_REDIRECT_URL", "http://localhost")
+
+	os.Setenv("JC_STORAGE_BACKEND", "memory")
+	config, err := NewConfiguration()
+	assert.NoError(t, err, "There should have been no error.")
+	assert.Equal(t, StorageMemory, config.GetStorageBackend())
+
+	os.Setenv("JC_STORAGE_BACKEND", "postgres")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Postgres parameters should be required.")
+
+	os.Setenv("JC_STORAGE_BACKEND", "mongo")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Unknown storage backend should be rejected.")
+}
+
+func Test_encryption_keys_are_validated(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	os.Setenv("JC_F8TENANT_API_URL", "http://localhost:1234")
+	os.Setenv("JC_AUTH_URL", "http://localhost:1235")
+	os.Setenv("JC_WIT_API_URL", "http://localhost:1236")
+	os.Setenv("JC_IDLER_API_URL", "http://localhost:1238")
+
+	os.Setenv("JC_AUTH_TOKEN", "snafu")
+	os.Setenv("JC_REDIRECT_URL", "http://localhost")
+	os.Setenv("JC_STORAGE_BACKEND", "memory")
+
+	// 32 bytes, base64 encoded
+	key := "MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE="
+	os.Setenv("JC_ENCRYPTION_KEYS", "2018-01="+key+",2018-02="+key)
+	os.Setenv("JC_ENCRYPTION_KEY_ID", "2018-02")
+	config, err := NewConfiguration()
+	assert.NoError(t, err, "There should have been no error.")
+	assert.Equal(t, map[string]string{"2018-01": key, "2018-02": key}, config.GetEncryptionKeys())
+	assert.Equal(t, "2018-02", config.GetEncryptionKeyID())
+	assert.NotContains(t, config.String(), key, "Encryption keys should not be echoed.")
+
+	os.Setenv("JC_ENCRYPTION_KEY_ID", "2018-03")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Unknown key ID should be rejected.")
+
+	os.Setenv("JC_ENCRYPTION_KEY_ID", "")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Key ID should be required if keys are configured.")
+
+	os.Setenv("JC_ENCRYPTION_KEYS", "2018-01=c2hvcnQ=")
+	os.Setenv("JC_ENCRYPTION_KEY_ID", "2018-01")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Short key should be rejected.")
+}
+
+func Test_postgres_cache_needs_postgres_storage(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	os.Setenv("JC_F8TENANT_API_URL", "http://localhost:1234")
+	os.Setenv("JC_AUTH_URL", "http://localhost:1235")
+	os.Setenv("JC_WIT_API_URL", "http://localhost:1236")
+	os.Setenv("JC_IDLER_API_URL", "http://localhost:1238")
+
+	os.Setenv("JC_AUTH_TOKEN", "snafu")
+	os.Setenv("JC_REDIRECT_URL", "http://localhost")
+	os.Setenv("JC_STORAGE_BACKEND", "memory")
+
+	os.Setenv("JC_CACHE_BACKEND", "lru")
+	os.Setenv("JC_SESSION_CACHE_TTL", "5m")
+	config, err := NewConfiguration()
+	assert.NoError(t, err, "There should have been no error.")
+	assert.Equal(t, CacheLRU, config.GetCacheBackend())
+	assert.Equal(t, 5*time.Minute, config.GetSessionCacheTTL())
+	assert.Equal(t, 30*time.Minute, config.GetTenantCacheTTL(), "Tenant cache TTL should default to 30m.")
+
+	os.Setenv("JC_CACHE_BACKEND", "postgres")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Postgres cache should need Postgres storage.")
+
+	os.Setenv("JC_CACHE_BACKEND", "redis")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Unknown cache backend should be rejected.")
+}
+
+func Test_tracing_exporter_is_validated(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	os.Setenv("JC_F8TENANT_API_URL", "http://localhost:1234")
+	os.Setenv("JC_AUTH_URL", "http://localhost:1235")
+	os.Setenv("JC_WIT_API_URL", "http://localhost:1236")
+	os.Setenv("JC_IDLER_API_URL", "http://localhost:1238")
+
+	os.Setenv("JC_AUTH_TOKEN", "snafu")
+	os.Setenv("JC_REDIRECT_URL", "http://localhost")
+	os.Setenv("JC_STORAGE_BACKEND", "memory")
+
+	config, err := NewConfiguration()
+	assert.NoError(t, err, "There should have been no error.")
+	assert.Equal(t, TracingNone, config.GetTracingExporter(), "Tracing should be disabled by default.")
+
+	os.Setenv("JC_TRACING_EXPORTER", "otlp")
+	os.Setenv("JC_TRACING_ENDPOINT", "http://collector:4318")
+	config, err = NewConfiguration()
+	assert.NoError(t, err, "There should have been no error.")
+	assert.Equal(t, TracingOTLP, config.GetTracingExporter())
+	assert.Equal(t, "http://collector:4318", config.GetTracingEndpoint())
+
+	os.Setenv("JC_TRACING_EXPORTER", "zipkin")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Unknown trace exporter should be rejected.")
+}
+
+func Test_listeners_are_validated(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	os.Setenv("JC_F8TENANT_API_URL", "http://localhost:1234")
+	os.Setenv("JC_AUTH_URL", "http://localhost:1235")
+	os.Setenv("JC_WIT_API_URL", "http://localhost:1236")
+	os.Setenv("JC_IDLER_API_URL", "http://localhost:1238")
+
+	os.Setenv("JC_AUTH_TOKEN", "snafu")
+	os.Setenv("JC_REDIRECT_URL", "http://localhost")
+	os.Setenv("JC_STORAGE_BACKEND", "memory")
+
+	os.Setenv("JC_PROXY_ADDRESS", "127.0.0.1:8443")
+	os.Setenv("JC_PROXY_TLS_CERT", "/etc/tls/tls.crt")
+	os.Setenv("JC_PROXY_TLS_KEY", "/etc/tls/tls.key")
+	os.Setenv("JC_PROXY_TLS_CLIENT_CA", "/etc/tls/ca.crt")
+	os.Setenv("JC_PROFILER_ADDRESS", "")
+	config, err := NewConfiguration()
+	assert.NoError(t, err, "There should have been no error.")
+	assert.Equal(t, Listener{Address: "127.0.0.1:8443", CertFile: "/etc/tls/tls.crt", KeyFile: "/etc/tls/tls.key", ClientCAFile: "/etc/tls/ca.crt"}, config.GetProxyListener())
+	assert.Equal(t, Listener{Address: ":9091"}, config.GetAPIListener(), "Listener should default to plain HTTP.")
+	assert.False(t, config.GetProfilerListener().Enabled(), "Empty address should disable the listener.")
+
+	os.Setenv("JC_ENABLE_HTTPS", "true")
+	config, err = NewConfiguration()
+	assert.NoError(t, err, "There should have been no error.")
+	assert.Equal(t, Listener{Address: ":9092", CertFile: "server.crt", KeyFile: "server.key"}, config.GetJenkinsAPIListener(),
+		"Listener without certificate should serve the default certificate if HTTPS is enabled.")
+	assert.Equal(t, "/etc/tls/tls.crt", config.GetProxyListener().CertFile)
+
+	os.Setenv("JC_ENABLE_HTTPS", "false")
+	os.Setenv("JC_API_TLS_CLIENT_CA", "/etc/tls/ca.crt")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Client CA should need TLS.")
+
+	os.Unsetenv("JC_API_TLS_CLIENT_CA")
+	os.Unsetenv("JC_PROXY_TLS_KEY")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Certificate should need a key.")
+
+	os.Setenv("JC_PROXY_TLS_KEY", "/etc/tls/tls.key")
+	os.Setenv("JC_API_ADDRESS", "9091")
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Address without port should be rejected.")
+}
+
+func Test_intervals_need_to_be_positive(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	setRequiredEnv()
+	for _, key := range []string{"JC_REPLAY_INTERVAL", "JC_REPLAY_WATCH_INTERVAL", "JC_RETENTION_INTERVAL", "JC_HEALTH_CHECK_TIMEOUT"} {
+		os.Setenv(key, "0s")
+		_, err := NewConfiguration()
+		assert.Error(t, err, "Zero %s should be rejected.", key)
+		os.Unsetenv(key)
+	}
+}
+
+func Test_webhook_secrets_cannot_be_empty(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	setRequiredEnv()
+	os.Setenv("JC_WEBHOOK_SECRET", "global")
+	os.Setenv("JC_WEBHOOK_SECRETS", "https://github.com/foo/bar.git=")
+	_, err := NewConfiguration()
+	assert.Error(t, err, "An empty codebase secret should be rejected.")
+
+	os.Setenv("JC_WEBHOOK_SECRETS", "https://github.com/foo/bar.git=s1")
+	config, err := NewConfiguration()
+	assert.NoError(t, err, "There should have been no error.")
+	assert.Equal(t, map[string]string{"https://github.com/foo/bar.git": "s1"}, config.GetWebhookSecrets())
+}
+
+func Test_replay_backoff_cannot_exceed_max_backoff(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	setRequiredEnv()
+	os.Setenv("JC_REPLAY_BACKOFF", "20m")
+	_, err := NewConfiguration()
+	assert.Error(t, err, "Backoff longer than the default max backoff should be rejected.")
+
+	os.Setenv("JC_REPLAY_MAX_BACKOFF", "20m")
+	_, err = NewConfiguration()
+	assert.NoError(t, err, "Backoff as long as the max backoff should be accepted.")
+}
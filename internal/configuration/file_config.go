@@ -0,0 +1,246 @@
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFileEnv is the environment variable holding the path of the optional config file.
+const ConfigFileEnv = "JC_CONFIG_FILE"
+
+// envPrefix is the prefix of the environment variables of all settings
+const envPrefix = "JC_"
+
+var (
+	// fileValues holds the settings read from the config file, keyed by environment variable
+	fileValues     = map[string]string{}
+	fileValuesLock sync.RWMutex
+
+	// reloadable are the settings which are read again while the proxy runs, so that their
+	// changes in the config file take effect without restart
+	reloadable = map[string]bool{
+		"GetGatewayTimeout":   true,
+		"GetMaxRequestRetry":  true,
+		"GetReplayInterval":   true,
+		"GetReplayBackoff":    true,
+		"GetReplayMaxBackoff": true,
+		"GetAllowedOrigins":   true,
+		"GetLogLevel":         true,
+	}
+)
+
+// fileValue returns the value of the setting with the given environment variable in the config file.
+func fileValue(key string) (string, bool) {
+	fileValuesLock.RLock()
+	defer fileValuesLock.RUnlock()
+	value, ok := fileValues[key]
+	return value, ok
+}
+
+func setFileValues(values map[string]string) {
+	fileValuesLock.Lock()
+	defer fileValuesLock.Unlock()
+	fileValues = values
+}
+
+// copyFileValues returns a copy of the settings read from the config file.
+func copyFileValues() map[string]string {
+	fileValuesLock.RLock()
+	defer fileValuesLock.RUnlock()
+	values := make(map[string]string, len(fileValues))
+	for key, value := range fileValues {
+		values[key] = value
+	}
+	return values
+}
+
+// readConfigFile reads the settings of a YAML or JSON config file. Settings are named like their
+// environment variables, the JC_ prefix may be left out and case does not matter, e.g.
+// gateway_timeout sets JC_GATEWAY_TIMEOUT. Lists are joined by commas and maps become key=value lists.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %s", path, err)
+	}
+
+	known := make(map[string]bool, len(settings))
+	for _, setting := range settings {
+		known[setting.key] = true
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		key := strings.ToUpper(name)
+		if !strings.HasPrefix(key, envPrefix) {
+			key = envPrefix + key
+		}
+		if !known[key] {
+			return nil, fmt.Errorf("unknown setting %s in config file %s", name, path)
+		}
+		values[key] = formatFileValue(value)
+	}
+	return values, nil
+}
+
+// formatFileValue formats a value of the config file like the value of an environment variable.
+func formatFileValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, formatFileValue(item))
+		}
+		return strings.Join(items, ",")
+	case map[interface{}]interface{}:
+		pairs := make([]string, 0, len(v))
+		for k, item := range v {
+			pairs = append(pairs, fmt.Sprintf("%v=%s", k, formatFileValue(item)))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// loadConfigFile reads the config file named by JC_CONFIG_FILE, if it is set, so that its
+// settings apply where no environment variable is set.
+func loadConfigFile() error {
+	path := os.Getenv(ConfigFileEnv)
+	if path == "" {
+		setFileValues(map[string]string{})
+		return nil
+	}
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	setFileValues(values)
+	logger.Infof("Read %d settings from config file %s", len(values), path)
+	return nil
+}
+
+// WatchConfigFile reads the config file again whenever it changes, until the context is cancelled.
+// Changes of reloadable settings are applied and onReload is called with their environment variables,
+// changes of other settings are logged and take effect on restart. If the changed file is invalid,
+// the previous settings are kept. Nothing is watched unless JC_CONFIG_FILE is set.
+func WatchConfigFile(ctx context.Context, onReload func(changed []string)) error {
+	path := os.Getenv(ConfigFileEnv)
+	if path == "" {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	// The directory is watched, as config maps replace files by swapping a symlink
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+	logger.Infof("Watching config file %s", path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-watcher.Events:
+			changed, err := reloadConfigFile(path)
+			if err != nil {
+				logger.WithField("error", err).Errorf("Could not reload config file %s, keeping the previous settings", path)
+				continue
+			}
+			if len(changed) > 0 {
+				onReload(changed)
+			}
+		case err := <-watcher.Errors:
+			logger.WithField("error", err).Errorf("Failure watching config file %s", path)
+		}
+	}
+}
+
+// reloadConfigFile reads the config file again and applies the changes of reloadable settings.
+// It returns the environment variables of the settings whose value changed. The changes are
+// validated before they are applied, without holding fileValuesLock, as validations may read
+// other settings. Only the watcher of the config file reloads it, never concurrently.
+func reloadConfigFile(path string) ([]string, error) {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	current := copyFileValues()
+	next := copyFileValues()
+	var errors util.MultiError
+	var changed []string
+	for _, name := range names {
+		setting := settings[name]
+		oldValue, inOld := current[setting.key]
+		newValue, inNew := values[setting.key]
+		if inOld == inNew && oldValue == newValue {
+			continue
+		}
+		if !reloadable[name] {
+			logger.WithField("setting", setting.key).Warn("Setting changed in config file, it takes effect on restart")
+			continue
+		}
+
+		if inNew {
+			next[setting.key] = newValue
+		} else {
+			delete(next, setting.key)
+			newValue = setting.defaultValue
+		}
+		if _, ok := os.LookupEnv(setting.key); ok {
+			logger.WithField("setting", setting.key).Warn("Setting changed in config file is overridden by its environment variable")
+			continue
+		}
+		for _, validateFunc := range setting.validations {
+			errors.Collect(validateFunc(newValue, setting.key))
+		}
+		changed = append(changed, setting.key)
+	}
+	nextValue := func(key string) (string, bool) {
+		value, ok := next[key]
+		return value, ok
+	}
+	for _, check := range crossChecks {
+		errors.Collect(check(func(funcName string) string {
+			return lookupConfigValue(funcName, nextValue)
+		}))
+	}
+	if !errors.Empty() {
+		return nil, errors.ToError()
+	}
+
+	setFileValues(next)
+	for _, key := range changed {
+		value := next[key]
+		logger.WithFields(log.Fields{"setting": key, "value": value}).Info("Reloaded setting from config file")
+	}
+	return changed, nil
+}
@@ -0,0 +1,197 @@
+package configuration
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setRequiredEnv() {
+	os.Setenv("JC_F8TENANT_API_URL", "http://localhost:1234")
+	os.Setenv("JC_AUTH_URL", "http://localhost:1235")
+	os.Setenv("JC_WIT_API_URL", "http://localhost:1236")
+	os.Setenv("JC_IDLER_API_URL", "http://localhost:1238")
+
+	os.Setenv("JC_AUTH_TOKEN", "snafu")
+	os.Setenv("JC_REDIRECT_URL", "http://localhost")
+	os.Setenv("JC_STORAGE_BACKEND", "memory")
+}
+
+func writeConfigFile(t *testing.T, dir string, content string) string {
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func Test_config_file_settings_apply_unless_set_in_environment(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	setRequiredEnv()
+	os.Setenv(ConfigFileEnv, writeConfigFile(t, dir, `
+gateway_timeout: 40s
+JC_MAX_REQUEST_RETRY: 3
+allowed_origins:
+  - https://openshift.io
+  - http://localhost:*
+webhook_secrets:
+  github.com/bar: s2
+  github.com/foo: s1
+`))
+	os.Setenv("JC_MAX_REQUEST_RETRY", "5")
+
+	config, err := NewConfiguration()
+	require.NoError(t, err, "There should have been no error.")
+	assert.Equal(t, 40*time.Second, config.GetGatewayTimeout())
+	assert.Equal(t, 5, config.GetMaxRequestRetry(), "Environment should override the config file.")
+	assert.Equal(t, []string{"https://openshift.io", "http://localhost:*"}, config.GetAllowedOrigins())
+	assert.Equal(t, map[string]string{"github.com/foo": "s1", "github.com/bar": "s2"}, config.GetWebhookSecrets())
+	assert.Equal(t, 30*time.Second, config.GetReplayInterval(), "Unset settings should keep their default.")
+}
+
+func Test_invalid_config_file_is_rejected(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	setRequiredEnv()
+	os.Setenv(ConfigFileEnv, writeConfigFile(t, dir, `gateway_timout: 40s`))
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Unknown setting should be rejected.")
+
+	os.Setenv(ConfigFileEnv, writeConfigFile(t, dir, `gateway_timeout: forever`))
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Invalid value should be rejected.")
+
+	os.Setenv(ConfigFileEnv, filepath.Join(dir, "missing.yaml"))
+	_, err = NewConfiguration()
+	assert.Error(t, err, "Missing config file should be rejected.")
+}
+
+func Test_reload_applies_only_reloadable_settings(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	setRequiredEnv()
+	path := writeConfigFile(t, dir, `{"gateway_timeout": "40s", "replay_workers": 2, "replay_backoff": "5s"}`)
+	os.Setenv(ConfigFileEnv, path)
+	os.Setenv("JC_REPLAY_BACKOFF", "20s")
+
+	config, err := NewConfiguration()
+	require.NoError(t, err, "There should have been no error.")
+
+	writeConfigFile(t, dir, `{"gateway_timeout": "50s", "replay_workers": 8, "replay_backoff": "1s", "log_level": "debug"}`)
+	changed, err := reloadConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"JC_GATEWAY_TIMEOUT", "JC_LOG_LEVEL"}, changed)
+	assert.Equal(t, 50*time.Second, config.GetGatewayTimeout())
+	assert.Equal(t, "debug", config.GetLogLevel())
+	assert.Equal(t, 2, config.GetReplayWorkers(), "Setting should only change on restart.")
+	assert.Equal(t, 20*time.Second, config.GetReplayBackoff(), "Environment should override the config file.")
+
+	writeConfigFile(t, dir, `{"gateway_timeout": "forever", "replay_workers": 2}`)
+	_, err = reloadConfigFile(path)
+	assert.Error(t, err, "Invalid value should be rejected.")
+	assert.Equal(t, 50*time.Second, config.GetGatewayTimeout(), "Previous settings should be kept.")
+
+	writeConfigFile(t, dir, `{"gateway_timeout": "0s", "replay_workers": 2}`)
+	_, err = reloadConfigFile(path)
+	assert.Error(t, err, "Zero gateway timeout should be rejected.")
+
+	writeConfigFile(t, dir, `{"replay_workers": 2}`)
+	changed, err = reloadConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"JC_GATEWAY_TIMEOUT", "JC_LOG_LEVEL"}, changed)
+	assert.Equal(t, 25*time.Second, config.GetGatewayTimeout(), "Removed setting should fall back to its default.")
+}
+
+func Test_reload_checks_settings_against_each_other(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	setRequiredEnv()
+	path := writeConfigFile(t, dir, `{"replay_backoff": "5s", "replay_max_backoff": "1m"}`)
+	os.Setenv(ConfigFileEnv, path)
+
+	config, err := NewConfiguration()
+	require.NoError(t, err, "There should have been no error.")
+
+	writeConfigFile(t, dir, `{"replay_backoff": "5m", "replay_max_backoff": "1m"}`)
+	_, err = reloadConfigFile(path)
+	assert.Error(t, err, "Backoff longer than the max backoff should be rejected.")
+	assert.Equal(t, 5*time.Second, config.GetReplayBackoff(), "Previous settings should be kept.")
+
+	writeConfigFile(t, dir, `{"replay_backoff": "5m", "replay_max_backoff": "10m"}`)
+	changed, err := reloadConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"JC_REPLAY_BACKOFF", "JC_REPLAY_MAX_BACKOFF"}, changed)
+	assert.Equal(t, 5*time.Minute, config.GetReplayBackoff())
+}
+
+func Test_reload_validations_may_read_other_settings(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	os.Clearenv()
+	defer os.Clearenv()
+
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	setRequiredEnv()
+	path := writeConfigFile(t, dir, `{"log_level": "info"}`)
+	os.Setenv(ConfigFileEnv, path)
+	_, err = NewConfiguration()
+	require.NoError(t, err, "There should have been no error.")
+
+	setting := settings["GetLogLevel"]
+	defer func() { settings["GetLogLevel"] = setting }()
+	readsOthers := setting
+	readsOthers.validations = append(readsOthers.validations, func(interface{}, string) error {
+		getConfigValueFromEnv("GetGatewayTimeout")
+		return nil
+	})
+	settings["GetLogLevel"] = readsOthers
+
+	writeConfigFile(t, dir, `{"log_level": "debug"}`)
+	reloaded := make(chan error, 1)
+	go func() {
+		_, err := reloadConfigFile(path)
+		reloaded <- err
+	}()
+	select {
+	case err := <-reloaded:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reload should not block on validations reading other settings.")
+	}
+}
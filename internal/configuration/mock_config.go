@@ -1,6 +1,10 @@
 package configuration
 
-import "time"
+import (
+	"time"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
+)
 
 // Mock represents configuration required to run jenkins-proxy
 type Mock struct {
@@ -25,6 +29,47 @@ type Mock struct {
 	HTTPSEnabled              bool
 	GatewayTimeout            time.Duration
 	AllowedOrigins            []string
+	WebhookSecret             string
+	WebhookSecrets            map[string]string
+	WebhookEventPolicy        map[string]string
+	WebhookEventActions       map[string]string
+	WebhookBranches           []string
+	WebhookDeliveryWindow     time.Duration
+	ReplayWorkers             int
+	ReplayInterval            time.Duration
+	ReplayWatchInterval       time.Duration
+	ReplayBackoff             time.Duration
+	ReplayMaxBackoff          time.Duration
+	ReplayLease               time.Duration
+	APIAuthEnabled            bool
+	APIServiceAccounts        []string
+	StorageBackend            string
+	StorageFile               string
+	RetentionInterval         time.Duration
+	RequestMaxAge             time.Duration
+	StatisticsMaxAge          time.Duration
+	EncryptionKeys            map[string]string
+	EncryptionKeyID           string
+	LogLevel                  string
+	LogRedactedHeaders        []string
+	LogRedactedCookies        []string
+	LogRedactedQueryParams    []string
+	CacheBackend              string
+	CacheSize                 int
+	CacheCleanupInterval      time.Duration
+	SessionCacheTTL           time.Duration
+	TenantCacheTTL            time.Duration
+	TracingExporter           string
+	TracingFile               string
+	TracingEndpoint           string
+	ReadinessHistory          int
+	ReadinessTimeout          time.Duration
+	HealthCheckTimeout        time.Duration
+	HealthCheckCacheTTL       time.Duration
+	ProxyListener             Listener
+	APIListener               Listener
+	JenkinsAPIListener        Listener
+	ProfilerListener          Listener
 	Clusters                  map[string]string
 }
 
@@ -47,6 +92,36 @@ func NewMock() Mock {
 	c.IndexPath = "static/html/index.html"
 	c.GatewayTimeout = 25 * time.Second
 	c.AllowedOrigins = []string{"https://*openshift.io", "https://localhost:*", "http://localhost:*"}
+	c.WebhookDeliveryWindow = time.Hour
+	c.ReplayWorkers = 5
+	c.ReplayInterval = 30 * time.Second
+	c.ReplayWatchInterval = 2 * time.Second
+	c.ReplayBackoff = 10 * time.Second
+	c.ReplayMaxBackoff = 15 * time.Minute
+	c.ReplayLease = 5 * time.Minute
+	c.StorageBackend = StoragePostgres
+	c.RetentionInterval = time.Hour
+	c.RequestMaxAge = 7 * 24 * time.Hour
+	c.StatisticsMaxAge = 90 * 24 * time.Hour
+	c.LogLevel = "info"
+	c.LogRedactedHeaders = logging.DefaultRedactedHeaders
+	c.LogRedactedCookies = logging.DefaultRedactedCookies
+	c.LogRedactedQueryParams = logging.DefaultRedactedQueryParams
+	c.CacheBackend = CacheMemory
+	c.CacheSize = 10000
+	c.CacheCleanupInterval = 10 * time.Minute
+	c.SessionCacheTTL = 15 * time.Minute
+	c.TenantCacheTTL = 30 * time.Minute
+	c.TracingExporter = TracingNone
+	c.TracingEndpoint = "http://localhost:4318"
+	c.ReadinessHistory = 10
+	c.ReadinessTimeout = 30 * time.Minute
+	c.HealthCheckTimeout = 2 * time.Second
+	c.HealthCheckCacheTTL = 10 * time.Second
+	c.ProxyListener = Listener{Address: ":8080"}
+	c.APIListener = Listener{Address: ":9091"}
+	c.JenkinsAPIListener = Listener{Address: ":9092"}
+	c.ProfilerListener = Listener{Address: ":6060"}
 
 	return c
 }
@@ -158,6 +233,211 @@ func (c *Mock) GetAllowedOrigins() []string {
 	return c.AllowedOrigins
 }
 
+// GetWebhookSecret returns hardcoded global webhook secret
+func (c *Mock) GetWebhookSecret() string {
+	return c.WebhookSecret
+}
+
+// GetWebhookSecrets returns hardcoded webhook secrets keyed by repository clone URL
+func (c *Mock) GetWebhookSecrets() map[string]string {
+	return c.WebhookSecrets
+}
+
+// GetWebhookEventPolicy returns hardcoded webhook event policy
+func (c *Mock) GetWebhookEventPolicy() map[string]string {
+	return c.WebhookEventPolicy
+}
+
+// GetWebhookEventActions returns hardcoded webhook event actions
+func (c *Mock) GetWebhookEventActions() map[string]string {
+	return c.WebhookEventActions
+}
+
+// GetWebhookBranches returns hardcoded webhook branch patterns
+func (c *Mock) GetWebhookBranches() []string {
+	return c.WebhookBranches
+}
+
+// GetWebhookDeliveryWindow returns hardcoded webhook delivery window
+func (c *Mock) GetWebhookDeliveryWindow() time.Duration {
+	return c.WebhookDeliveryWindow
+}
+
+// GetReplayWorkers returns hardcoded number of replay workers
+func (c *Mock) GetReplayWorkers() int {
+	return c.ReplayWorkers
+}
+
+// GetReplayInterval returns hardcoded replay interval
+func (c *Mock) GetReplayInterval() time.Duration {
+	return c.ReplayInterval
+}
+
+// GetReplayWatchInterval returns hardcoded replay watch interval
+func (c *Mock) GetReplayWatchInterval() time.Duration {
+	return c.ReplayWatchInterval
+}
+
+// GetReplayBackoff returns hardcoded backoff after the first failed replay
+func (c *Mock) GetReplayBackoff() time.Duration {
+	return c.ReplayBackoff
+}
+
+// GetReplayMaxBackoff returns hardcoded maximum replay backoff
+func (c *Mock) GetReplayMaxBackoff() time.Duration {
+	return c.ReplayMaxBackoff
+}
+
+// GetReplayLease returns hardcoded replay lease
+func (c *Mock) GetReplayLease() time.Duration {
+	return c.ReplayLease
+}
+
+// GetAPIAuthEnabled returns hardcoded API router authentication switch
+func (c *Mock) GetAPIAuthEnabled() bool {
+	return c.APIAuthEnabled
+}
+
+// GetAPIServiceAccounts returns hardcoded API router service accounts
+func (c *Mock) GetAPIServiceAccounts() []string {
+	return c.APIServiceAccounts
+}
+
+// GetStorageBackend returns hardcoded storage backend
+func (c *Mock) GetStorageBackend() string {
+	return c.StorageBackend
+}
+
+// GetStorageFile returns hardcoded storage file
+func (c *Mock) GetStorageFile() string {
+	return c.StorageFile
+}
+
+// GetRetentionInterval returns hardcoded retention interval
+func (c *Mock) GetRetentionInterval() time.Duration {
+	return c.RetentionInterval
+}
+
+// GetRequestMaxAge returns hardcoded buffered request max age
+func (c *Mock) GetRequestMaxAge() time.Duration {
+	return c.RequestMaxAge
+}
+
+// GetStatisticsMaxAge returns hardcoded statistics max age
+func (c *Mock) GetStatisticsMaxAge() time.Duration {
+	return c.StatisticsMaxAge
+}
+
+// GetEncryptionKeys returns hardcoded encryption keys
+func (c *Mock) GetEncryptionKeys() map[string]string {
+	return c.EncryptionKeys
+}
+
+// GetEncryptionKeyID returns hardcoded ID of the current encryption key
+func (c *Mock) GetEncryptionKeyID() string {
+	return c.EncryptionKeyID
+}
+
+// GetLogLevel returns hardcoded log level
+func (c *Mock) GetLogLevel() string {
+	return c.LogLevel
+}
+
+// GetLogRedactedHeaders returns hardcoded headers redacted in logs
+func (c *Mock) GetLogRedactedHeaders() []string {
+	return c.LogRedactedHeaders
+}
+
+// GetLogRedactedCookies returns hardcoded cookies redacted in logs
+func (c *Mock) GetLogRedactedCookies() []string {
+	return c.LogRedactedCookies
+}
+
+// GetLogRedactedQueryParams returns hardcoded query parameters redacted in logs
+func (c *Mock) GetLogRedactedQueryParams() []string {
+	return c.LogRedactedQueryParams
+}
+
+// GetCacheBackend returns hardcoded cache backend
+func (c *Mock) GetCacheBackend() string {
+	return c.CacheBackend
+}
+
+// GetCacheSize returns hardcoded LRU cache size
+func (c *Mock) GetCacheSize() int {
+	return c.CacheSize
+}
+
+// GetCacheCleanupInterval returns hardcoded cache cleanup interval
+func (c *Mock) GetCacheCleanupInterval() time.Duration {
+	return c.CacheCleanupInterval
+}
+
+// GetSessionCacheTTL returns hardcoded session cache TTL
+func (c *Mock) GetSessionCacheTTL() time.Duration {
+	return c.SessionCacheTTL
+}
+
+// GetTenantCacheTTL returns hardcoded tenant cache TTL
+func (c *Mock) GetTenantCacheTTL() time.Duration {
+	return c.TenantCacheTTL
+}
+
+// GetTracingExporter returns hardcoded trace exporter
+func (c *Mock) GetTracingExporter() string {
+	return c.TracingExporter
+}
+
+// GetTracingFile returns hardcoded trace file
+func (c *Mock) GetTracingFile() string {
+	return c.TracingFile
+}
+
+// GetTracingEndpoint returns hardcoded OpenTelemetry collector URL
+func (c *Mock) GetTracingEndpoint() string {
+	return c.TracingEndpoint
+}
+
+// GetReadinessHistory returns hardcoded number of kept time-to-ready measurements
+func (c *Mock) GetReadinessHistory() int {
+	return c.ReadinessHistory
+}
+
+// GetReadinessTimeout returns hardcoded time-to-ready timeout
+func (c *Mock) GetReadinessTimeout() time.Duration {
+	return c.ReadinessTimeout
+}
+
+// GetHealthCheckTimeout returns hardcoded readiness check timeout
+func (c *Mock) GetHealthCheckTimeout() time.Duration {
+	return c.HealthCheckTimeout
+}
+
+// GetHealthCheckCacheTTL returns hardcoded TTL of cached readiness checks
+func (c *Mock) GetHealthCheckCacheTTL() time.Duration {
+	return c.HealthCheckCacheTTL
+}
+
+// GetProxyListener returns hardcoded listener of the proxy
+func (c *Mock) GetProxyListener() Listener {
+	return c.ProxyListener
+}
+
+// GetAPIListener returns hardcoded listener of the API router
+func (c *Mock) GetAPIListener() Listener {
+	return c.APIListener
+}
+
+// GetJenkinsAPIListener returns hardcoded listener of the Jenkins API router
+func (c *Mock) GetJenkinsAPIListener() Listener {
+	return c.JenkinsAPIListener
+}
+
+// GetProfilerListener returns hardcoded listener of the profiler
+func (c *Mock) GetProfilerListener() Listener {
+	return c.ProfilerListener
+}
+
 func (c *Mock) String() string {
 	return "mockConfig"
 }
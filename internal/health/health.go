@@ -0,0 +1,184 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// StatusOK reports a passing check, or that all checks pass
+	StatusOK = "ok"
+	// StatusFailed reports a failing check, or that some check fails
+	StatusFailed = "failed"
+)
+
+var logger = log.WithFields(log.Fields{"component": "health"})
+
+// Check returns an error if a dependency cannot be used. The context is cancelled once
+// the check timed out.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of a check.
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of all checks, keyed by check name.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Checker runs the checks telling whether the proxy is ready to serve requests.
+type Checker struct {
+	timeout time.Duration
+	names   []string
+	checks  map[string]Check
+}
+
+// NewChecker creates a checker failing every check which takes longer than timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+		checks:  make(map[string]Check),
+	}
+}
+
+// Add adds a check under the given name, replacing a check of the same name.
+func (c *Checker) Add(name string, check Check) {
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+		sort.Strings(c.names)
+	}
+	c.checks[name] = check
+}
+
+// Run runs all checks at once and reports their results.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+	results := make([]Result, len(c.names))
+
+	var wg sync.WaitGroup
+	for i, name := range c.names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, c.checks[name])
+	}
+	wg.Wait()
+
+	for i, name := range c.names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailed
+		}
+	}
+	return report
+}
+
+// run runs a check, giving up on it once it timed out even if it ignores its context
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", c.timeout)
+	}
+	return newResult(err, time.Since(start))
+}
+
+func newResult(err error, latency time.Duration) Result {
+	result := Result{Status: StatusOK, LatencyMS: float64(latency) / float64(time.Millisecond)}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Live reports that the proxy is alive. It runs no checks, a failing dependency
+// is no reason to restart the proxy.
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	writeReport(w, Report{Status: StatusOK})
+}
+
+// Ready runs all checks and reports their results, with status 503 if any of them fails.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	report := c.Run(r.Context())
+	if report.Status != StatusOK {
+		for name, result := range report.Checks {
+			if result.Status != StatusOK {
+				logger.WithField("check", name).Warnf("Readiness check failed: %s", result.Error)
+			}
+		}
+	}
+	writeReport(w, report)
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Cached returns a check which runs the given check at most once per ttl and reports its
+// last result in between, so that frequent probes do not flood the checked service.
+func Cached(check Check, ttl time.Duration) Check {
+	var lock sync.Mutex
+	var checked time.Time
+	var last error
+
+	return func(ctx context.Context) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if !checked.IsZero() && time.Since(checked) < ttl {
+			return last
+		}
+		last = check(ctx)
+		checked = time.Now()
+		return last
+	}
+}
+
+// Reachable returns a check which fails unless a GET of the URL is answered without a
+// server error. Client errors pass, the service is reachable even if the URL needs credentials.
+func Reachable(url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadyReportsEveryCheck(t *testing.T) {
+	c := NewChecker(50 * time.Millisecond)
+	c.Add("store", func(ctx context.Context) error { return nil })
+	c.Add("idler", func(ctx context.Context) error { return errors.New("connection refused") })
+	c.Add("tenant", func(ctx context.Context) error {
+		// ignores its context, it still has to be given up on
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	start := time.Now()
+	c.Ready(w, httptest.NewRequest("GET", "/readyz", nil), nil)
+	assert.True(t, time.Since(start) < time.Second, "Slow check should have timed out")
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var report Report
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, StatusFailed, report.Status)
+	assert.Equal(t, StatusOK, report.Checks["store"].Status)
+	assert.Equal(t, "connection refused", report.Checks["idler"].Error)
+	assert.Equal(t, StatusFailed, report.Checks["tenant"].Status)
+	assert.Contains(t, report.Checks["tenant"].Error, "timed out")
+}
+
+func TestLiveRunsNoCheck(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("store", func(ctx context.Context) error { return errors.New("down") })
+
+	w := httptest.NewRecorder()
+	c.Live(w, httptest.NewRequest("GET", "/healthz", nil), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestCachedCheckIsReused(t *testing.T) {
+	calls := 0
+	check := Cached(func(ctx context.Context) error {
+		calls++
+		return nil
+	}, 50*time.Millisecond)
+
+	assert.NoError(t, check(context.Background()))
+	assert.NoError(t, check(context.Background()))
+	assert.Equal(t, 1, calls, "Result should have been reused")
+
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, check(context.Background()))
+	assert.Equal(t, 2, calls, "Expired result should have been checked again")
+}
+
+func TestReachable(t *testing.T) {
+	status := http.StatusNotFound
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	assert.NoError(t, Reachable(ts.URL)(context.Background()), "Client error should pass")
+	status = http.StatusBadGateway
+	assert.Error(t, Reachable(ts.URL)(context.Background()))
+	assert.Error(t, Reachable("http://localhost:0/")(context.Background()))
+}
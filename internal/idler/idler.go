@@ -1,15 +1,19 @@
 package idler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tracing"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
-	uuid "github.com/satori/go.uuid"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -62,11 +66,12 @@ type StatusResponse struct {
 	Errors []ResponseError `json:"errors,omitempty"`
 }
 
-// Service provides methods to talk to the idler client
+// Service provides methods to talk to the idler client. Calls are cancelled
+// once the given context is done.
 type Service interface {
-	UnIdle(tenant string, openShiftAPIURL string) (int, error)
-	State(tenant string, openShiftAPIURL string) (PodState, error)
-	Clusters() (map[string]string, error)
+	UnIdle(ctx context.Context, tenant string, openShiftAPIURL string) (int, error)
+	State(ctx context.Context, tenant string, openShiftAPIURL string) (PodState, error)
+	Clusters(ctx context.Context) (map[string]string, error)
 }
 
 // Client is a hand-rolled Idler client using plain HTTP requests.
@@ -81,27 +86,41 @@ func New(url string) Service {
 	}
 }
 
-// Start a new request for idler and add a `Request-ID` header with a generated uuid
-func newRequest(url string) (req *http.Request, err error) {
+// Start a new request for idler and add a `Request-ID` header with the ID of the
+// request carried by the context, or a generated one if there is none. The trace
+// carried by the context is propagated as well.
+func newRequest(ctx context.Context, url string) (req *http.Request, err error) {
 	req, err = http.NewRequest("GET", url, nil)
 	if err != nil {
 		return req, err
 	}
+	req = req.WithContext(ctx)
+	tracing.Inject(req)
 
-	req.Header.Set("X-Request-ID", uuid.NewV4().String())
+	id := requestid.FromContext(ctx)
+	if id == "" {
+		id = requestid.New()
+	}
+	req.Header.Set(requestid.Header, id)
 
 	return
 }
 
 // State returns the state of Jenkins instance for the specified tenant
-func (i *Client) State(tenant string, openShiftAPIURL string) (PodState, error) {
+func (i *Client) State(ctx context.Context, tenant string, openShiftAPIURL string) (state PodState, err error) {
+	ctx, span := tracing.Start(ctx, "idler.State", tracing.Namespace(tenant), tracing.Cluster(openShiftAPIURL))
+	defer func(start time.Time) {
+		metric.DefaultRecorder().RecordUpstreamLatency(metric.UpstreamIdler, time.Since(start), err)
+		tracing.End(span, err)
+	}(time.Now())
+
 	namespace := tenant
 	if !strings.HasSuffix(tenant, namespaceSuffix) {
 		namespace = tenant + namespaceSuffix
 		log.WithField("ns", tenant).Debugf("Adding namespace suffix - resulting namespace: %s", namespace)
 	}
 
-	req, err := newRequest(fmt.Sprintf("%s/api/idler/status/%s", i.idlerAPI, namespace))
+	req, err := newRequest(ctx, fmt.Sprintf("%s/api/idler/status/%s", i.idlerAPI, namespace))
 	if err != nil {
 		return UnknownState, err
 	}
@@ -111,12 +130,13 @@ func (i *Client) State(tenant string, openShiftAPIURL string) (PodState, error)
 	req.URL.RawQuery = q.Encode()
 
 	logger := log.WithFields(log.Fields{
-		"request": logging.FormatHTTPRequestWithSeparator(req, " "),
-		"type":    "state",
+		requestid.LogField: req.Header.Get(requestid.Header),
+		"request":          logging.FormatHTTPRequestWithSeparator(req, " "),
+		"type":             "state",
 	})
 
 	// Let's set this as Debug so we are not filling up the logs
-	log.WithFields(log.Fields{"requestid": req.Header.Get("X-Request-ID"),
+	log.WithFields(log.Fields{requestid.LogField: req.Header.Get(requestid.Header),
 		"request": logging.FormatHTTPRequestWithSeparator(req, " "),
 		"type":    "state"}).Debug("Calling State API")
 
@@ -143,20 +163,27 @@ func (i *Client) State(tenant string, openShiftAPIURL string) (PodState, error)
 
 	}
 
-	state := sr.Data.State
+	state = sr.Data.State
 	logger.Debugf("Jenkins pod on %q is in %q state", namespace, state)
 
 	return state, nil
 }
 
 // UnIdle initiates un-idling of the Jenkins instance for the specified tenant.
-func (i *Client) UnIdle(tenant string, openShiftAPIURL string) (int, error) {
+func (i *Client) UnIdle(ctx context.Context, tenant string, openShiftAPIURL string) (code int, err error) {
+	ctx, span := tracing.Start(ctx, "idler.UnIdle", tracing.Namespace(tenant), tracing.Cluster(openShiftAPIURL))
+	defer func(start time.Time) {
+		metric.DefaultRecorder().RecordUpstreamLatency(metric.UpstreamIdler, time.Since(start), err)
+		metric.DefaultRecorder().RecordUnidle(openShiftAPIURL, metric.UnidleOutcome(code, err))
+		tracing.End(span, err)
+	}(time.Now())
+
 	namespace := tenant
 	if !strings.HasSuffix(tenant, namespaceSuffix) {
 		namespace = tenant + namespaceSuffix
 	}
 
-	req, err := newRequest(fmt.Sprintf("%s/api/idler/unidle/%s", i.idlerAPI, namespace))
+	req, err := newRequest(ctx, fmt.Sprintf("%s/api/idler/unidle/%s", i.idlerAPI, namespace))
 	if err != nil {
 		return 0, err
 	}
@@ -165,7 +192,7 @@ func (i *Client) UnIdle(tenant string, openShiftAPIURL string) (int, error) {
 	q.Add(OpenShiftAPIParam, util.EnsureSuffix(openShiftAPIURL, "/"))
 	req.URL.RawQuery = q.Encode()
 
-	log.WithFields(log.Fields{"requestid": req.Header.Get("X-Request-ID"),
+	log.WithFields(log.Fields{requestid.LogField: req.Header.Get(requestid.Header),
 		"request": logging.FormatHTTPRequestWithSeparator(req, " "),
 		"type":    "unidle"}).Info("Calling Idler API")
 
@@ -187,15 +214,21 @@ func (i *Client) UnIdle(tenant string, openShiftAPIURL string) (int, error) {
 
 // Clusters returns a map which maps the OpenShift API URL to the application DNS for this cluster. An empty map together with
 // an error is returned if an error occurs.
-func (i *Client) Clusters() (map[string]string, error) {
-	var clusters = make(map[string]string)
+func (i *Client) Clusters(ctx context.Context) (clusters map[string]string, err error) {
+	ctx, span := tracing.Start(ctx, "idler.Clusters")
+	defer func(start time.Time) {
+		metric.DefaultRecorder().RecordUpstreamLatency(metric.UpstreamIdler, time.Since(start), err)
+		tracing.End(span, err)
+	}(time.Now())
+
+	clusters = make(map[string]string)
 
-	req, err := newRequest(fmt.Sprintf("%s/api/idler/cluster", i.idlerAPI))
+	req, err := newRequest(ctx, fmt.Sprintf("%s/api/idler/cluster", i.idlerAPI))
 	if err != nil {
 		return clusters, err
 	}
 
-	log.WithFields(log.Fields{"requestid": req.Header.Get("X-Request-ID"),
+	log.WithFields(log.Fields{requestid.LogField: req.Header.Get(requestid.Header),
 		"request": logging.FormatHTTPRequestWithSeparator(req, " "),
 		"type":    "cluster"}).Info("Calling Idler API")
 
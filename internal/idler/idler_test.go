@@ -1,15 +1,64 @@
 package idler
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewRequest(t *testing.T) {
-	req, _ := newRequest("http://blah")
+	req, _ := newRequest(context.Background(), "http://blah")
 	assert.NotEmpty(t, req.Header.Get("X-Request-ID"), "X-Request-ID wasn't generated")
 
-	_, err := newRequest("blah://foo\\/\\/bar")
+	_, err := newRequest(context.Background(), "blah://foo\\/\\/bar")
 	assert.Error(t, err, "Should have generated a URL error")
+
+	req, _ = newRequest(requestid.NewContext(context.Background(), "abc"), "http://blah")
+	assert.Equal(t, "abc", req.Header.Get("X-Request-ID"), "X-Request-ID should be the ID of the request")
+}
+
+func TestStateIsCancelledWithContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := New(ts.URL).State(ctx, "ns", "https://api.cluster/")
+	assert.Error(t, err, "State should fail once the context is done")
+}
+
+func TestUnIdleIsRecorded(t *testing.T) {
+	defer metric.SetDefaultRecorder(metric.DefaultRecorder())
+	recorder := metric.NewMock()
+	metric.SetDefaultRecorder(recorder)
+
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL)
+	_, err := client.UnIdle(context.Background(), "ns", "https://api.cluster/")
+	assert.NoError(t, err)
+	status = http.StatusServiceUnavailable
+	_, err = client.UnIdle(context.Background(), "ns", "https://api.cluster/")
+	assert.NoError(t, err)
+	status = http.StatusInternalServerError
+	_, err = client.UnIdle(context.Background(), "ns", "https://api.cluster/")
+	assert.Error(t, err)
+
+	assert.Equal(t, float64(1), recorder.Value("unidle_calls_total", "https://api.cluster/", metric.UnidleSucceeded))
+	assert.Equal(t, float64(1), recorder.Value("unidle_calls_total", "https://api.cluster/", metric.UnidleUnavailable))
+	assert.Equal(t, float64(1), recorder.Value("unidle_calls_total", "https://api.cluster/", metric.UnidleFailed))
+	assert.Equal(t, float64(2), recorder.Value("upstream_request_duration_seconds", metric.UpstreamIdler, "success"))
+	assert.Equal(t, float64(1), recorder.Value("upstream_request_duration_seconds", metric.UpstreamIdler, "failure"))
 }
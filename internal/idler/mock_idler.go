@@ -1,6 +1,7 @@
 package idler
 
 import (
+	"context"
 	"errors"
 )
 
@@ -21,7 +22,7 @@ func NewMock(idlerAPI string, state PodState, throwError bool) (idler *Mock) {
 }
 
 // State just returns the value set in Idler.state
-func (i *Mock) State(tenant string, openShiftAPIURL string) (PodState, error) {
+func (i *Mock) State(ctx context.Context, tenant string, openShiftAPIURL string) (PodState, error) {
 	if i.throwError == true {
 		return UnknownState, errors.New("This error is invoked for mocking error scenarios")
 	}
@@ -33,13 +34,13 @@ func (i *Mock) State(tenant string, openShiftAPIURL string) (PodState, error) {
 }
 
 // UnIdle always unidles (mock)
-func (i *Mock) UnIdle(tenant string, openShiftAPIURL string) (int, error) {
+func (i *Mock) UnIdle(ctx context.Context, tenant string, openShiftAPIURL string) (int, error) {
 	return 200, nil
 }
 
 // Clusters returns a map which maps the OpenShift API URL to the application DNS for this cluster. An empty map together with
 // an error is returned if an error occurs.
-func (i *Mock) Clusters() (map[string]string, error) {
+func (i *Mock) Clusters(ctx context.Context) (map[string]string, error) {
 	clusters := map[string]string{
 		"https://api.free-stg.openshift.com/":           "1b7d.free-stg.openshiftapps.com",
 		"https://api.starter-us-east-2a.openshift.com/": "b542.starter-us-east-2a.openshiftapps.com",
@@ -0,0 +1,102 @@
+package idler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var watcherLogger = log.WithFields(log.Fields{"component": "idler-watcher"})
+
+// Watcher polls the state of Jenkins for the namespaces it watches and signals
+// as soon as one of them turns Running. A namespace is no longer watched once
+// it has been signalled.
+type Watcher struct {
+	idler    Service
+	interval time.Duration
+	running  chan string
+
+	lock    sync.Mutex
+	watched map[string]string
+}
+
+// NewWatcher creates a Watcher which checks the watched namespaces every interval.
+func NewWatcher(idler Service, interval time.Duration) *Watcher {
+	return &Watcher{
+		idler:    idler,
+		interval: interval,
+		running:  make(chan string),
+		watched:  make(map[string]string),
+	}
+}
+
+// Watch starts watching the Jenkins of a namespace on the given OpenShift cluster.
+func (w *Watcher) Watch(namespace string, openShiftAPIURL string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.watched[namespace] = openShiftAPIURL
+}
+
+// Watching returns whether a namespace is currently watched.
+func (w *Watcher) Watching(namespace string) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, ok := w.watched[namespace]
+	return ok
+}
+
+// Running returns the channel on which namespaces are signalled once their Jenkins is Running.
+func (w *Watcher) Running() <-chan string {
+	return w.running
+}
+
+// Run checks the state of the watched namespaces until the context is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for namespace, openShiftAPIURL := range w.snapshot() {
+			state, err := w.idler.State(ctx, namespace, openShiftAPIURL)
+			if err != nil {
+				watcherLogger.WithField("ns", namespace).Warnf("Could not check Jenkins state: %s", err)
+				continue
+			}
+			if state != Running {
+				continue
+			}
+
+			w.unwatch(namespace)
+			watcherLogger.WithField("ns", namespace).Info("Jenkins is running")
+			select {
+			case w.running <- namespace:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (w *Watcher) snapshot() map[string]string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	watched := make(map[string]string, len(w.watched))
+	for namespace, openShiftAPIURL := range w.watched {
+		watched[namespace] = openShiftAPIURL
+	}
+	return watched
+}
+
+func (w *Watcher) unwatch(namespace string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	delete(w.watched, namespace)
+}
@@ -0,0 +1,78 @@
+package idler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stateService reports the state set for each namespace
+type stateService struct {
+	Mock
+	lock   sync.Mutex
+	states map[string]PodState
+}
+
+func (s *stateService) State(ctx context.Context, tenant string, openShiftAPIURL string) (PodState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.states[tenant], nil
+}
+
+func (s *stateService) set(tenant string, state PodState) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.states[tenant] = state
+}
+
+func TestWatcherSignalsRunningNamespaces(t *testing.T) {
+	service := &stateService{states: map[string]PodState{"idle": Idled, "starting": Starting}}
+	w := NewWatcher(service, 10*time.Millisecond)
+	w.Watch("idle", "https://api.cluster/")
+	w.Watch("starting", "https://api.cluster/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	select {
+	case ns := <-w.Running():
+		t.Fatalf("%s should not be signalled before it is running", ns)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	service.set("starting", Running)
+	select {
+	case ns := <-w.Running():
+		assert.Equal(t, "starting", ns)
+	case <-time.After(5 * time.Second):
+		t.Fatal("running namespace should be signalled")
+	}
+	assert.False(t, w.Watching("starting"), "signalled namespace should no longer be watched")
+	assert.True(t, w.Watching("idle"), "idled namespace should still be watched")
+}
+
+func TestWatcherStopsWhenCancelled(t *testing.T) {
+	service := &stateService{states: map[string]PodState{"ns": Running}}
+	w := NewWatcher(service, 10*time.Millisecond)
+	w.Watch("ns", "https://api.cluster/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	// nobody receives the signal, so Run blocks until cancelled
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run should stop once the context is cancelled")
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tenant"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -42,8 +43,9 @@ func lookupNamespace(r *http.Request, t tenant.Service) (tenant.Namespace, error
 		return tenant.Namespace{}, err
 	}
 	accessToken := strings.Split(authHeader, " ")[1]
-	namespace, err := t.GetNamespace(accessToken)
-	log.Infof("Found token info in the query. Namespace is %s and clusterURL is %s", namespace.Name, namespace.ClusterURL)
+	namespace, err := t.GetNamespace(r.Context(), accessToken)
+	requestid.Logger(r.Context(), log.NewEntry(log.StandardLogger())).
+		Infof("Found token info in the query. Namespace is %s and clusterURL is %s", namespace.Name, namespace.ClusterURL)
 	return namespace, err
 }
 
@@ -56,7 +58,7 @@ func (api *jenkinsAPIImpl) Status(w http.ResponseWriter, r *http.Request, _ http
 		HandleError(w, resp, err, http.StatusUnauthorized)
 		return
 	}
-	status, err := api.idler.State(namespace.Name, namespace.ClusterURL)
+	status, err := api.idler.State(r.Context(), namespace.Name, namespace.ClusterURL)
 	if err != nil {
 		HandleError(w, resp, err, http.StatusInternalServerError)
 		return
@@ -77,7 +79,7 @@ func (api *jenkinsAPIImpl) Start(w http.ResponseWriter, r *http.Request, _ httpr
 		return
 	}
 
-	status, err := api.idler.State(namespace.Name, namespace.ClusterURL)
+	status, err := api.idler.State(r.Context(), namespace.Name, namespace.ClusterURL)
 	if err != nil {
 		HandleError(w, resp, err, http.StatusInternalServerError)
 		return
@@ -87,7 +89,7 @@ func (api *jenkinsAPIImpl) Start(w http.ResponseWriter, r *http.Request, _ httpr
 	}
 
 	if status != idler.Running {
-		httpCode, err := api.idler.UnIdle(namespace.Name, namespace.ClusterURL)
+		httpCode, err := api.idler.UnIdle(r.Context(), namespace.Name, namespace.ClusterURL)
 		if err != nil {
 			HandleError(w, resp, err, httpCode)
 			return
@@ -1,6 +1,8 @@
 package metric
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
@@ -21,10 +23,110 @@ var (
 		Name:      "requests_type_total",
 		Help:      "Counter of requests received into the system.",
 	}, reqLabels)
+
+	providerLabels = []string{"provider"}
+
+	sigFailCnt = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "webhook_signature_failures_total",
+		Help:      "Counter of webhooks rejected because of a missing or invalid signature.",
+	}, providerLabels)
+
+	eventLabels = []string{"provider", "event"}
+
+	droppedCnt = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "webhook_events_dropped_total",
+		Help:      "Counter of webhook events acknowledged without being forwarded to Jenkins.",
+	}, eventLabels)
+
+	tableLabels = []string{"table"}
+
+	purgedCnt = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "storage_rows_purged_total",
+		Help:      "Counter of stored rows deleted because they outlived their retention.",
+	}, tableLabels)
+
+	upstreamLabels = []string{"service", "outcome"}
+
+	upstreamLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Histogram of the latency of calls to the idler, tenant, WIT, auth services and Jenkins.",
+		Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25},
+	}, upstreamLabels)
+
+	namespaceLabels = []string{"namespace"}
+
+	bufferedGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "buffered_requests_by_namespace",
+		Help:      "Gauge of webhook requests buffered until Jenkins of a namespace is running.",
+	}, namespaceLabels)
+
+	bufferedTotalGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "buffered_requests",
+		Help:      "Gauge of webhook requests buffered until Jenkins is running, of all namespaces.",
+	})
+
+	unidleLabels = []string{"cluster", "outcome"}
+
+	unidleCnt = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "unidle_calls_total",
+		Help:      "Counter of calls to the idler to unidle Jenkins.",
+	}, unidleLabels)
+
+	outcomeLabels = []string{"outcome"}
+
+	replayCnt = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "replay_outcomes_total",
+		Help:      "Counter of replays of buffered requests by outcome.",
+	}, outcomeLabels)
+
+	cacheLabels = []string{"cache", "result"}
+
+	cacheCnt = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "cache_lookups_total",
+		Help:      "Counter of cache lookups by cache and whether they were a hit or a miss.",
+	}, cacheLabels)
+
+	readyLabels = []string{"cluster", "trigger"}
+
+	timeToReady = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "time_to_ready_seconds",
+		Help:      "Histogram of how long Jenkins took to be running or to serve a login after it was unidled.",
+		Buckets:   []float64{5, 10, 20, 30, 45, 60, 90, 120, 180, 300, 600},
+	}, readyLabels)
 )
 
 func registerMetrics() {
 	reqCnt = register(reqCnt, "requests_type_total").(*prometheus.CounterVec)
+	sigFailCnt = register(sigFailCnt, "webhook_signature_failures_total").(*prometheus.CounterVec)
+	droppedCnt = register(droppedCnt, "webhook_events_dropped_total").(*prometheus.CounterVec)
+	purgedCnt = register(purgedCnt, "storage_rows_purged_total").(*prometheus.CounterVec)
+	upstreamLatency = register(upstreamLatency, "upstream_request_duration_seconds").(*prometheus.HistogramVec)
+	bufferedGauge = register(bufferedGauge, "buffered_requests_by_namespace").(*prometheus.GaugeVec)
+	bufferedTotalGauge = register(bufferedTotalGauge, "buffered_requests").(prometheus.Gauge)
+	unidleCnt = register(unidleCnt, "unidle_calls_total").(*prometheus.CounterVec)
+	replayCnt = register(replayCnt, "replay_outcomes_total").(*prometheus.CounterVec)
+	cacheCnt = register(cacheCnt, "cache_lookups_total").(*prometheus.CounterVec)
+	timeToReady = register(timeToReady, "time_to_ready_seconds").(*prometheus.HistogramVec)
 }
 
 func register(c prometheus.Collector, name string) prometheus.Collector {
@@ -49,3 +151,60 @@ func reportRequestsTotal(requestType string) {
 		reqCnt.WithLabelValues(requestType).Inc()
 	}
 }
+
+func reportWebhookSignatureFailure(provider string) {
+	if provider != "" {
+		sigFailCnt.WithLabelValues(provider).Inc()
+	}
+}
+
+func reportWebhookEventDropped(provider string, event string) {
+	if provider != "" {
+		droppedCnt.WithLabelValues(provider, event).Inc()
+	}
+}
+
+func reportRowsPurged(table string, count int64) {
+	if table != "" && count > 0 {
+		purgedCnt.WithLabelValues(table).Add(float64(count))
+	}
+}
+
+func reportUpstreamLatency(service string, outcome string, duration time.Duration) {
+	if service != "" {
+		upstreamLatency.WithLabelValues(service, outcome).Observe(duration.Seconds())
+	}
+}
+
+func reportBufferedRequests(counts map[string]int) {
+	// namespaces without buffered requests are no longer reported
+	bufferedGauge.Reset()
+	total := 0
+	for ns, count := range counts {
+		bufferedGauge.WithLabelValues(ns).Set(float64(count))
+		total += count
+	}
+	bufferedTotalGauge.Set(float64(total))
+}
+
+func reportUnidle(cluster string, outcome string) {
+	unidleCnt.WithLabelValues(cluster, outcome).Inc()
+}
+
+func reportReplayOutcome(outcome string) {
+	if outcome != "" {
+		replayCnt.WithLabelValues(outcome).Inc()
+	}
+}
+
+func reportCacheLookup(cache string, result string) {
+	if cache != "" {
+		cacheCnt.WithLabelValues(cache, result).Inc()
+	}
+}
+
+func reportTimeToReady(cluster string, trigger string, duration time.Duration) {
+	if trigger != "" {
+		timeToReady.WithLabelValues(cluster, trigger).Observe(duration.Seconds())
+	}
+}
@@ -0,0 +1,110 @@
+package metric
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mock is a Recorder keeping the recorded metrics in memory, for tests. Counters are
+// incremented, histograms count their observations and gauges hold the last value.
+type Mock struct {
+	lock   sync.Mutex
+	values map[string]float64
+}
+
+// NewMock creates a recorder keeping metrics in memory.
+func NewMock() *Mock {
+	return &Mock{values: map[string]float64{}}
+}
+
+// Value returns the value of the metric with the given name and label values, as named
+// in Prometheus without the subsystem prefix, e.g. Value("replay_outcomes_total", ReplayForwarded).
+func (m *Mock) Value(name string, labels ...string) float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.values[mockKey(name, labels)]
+}
+
+func (m *Mock) add(value float64, name string, labels ...string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.values[mockKey(name, labels)] += value
+}
+
+func mockKey(name string, labels []string) string {
+	return name + "{" + strings.Join(labels, ",") + "}"
+}
+
+// Initialize does nothing
+func (m *Mock) Initialize() {}
+
+// RecordReqByTypeTotal records a request type
+func (m *Mock) RecordReqByTypeTotal(requestType string) {
+	m.add(1, "requests_type_total", requestType)
+}
+
+// RecordWebhookSignatureFailure records a webhook rejected because of its signature
+func (m *Mock) RecordWebhookSignatureFailure(provider string) {
+	m.add(1, "webhook_signature_failures_total", provider)
+}
+
+// RecordWebhookEventDropped records a webhook event which was not forwarded to Jenkins
+func (m *Mock) RecordWebhookEventDropped(provider string, event string) {
+	m.add(1, "webhook_events_dropped_total", provider, event)
+}
+
+// RecordRowsPurged records stored rows deleted by the retention policy
+func (m *Mock) RecordRowsPurged(table string, count int64) {
+	m.add(float64(count), "storage_rows_purged_total", table)
+}
+
+// RecordUpstreamLatency counts calls to an upstream service by outcome
+func (m *Mock) RecordUpstreamLatency(service string, duration time.Duration, err error) {
+	outcome := outcomeSuccess
+	if err != nil {
+		outcome = outcomeFailure
+	}
+	m.add(1, "upstream_request_duration_seconds", service, outcome)
+}
+
+// RecordBufferedRequests records the number of buffered requests of every namespace having some
+func (m *Mock) RecordBufferedRequests(counts map[string]int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for key := range m.values {
+		if strings.HasPrefix(key, "buffered_requests_by_namespace{") {
+			delete(m.values, key)
+		}
+	}
+	total := 0
+	for ns, count := range counts {
+		m.values[mockKey("buffered_requests_by_namespace", []string{ns})] = float64(count)
+		total += count
+	}
+	m.values[mockKey("buffered_requests", nil)] = float64(total)
+}
+
+// RecordUnidle records a call to unidle Jenkins on a cluster
+func (m *Mock) RecordUnidle(cluster string, outcome string) {
+	m.add(1, "unidle_calls_total", cluster, outcome)
+}
+
+// RecordReplayOutcome records how the replay of a buffered request ended
+func (m *Mock) RecordReplayOutcome(outcome string) {
+	m.add(1, "replay_outcomes_total", outcome)
+}
+
+// RecordCacheLookup records a cache hit or miss
+func (m *Mock) RecordCacheLookup(cache string, hit bool) {
+	result := cacheMiss
+	if hit {
+		result = cacheHit
+	}
+	m.add(1, "cache_lookups_total", cache, result)
+}
+
+// RecordTimeToReady counts Jenkins instances which got ready by cluster and trigger
+func (m *Mock) RecordTimeToReady(cluster string, trigger string, duration time.Duration) {
+	m.add(1, "time_to_ready_seconds", cluster, trigger)
+}
@@ -1,13 +1,96 @@
 package metric
 
 import (
+	"net/http"
 	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// UpstreamIdler labels calls to the idler service
+	UpstreamIdler = "idler"
+	// UpstreamTenant labels calls to the tenant service
+	UpstreamTenant = "tenant"
+	// UpstreamWIT labels calls to the work item tracker service
+	UpstreamWIT = "wit"
+	// UpstreamAuth labels calls to the auth service
+	UpstreamAuth = "auth"
+	// UpstreamJenkins labels calls to Jenkins
+	UpstreamJenkins = "jenkins"
+
+	// UnidleSucceeded counts unidle calls accepted by the idler
+	UnidleSucceeded = "success"
+	// UnidleUnavailable counts unidle calls the idler could not serve right now
+	UnidleUnavailable = "unavailable"
+	// UnidleFailed counts unidle calls which failed
+	UnidleFailed = "failure"
+
+	// ReplayForwarded counts buffered requests forwarded to Jenkins
+	ReplayForwarded = "forwarded"
+	// ReplayDropped counts buffered requests thrown away without being forwarded successfully
+	ReplayDropped = "dropped"
+	// ReplayRetried counts failed replays of buffered requests which are retried later
+	ReplayRetried = "retried"
+	// ReplayExpired counts buffered requests moved to the dead letters once their retries are exhausted
+	ReplayExpired = "expired"
+
+	// TriggerUI labels Jenkins unidled by a user opening its UI
+	TriggerUI = "ui"
+	// TriggerWebhook labels Jenkins unidled by a webhook
+	TriggerWebhook = "webhook"
+
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+	cacheHit       = "hit"
+	cacheMiss      = "miss"
 )
 
 // Recorder interface that encapsulates all logic of metrics
 type Recorder interface {
 	Initialize()
 	RecordReqByTypeTotal(requestType string)
+	RecordWebhookSignatureFailure(provider string)
+	RecordWebhookEventDropped(provider string, event string)
+	RecordRowsPurged(table string, count int64)
+	RecordUpstreamLatency(service string, duration time.Duration, err error)
+	RecordBufferedRequests(counts map[string]int)
+	RecordUnidle(cluster string, outcome string)
+	RecordReplayOutcome(outcome string)
+	RecordCacheLookup(cache string, hit bool)
+	RecordTimeToReady(cluster string, trigger string, duration time.Duration)
+}
+
+var (
+	defaultRecorder     Recorder = PrometheusRecorder{}
+	defaultRecorderLock sync.RWMutex
+)
+
+// SetDefaultRecorder sets the recorder used by the upstream clients and the proxy,
+// e.g. to a Mock in tests.
+func SetDefaultRecorder(r Recorder) {
+	defaultRecorderLock.Lock()
+	defer defaultRecorderLock.Unlock()
+	defaultRecorder = r
+}
+
+// DefaultRecorder returns the recorder used by the upstream clients and the proxy.
+func DefaultRecorder() Recorder {
+	defaultRecorderLock.RLock()
+	defer defaultRecorderLock.RUnlock()
+	return defaultRecorder
+}
+
+// UnidleOutcome returns the outcome of an unidle call answered with the given status code.
+func UnidleOutcome(code int, err error) string {
+	switch {
+	case err != nil:
+		return UnidleFailed
+	case code == http.StatusServiceUnavailable:
+		return UnidleUnavailable
+	default:
+		return UnidleSucceeded
+	}
 }
 
 // PrometheusRecorder struct used to record metrics to be consumed by Prometheus
@@ -25,6 +108,59 @@ func (pr PrometheusRecorder) RecordReqByTypeTotal(requestType string) {
 	reportRequestsTotal(convertLabel(requestType))
 }
 
+// RecordWebhookSignatureFailure records a webhook rejected because of its signature
+func (pr PrometheusRecorder) RecordWebhookSignatureFailure(provider string) {
+	reportWebhookSignatureFailure(convertLabel(provider))
+}
+
+// RecordWebhookEventDropped records a webhook event which was not forwarded to Jenkins
+func (pr PrometheusRecorder) RecordWebhookEventDropped(provider string, event string) {
+	reportWebhookEventDropped(convertLabel(provider), event)
+}
+
+// RecordRowsPurged records stored rows deleted by the retention policy
+func (pr PrometheusRecorder) RecordRowsPurged(table string, count int64) {
+	reportRowsPurged(table, count)
+}
+
+// RecordUpstreamLatency records how long a call to an upstream service took and whether it failed
+func (pr PrometheusRecorder) RecordUpstreamLatency(service string, duration time.Duration, err error) {
+	outcome := outcomeSuccess
+	if err != nil {
+		outcome = outcomeFailure
+	}
+	reportUpstreamLatency(service, outcome, duration)
+}
+
+// RecordBufferedRequests records the number of buffered requests of every namespace having some
+func (pr PrometheusRecorder) RecordBufferedRequests(counts map[string]int) {
+	reportBufferedRequests(counts)
+}
+
+// RecordUnidle records a call to unidle Jenkins on a cluster
+func (pr PrometheusRecorder) RecordUnidle(cluster string, outcome string) {
+	reportUnidle(cluster, outcome)
+}
+
+// RecordReplayOutcome records how the replay of a buffered request ended
+func (pr PrometheusRecorder) RecordReplayOutcome(outcome string) {
+	reportReplayOutcome(outcome)
+}
+
+// RecordCacheLookup records a cache hit or miss
+func (pr PrometheusRecorder) RecordCacheLookup(cache string, hit bool) {
+	result := cacheMiss
+	if hit {
+		result = cacheHit
+	}
+	reportCacheLookup(cache, result)
+}
+
+// RecordTimeToReady records how long Jenkins on a cluster took to be ready after it was unidled
+func (pr PrometheusRecorder) RecordTimeToReady(cluster string, trigger string, duration time.Duration) {
+	reportTimeToReady(cluster, trigger, duration)
+}
+
 func convertLabel(label string) string {
 	newLabel := strings.ToLower(label)
 	return strings.Replace(newLabel, " ", "", -1)
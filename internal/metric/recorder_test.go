@@ -1,8 +1,12 @@
 package metric
 
 import (
+	"errors"
+	"net/http"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 )
 
@@ -43,3 +47,133 @@ func checkCounter(t *testing.T, reportType string, expected int64) {
 		t.Errorf("metric(\"%s\"), want: %d, got: %d", reportType, expected, actual)
 	}
 }
+
+func TestWebhookSignatureFailureMetric(t *testing.T) {
+
+	recorder := PrometheusRecorder{}
+
+	recorder.RecordWebhookSignatureFailure(github)
+
+	failMetric, _ := sigFailCnt.GetMetricWithLabelValues(convertLabel(github))
+	m := &dto.Metric{}
+	failMetric.Write(m)
+	if actual := int64(m.Counter.GetValue()); actual != 1 {
+		t.Errorf("metric(\"%s\"), want: %d, got: %d", convertLabel(github), 1, actual)
+	}
+}
+
+func TestWebhookEventDroppedMetric(t *testing.T) {
+
+	recorder := PrometheusRecorder{}
+
+	recorder.RecordWebhookEventDropped(github, "ping")
+	recorder.RecordWebhookEventDropped(github, "ping")
+
+	droppedMetric, _ := droppedCnt.GetMetricWithLabelValues(convertLabel(github), "ping")
+	m := &dto.Metric{}
+	droppedMetric.Write(m)
+	if actual := int64(m.Counter.GetValue()); actual != 2 {
+		t.Errorf("metric(\"%s\"), want: %d, got: %d", convertLabel(github), 2, actual)
+	}
+}
+
+func TestRowsPurgedMetric(t *testing.T) {
+
+	recorder := PrometheusRecorder{}
+
+	recorder.RecordRowsPurged("requests", 3)
+	recorder.RecordRowsPurged("requests", 0)
+	recorder.RecordRowsPurged("requests", 2)
+
+	purgedMetric, _ := purgedCnt.GetMetricWithLabelValues("requests")
+	m := &dto.Metric{}
+	purgedMetric.Write(m)
+	if actual := int64(m.Counter.GetValue()); actual != 5 {
+		t.Errorf("metric(\"%s\"), want: %d, got: %d", "requests", 5, actual)
+	}
+}
+
+func TestUpstreamLatencyMetric(t *testing.T) {
+
+	recorder := PrometheusRecorder{}
+
+	recorder.RecordUpstreamLatency(UpstreamIdler, 100*time.Millisecond, nil)
+	recorder.RecordUpstreamLatency(UpstreamIdler, 300*time.Millisecond, nil)
+	recorder.RecordUpstreamLatency(UpstreamIdler, time.Second, errors.New("timeout"))
+
+	latencyMetric, _ := upstreamLatency.GetMetricWithLabelValues(UpstreamIdler, outcomeSuccess)
+	m := &dto.Metric{}
+	latencyMetric.(prometheus.Histogram).Write(m)
+	if actual := m.Histogram.GetSampleCount(); actual != 2 {
+		t.Errorf("metric(\"%s\"), want: %d, got: %d", UpstreamIdler, 2, actual)
+	}
+	if actual := m.Histogram.GetSampleSum(); actual < 0.39 || actual > 0.41 {
+		t.Errorf("metric(\"%s\"), want sum: %f, got: %f", UpstreamIdler, 0.4, actual)
+	}
+}
+
+func TestBufferedRequestsMetric(t *testing.T) {
+
+	recorder := PrometheusRecorder{}
+
+	recorder.RecordBufferedRequests(map[string]int{"ns1": 2, "ns2": 3})
+	recorder.RecordBufferedRequests(map[string]int{"ns2": 1})
+
+	m := &dto.Metric{}
+	bufferedTotalGauge.Write(m)
+	if actual := int64(m.Gauge.GetValue()); actual != 1 {
+		t.Errorf("metric(\"%s\"), want: %d, got: %d", "buffered_requests", 1, actual)
+	}
+
+	metrics := make(chan prometheus.Metric, 10)
+	bufferedGauge.Collect(metrics)
+	close(metrics)
+	if actual := len(metrics); actual != 1 {
+		t.Errorf("want gauges of %d namespace, got: %d", 1, actual)
+	}
+}
+
+func TestReplayOutcomeMetric(t *testing.T) {
+
+	recorder := PrometheusRecorder{}
+
+	recorder.RecordReplayOutcome(ReplayForwarded)
+	recorder.RecordReplayOutcome(ReplayRetried)
+	recorder.RecordReplayOutcome(ReplayForwarded)
+
+	replayMetric, _ := replayCnt.GetMetricWithLabelValues(ReplayForwarded)
+	m := &dto.Metric{}
+	replayMetric.Write(m)
+	if actual := int64(m.Counter.GetValue()); actual != 2 {
+		t.Errorf("metric(\"%s\"), want: %d, got: %d", ReplayForwarded, 2, actual)
+	}
+}
+
+func TestCacheLookupMetric(t *testing.T) {
+
+	recorder := PrometheusRecorder{}
+
+	recorder.RecordCacheLookup("tenants", true)
+	recorder.RecordCacheLookup("tenants", false)
+	recorder.RecordCacheLookup("tenants", false)
+
+	missMetric, _ := cacheCnt.GetMetricWithLabelValues("tenants", cacheMiss)
+	m := &dto.Metric{}
+	missMetric.Write(m)
+	if actual := int64(m.Counter.GetValue()); actual != 2 {
+		t.Errorf("metric(\"%s\"), want: %d, got: %d", "tenants", 2, actual)
+	}
+}
+
+func TestUnidleOutcome(t *testing.T) {
+
+	if outcome := UnidleOutcome(http.StatusOK, nil); outcome != UnidleSucceeded {
+		t.Errorf("want: %s, got: %s", UnidleSucceeded, outcome)
+	}
+	if outcome := UnidleOutcome(http.StatusServiceUnavailable, nil); outcome != UnidleUnavailable {
+		t.Errorf("want: %s, got: %s", UnidleUnavailable, outcome)
+	}
+	if outcome := UnidleOutcome(0, errors.New("unexpected status")); outcome != UnidleFailed {
+		t.Errorf("want: %s, got: %s", UnidleFailed, outcome)
+	}
+}
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -34,8 +35,8 @@ func NewCodebase(wit wit.Service, tenant tenant.Service, repositoryCloneURL stri
 }
 
 // Namespace gives us details of user who owns given repository
-func (c *Codebase) Namespace() (tenant.Namespace, error) {
-	wi, err := c.wit.SearchCodebase(c.repositoryCloneURL)
+func (c *Codebase) Namespace(ctx context.Context) (tenant.Namespace, error) {
+	wi, err := c.wit.SearchCodebase(ctx, c.repositoryCloneURL)
 	if err != nil {
 		return tenant.Namespace{}, err
 	}
@@ -45,7 +46,7 @@ func (c *Codebase) Namespace() (tenant.Namespace, error) {
 	}
 
 	c.logger.Infof("Found id %s for repo %s", wi.OwnedBy, c.repositoryCloneURL)
-	ti, err := c.tenant.GetTenantInfo(wi.OwnedBy)
+	ti, err := c.tenant.GetTenantInfo(ctx, wi.OwnedBy)
 	if err != nil {
 		return tenant.Namespace{}, err
 	}
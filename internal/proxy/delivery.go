@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+)
+
+// webhookDeliveryID returns the delivery ID of a webhook request,
+// or an empty string if its provider does not identify deliveries
+func webhookDeliveryID(provider WebhookProvider, r *http.Request) string {
+	if identifier, ok := provider.(DeliveryIdentifier); ok {
+		return identifier.DeliveryID(r)
+	}
+	return ""
+}
+
+// isDuplicateDelivery returns true if the delivery was forwarded to Jenkins
+// within the delivery window or is still buffered.
+func (p *Proxy) isDuplicateDelivery(deliveryID string) (bool, error) {
+	if deliveryID == "" {
+		return false, nil
+	}
+	if p.deliveryForwarded(deliveryID) {
+		return true, nil
+	}
+
+	_, notFound, err := p.storageService.GetRequestByDeliveryID(deliveryID)
+	if notFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// deliveryForwarded returns true if the delivery was forwarded to Jenkins
+// within the delivery window
+func (p *Proxy) deliveryForwarded(deliveryID string) bool {
+	if deliveryID == "" || p.deliveryCache == nil {
+		return false
+	}
+	var forwarded bool
+	found, err := p.deliveryCache.Get(deliveryID, &forwarded)
+	if err != nil {
+		proxyLogger.WithField("delivery", deliveryID).Errorf("Could not look up delivery in cache: %s", err)
+	}
+	return found
+}
+
+// rememberDelivery records that the delivery was forwarded to Jenkins
+func (p *Proxy) rememberDelivery(deliveryID string) {
+	if deliveryID == "" || p.deliveryCache == nil {
+		return
+	}
+	if err := p.deliveryCache.Set(deliveryID, true); err != nil {
+		proxyLogger.WithField("delivery", deliveryID).Errorf("Could not cache delivery: %s", err)
+	}
+}
+
+// rememberAcceptedDelivery returns a reverse proxy response hook which records that the delivery
+// was forwarded once Jenkins accepted it. A delivery which Jenkins did not accept is not recorded,
+// so that its redelivery is forwarded again.
+func (p *Proxy) rememberAcceptedDelivery(deliveryID string) func(*http.Response) {
+	return func(resp *http.Response) {
+		if resp.StatusCode/100 == 2 {
+			p.rememberDelivery(deliveryID)
+		}
+	}
+}
+
+// bufferedDeliveryID returns the delivery ID of a buffered request or an empty string
+func bufferedDeliveryID(r storage.Request) string {
+	if r.DeliveryID == nil {
+		return ""
+	}
+	return *r.DeliveryID
+}
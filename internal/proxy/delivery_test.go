@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/wit"
+	"github.com/stretchr/testify/assert"
+)
+
+// deliveryStore remembers the delivery IDs of created requests
+type deliveryStore struct {
+	storage.Mock
+	deliveries map[string]*storage.Request
+}
+
+func (s *deliveryStore) CreateRequest(r *storage.Request) error {
+	if r.DeliveryID != nil {
+		if _, found := s.deliveries[*r.DeliveryID]; found {
+			return storage.ErrDuplicateDelivery
+		}
+		s.deliveries[*r.DeliveryID] = r
+	}
+	return nil
+}
+
+func (s *deliveryStore) GetRequestByDeliveryID(id string) (*storage.Request, bool, error) {
+	r, found := s.deliveries[id]
+	return r, !found, nil
+}
+
+func ghDelivery(id string) *http.Request {
+	req := httptest.NewRequest("POST", "http://proxy/github-webhook/", bytes.NewReader(ghPayload()))
+	req.Header.Set(GHHeader, GHAgent+"/c494ff1")
+	req.Header.Set(GHDeliveryHeader, id)
+	return req
+}
+
+func TestDuplicateDeliveryIsNotBuffered(t *testing.T) {
+	p := NewMock(idler.Idled, wit.DefaultMockOwner)
+	store := &deliveryStore{deliveries: map[string]*storage.Request{}}
+	p.storageService = store
+
+	w := httptest.NewRecorder()
+	_, okToForward := p.handleWebhookRequest(w, ghDelivery("72d3162e-cc78-11e3-81ab-4c9367dc0958"), &gitHubProvider{}, proxyLogger)
+	assert.False(t, okToForward)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	if assert.Len(t, store.deliveries, 1, "The delivery should have been buffered") {
+		assert.Equal(t, "namespace-jenkins", store.deliveries["72d3162e-cc78-11e3-81ab-4c9367dc0958"].Namespace)
+	}
+
+	w = httptest.NewRecorder()
+	ns, okToForward := p.handleWebhookRequest(w, ghDelivery("72d3162e-cc78-11e3-81ab-4c9367dc0958"), &gitHubProvider{}, proxyLogger)
+	assert.Equal(t, "", ns)
+	assert.False(t, okToForward, "A redelivery should not be forwarded")
+	assert.Equal(t, http.StatusOK, w.Code, "A redelivery should be acknowledged")
+	assert.Len(t, store.deliveries, 1, "A redelivery should not be buffered")
+}
+
+func TestDuplicateDeliveryIsNotForwarded(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+
+	w := httptest.NewRecorder()
+	_, okToForward := p.handleWebhookRequest(w, ghDelivery("a"), &gitHubProvider{}, proxyLogger)
+	assert.True(t, okToForward, "The first delivery should be forwarded")
+	p.rememberAcceptedDelivery("a")(&http.Response{StatusCode: http.StatusOK})
+
+	w = httptest.NewRecorder()
+	_, okToForward = p.handleWebhookRequest(w, ghDelivery("a"), &gitHubProvider{}, proxyLogger)
+	assert.False(t, okToForward, "A redelivery should not be forwarded")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	_, okToForward = p.handleWebhookRequest(w, ghDelivery("b"), &gitHubProvider{}, proxyLogger)
+	assert.True(t, okToForward, "Another delivery should be forwarded")
+}
+
+func TestRedeliveryOfFailedForwardIsForwarded(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+
+	w := httptest.NewRecorder()
+	_, okToForward := p.handleWebhookRequest(w, ghDelivery("a"), &gitHubProvider{}, proxyLogger)
+	assert.True(t, okToForward, "The first delivery should be forwarded")
+	p.rememberAcceptedDelivery("a")(&http.Response{StatusCode: http.StatusBadGateway})
+
+	w = httptest.NewRecorder()
+	_, okToForward = p.handleWebhookRequest(w, ghDelivery("a"), &gitHubProvider{}, proxyLogger)
+	assert.True(t, okToForward, "A redelivery should be forwarded if Jenkins did not accept the delivery")
+}
+
+func TestDeliveryWithoutIDIsNeverDuplicate(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		_, okToForward := p.handleWebhookRequest(w, ghDelivery(""), &gitHubProvider{}, proxyLogger)
+		assert.True(t, okToForward, "Deliveries without ID should always be forwarded")
+	}
+}
+
+func TestDeliveryWindowDisabled(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.deliveryCache = nil
+
+	p.rememberDelivery("a")
+	assert.False(t, p.deliveryForwarded("a"), "Deliveries should not be remembered without window")
+}
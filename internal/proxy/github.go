@@ -2,14 +2,18 @@ package proxy
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tenant"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -21,7 +25,7 @@ const (
 )
 
 //GHHookStruct a simplified structure to get info from
-//a webhook request
+//a GitHub webhook request
 type GHHookStruct struct {
 	Repository struct {
 		Name     string `json:"name"`
@@ -31,27 +35,60 @@ type GHHookStruct struct {
 	} `json:"repository"`
 }
 
-func (p *Proxy) handleGitHubRequest(w http.ResponseWriter, r *http.Request, requestLogEntry *log.Entry) (ns string, okToForward bool) {
+func (p *Proxy) handleWebhookRequest(w http.ResponseWriter, r *http.Request, provider WebhookProvider, requestLogEntry *log.Entry) (ns string, okToForward bool) {
 	okToForward = false
-	//Load request body if it's GH webhook
-	gh := GHHookStruct{}
+	//Load request body of the webhook
 	defer r.Body.Close()
 
+	ctx, cancel := p.upstreamContext(r)
+	defer cancel()
+
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		p.HandleError(w, err, requestLogEntry)
 		return
 	}
 
-	err = json.Unmarshal(body, &gh)
+	repositoryURL, err := provider.RepositoryURL(body)
 	if err != nil {
 		p.HandleError(w, err, requestLogEntry)
 		return
 	}
 
-	requestLogEntry.WithField("json", gh).Debug("Processing GitHub JSON payload")
+	if err := p.verifyWebhookSignature(r, provider, repositoryURL, body); err != nil {
+		metric.DefaultRecorder().RecordWebhookSignatureFailure(provider.Name())
+		requestLogEntry.WithField("repository", repositoryURL).Warnf("Rejecting %s webhook", provider.Name())
+		p.HandleErrorWithStatus(w, http.StatusUnauthorized, err, requestLogEntry)
+		return
+	}
+
+	event, outcome, err := p.webhookEventOutcome(r, provider, body)
+	if err != nil {
+		p.HandleError(w, err, requestLogEntry)
+		return
+	}
+	eventLogger := requestLogEntry.WithFields(log.Fields{"repository": repositoryURL, "event": event.Name, "action": event.Action, "branch": event.Branch})
+	if outcome == EventDrop {
+		p.dropWebhookEvent(w, provider, event, "event is not relevant for builds", eventLogger)
+		return
+	}
 
-	namespace, err := p.getUserWithRetry(gh.Repository.CloneURL, requestLogEntry, defaultRetry)
+	deliveryID := webhookDeliveryID(provider, r)
+	duplicate, err := p.isDuplicateDelivery(deliveryID)
+	if err != nil {
+		p.HandleError(w, err, requestLogEntry)
+		return
+	}
+	if duplicate {
+		eventLogger.WithField("delivery", deliveryID).Infof("Acknowledging duplicate %s webhook delivery", provider.Name())
+		w.Header().Set("Server", "Webhook-Proxy")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	eventLogger.Debugf("Processing %s JSON payload", provider.Name())
+
+	namespace, err := p.getUserWithRetry(ctx, repositoryURL, requestLogEntry, defaultRetry)
 	if err != nil {
 		p.HandleError(w, err, requestLogEntry)
 		return
@@ -65,13 +102,13 @@ func (p *Proxy) handleGitHubRequest(w http.ResponseWriter, r *http.Request, requ
 		ClusterURL: namespace.ClusterURL,
 		NS:         ns,
 	}
-	jenkins, _, err := GetJenkins(p.clusters, &pci, p.idler, p.tenant, "", requestLogEntry)
+	jenkins, _, err := GetJenkins(ctx, p.clusters, &pci, p.idler, p.tenant, "", requestLogEntry)
 	if err != nil {
 		p.HandleError(w, err, requestLogEntry)
 		return
 	}
 
-	nsLogger.WithFields(log.Fields{"cluster": pci.ClusterURL, "repository": gh.Repository.CloneURL}).Info("Processing GitHub request ")
+	nsLogger.WithFields(log.Fields{"cluster": pci.ClusterURL, "repository": repositoryURL}).Infof("Processing %s request", provider.Name())
 
 	route, scheme, err := constructRoute(p.clusters, namespace.ClusterURL, namespace.Name)
 	if err != nil {
@@ -83,16 +120,23 @@ func (p *Proxy) handleGitHubRequest(w http.ResponseWriter, r *http.Request, requ
 	r.URL.Host = route
 	r.Host = route
 
-	state, err := jenkins.State()
+	state, err := jenkins.State(ctx)
 	if err != nil {
 		p.HandleError(w, err, requestLogEntry)
 		return
 	}
 
+	//Events which may not unidle Jenkins are only of interest to a running one
+	if state != idler.Running && outcome == EventForward {
+		p.dropWebhookEvent(w, provider, event, fmt.Sprintf("Jenkins is %s", state), eventLogger.WithField("ns", ns))
+		return
+	}
+
 	//If Jenkins is idle/stating, we need to cache the request and return success
 	if state != idler.Running {
-		p.storeGHRequest(w, r, ns, body, requestLogEntry)
-		_, _, err = jenkins.Start()
+		p.storeWebhookRequest(w, r, ns, body, deliveryID, requestLogEntry)
+		p.watcher.Watch(ns, namespace.ClusterURL)
+		_, _, err = p.startJenkins(ctx, jenkins, metric.TriggerWebhook)
 		if err != nil {
 			p.HandleError(w, err, requestLogEntry)
 		}
@@ -102,19 +146,86 @@ func (p *Proxy) handleGitHubRequest(w http.ResponseWriter, r *http.Request, requ
 	okToForward = true
 	r.Body = ioutil.NopCloser(bytes.NewReader(body))
 	//If Jenkins is up, we can simply proxy through
-	nsLogger.Infof("Passing through %s", r.URL.String())
+	nsLogger.Infof("Passing through %s", logging.RedactURL(r.URL))
 	w.WriteHeader(http.StatusOK)
 	return
 }
 
-func (p *Proxy) storeGHRequest(w http.ResponseWriter, r *http.Request, ns string, body []byte, requestLogEntry *log.Entry) {
+// verifyWebhookSignature verifies the signature of a webhook delivery if a secret is
+// configured for the repository or globally. Deliveries of providers which cannot be
+// verified are rejected once a secret applies.
+func (p *Proxy) verifyWebhookSignature(r *http.Request, provider WebhookProvider, repositoryURL string, body []byte) error {
+	secret, found := p.webhookSecrets[normalizeRepositoryURL(repositoryURL)]
+	if !found {
+		secret = p.webhookSecret
+	}
+	if secret == "" {
+		return nil
+	}
+
+	verifier, ok := provider.(SignatureVerifier)
+	if !ok {
+		return ErrInvalidSignature
+	}
+	return verifier.VerifySignature(r, body, secret)
+}
+
+// normalizeRepositoryURL returns the form of a repository URL under which webhook secrets are
+// looked up, so that URLs differing only in case, a trailing slash or the .git suffix match.
+func normalizeRepositoryURL(repositoryURL string) string {
+	normalized := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(repositoryURL)), "/")
+	return strings.TrimSuffix(normalized, ".git")
+}
+
+// webhookSecretsByRepository keys the given webhook secrets by normalized repository URL.
+func webhookSecretsByRepository(secrets map[string]string) map[string]string {
+	result := make(map[string]string, len(secrets))
+	for repositoryURL, secret := range secrets {
+		result[normalizeRepositoryURL(repositoryURL)] = secret
+	}
+	return result
+}
+
+// webhookEventOutcome describes the event of a webhook delivery and decides on its
+// outcome. Deliveries of providers which don't describe their events always unidle Jenkins.
+func (p *Proxy) webhookEventOutcome(r *http.Request, provider WebhookProvider, body []byte) (WebhookEvent, EventOutcome, error) {
+	describer, ok := provider.(EventDescriber)
+	if !ok {
+		return WebhookEvent{}, EventUnidle, nil
+	}
+
+	event, err := describer.Event(r, body)
+	if err != nil {
+		return event, "", err
+	}
+	return event, p.eventPolicy.Outcome(event), nil
+}
+
+// dropWebhookEvent acknowledges a webhook delivery without forwarding or buffering it
+func (p *Proxy) dropWebhookEvent(w http.ResponseWriter, provider WebhookProvider, event WebhookEvent, reason string, logEntry *log.Entry) {
+	metric.DefaultRecorder().RecordWebhookEventDropped(provider.Name(), event.Name)
+	logEntry.Infof("Dropping %s webhook: %s", provider.Name(), reason)
+	w.Header().Set("Server", "Webhook-Proxy")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *Proxy) storeWebhookRequest(w http.ResponseWriter, r *http.Request, ns string, body []byte, deliveryID string, requestLogEntry *log.Entry) {
 	w.Header().Set("Server", "Webhook-Proxy")
 	sr, err := storage.NewRequest(r, ns, body)
 	if err != nil {
 		p.HandleError(w, err, requestLogEntry)
 		return
 	}
+	if deliveryID != "" {
+		sr.DeliveryID = &deliveryID
+	}
 	err = p.storageService.CreateRequest(sr)
+	if err == storage.ErrDuplicateDelivery {
+		// a redelivery raced us to the buffer
+		requestLogEntry.WithFields(log.Fields{"ns": ns, "delivery": deliveryID}).Info("Webhook delivery already buffered")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 	if err != nil {
 		p.HandleError(w, err, requestLogEntry)
 		return
@@ -131,129 +242,29 @@ func (p *Proxy) storeGHRequest(w http.ResponseWriter, r *http.Request, ns string
 	return
 }
 
-//ProcessBuffer is a loop running through buffered webhook requests trying to replay them
-func (p *Proxy) ProcessBuffer() {
-	for {
-		namespaces, err := p.storageService.GetUsers()
-		if err != nil {
-			log.Error(err)
-		} else {
-			for _, ns := range namespaces {
-				requests, err := p.storageService.GetRequests(ns)
-				if err != nil {
-					log.Error(err)
-					continue
-				}
-				for _, r := range requests {
-					gh := GHHookStruct{}
-					err = json.Unmarshal(r.Payload, &gh)
-					if err != nil {
-						log.Error(err)
-						break
-					}
-
-					nsLogger := log.WithField("ns", ns)
-
-					nsLogger.WithFields(log.Fields{"repository": gh.Repository.CloneURL}).Info("Retrying request")
-					namespace, err := p.getUserWithRetry(gh.Repository.CloneURL, proxyLogger, defaultRetry)
-					if err != nil {
-						log.Error(err)
-						break
-					}
-					pci := CacheItem{
-						NS:         namespace.Name,
-						ClusterURL: namespace.ClusterURL,
-					}
-
-					jenkins, _, err := GetJenkins(p.clusters, &pci, p.idler, p.tenant, "", nsLogger)
-					if err != nil {
-						log.Error(err)
-						break
-					}
-
-					state, err := jenkins.State()
-					if err != nil {
-						log.Error(err)
-						break
-					}
-					err = p.recordStatistics(ns, 0, time.Now().Unix())
-					if err != nil {
-						log.Error(err)
-					}
-					if state == idler.Running {
-						req, err := r.GetHTTPRequest()
-						if err != nil {
-							log.Errorf("Could not format request %s (%s): %s - deleting", r.ID, r.Namespace, err)
-							err = p.storageService.DeleteRequest(&r)
-							if err != nil {
-								log.Errorf(storage.ErrorFailedDelete, r.ID, r.Namespace, err)
-							}
-							break
-						}
-
-						client := http.DefaultClient
-						if r.Retries < p.maxRequestRetry { //Check how many times we retried since the Jenkins started
-							resp, err := client.Do(req)
-							if err != nil {
-								log.Error("Error: ", err)
-								errs := p.storageService.IncrementRequestRetry(&r)
-								if len(errs) > 0 {
-									for _, e := range errs {
-										log.Error(e)
-									}
-								}
-								break
-							}
-
-							if resp.StatusCode == 200 {
-								nsLogger.Infof("Request to %q forwarded.", req.Host)
-							} else if resp.StatusCode == 404 || resp.StatusCode == 400 {
-								log.Warnf("Got status %q after retrying request on %s, throwing away the request", resp.Status, req.URL.String())
-							} else {
-								//Retry later if the response is not 200 or 400 or 404
-								log.Errorf("Got status %q after retrying request on %s", resp.Status, req.URL.String())
-								errs := p.storageService.IncrementRequestRetry(&r)
-								for _, e := range errs {
-									log.Error(e)
-								}
-
-								break
-							}
-
-						}
-
-						// Deleting request since we tried too many times or the replay was successful with 200
-						// or request was failed with 404 or 400
-						err = p.storageService.DeleteRequest(&r)
-						if err != nil {
-							log.Errorf(storage.ErrorFailedDelete, r.ID, r.Namespace, err)
-						}
-					} else {
-						//Do not try other requests for user if Jenkins is not running
-						break
-					}
-				}
-			}
-		}
-		time.Sleep(p.bufferCheckSleep)
-	}
-}
-
-func (p *Proxy) getUserWithRetry(repositoryCloneURL string, logEntry *log.Entry, retry int) (tenant.Namespace, error) {
+func (p *Proxy) getUserWithRetry(ctx context.Context, repositoryCloneURL string, logEntry *log.Entry, retry int) (tenant.Namespace, error) {
 
 	for i := 1; i < retry; i++ {
-		if ns, err := p.getUser(repositoryCloneURL, logEntry); err == nil {
+		if ns, err := p.getUser(ctx, repositoryCloneURL, logEntry); err == nil {
 			return ns, nil
 		}
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			return tenant.Namespace{}, ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
 	}
-	return p.getUser(repositoryCloneURL, logEntry)
+	return p.getUser(ctx, repositoryCloneURL, logEntry)
 }
 
-//GetUser returns a namespace name based on GitHub repository URL
-func (p *Proxy) getUser(repositoryCloneURL string, logEntry *log.Entry) (tenant.Namespace, error) {
-	if n, found := p.TenantCache.Get(repositoryCloneURL); found {
-		namespace := n.(tenant.Namespace)
+//GetUser returns a namespace name based on repository URL
+func (p *Proxy) getUser(ctx context.Context, repositoryCloneURL string, logEntry *log.Entry) (tenant.Namespace, error) {
+	var namespace tenant.Namespace
+	found, err := p.TenantCache.Get(repositoryCloneURL, &namespace)
+	if err != nil {
+		logEntry.Errorf("Could not look up repository %s in cache: %s", repositoryCloneURL, err)
+	}
+	if found {
 		logEntry.WithFields(
 			log.Fields{
 				"ns": namespace,
@@ -263,11 +274,13 @@ func (p *Proxy) getUser(repositoryCloneURL string, logEntry *log.Entry) (tenant.
 	logEntry.Infof("Cache miss for repository %s", repositoryCloneURL)
 
 	codebase := NewCodebase(p.wit, p.tenant, repositoryCloneURL, logEntry)
-	n, err := codebase.Namespace()
+	n, err := codebase.Namespace(ctx)
 	if err != nil {
 		return n, err
 	}
 
-	p.TenantCache.SetDefault(repositoryCloneURL, n)
+	if err := p.TenantCache.Set(repositoryCloneURL, n); err != nil {
+		logEntry.Errorf("Could not cache repository %s: %s", repositoryCloneURL, err)
+	}
 	return n, nil
 }
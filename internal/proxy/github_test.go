@@ -14,10 +14,12 @@ import (
 )
 
 func TestWebhookRequestHasGHHeader(t *testing.T) {
-	p := NewMock(idler.Idled, wit.DefaultMockOwner)
 	req := httptest.NewRequest("GET", "http://proxy", nil)
 	req.Header.Add("User-Agent", "GitHub-Hookshot"+uuid.NewV4().String())
-	assert.True(t, p.isGitHubRequest(req), "p.isGitHubRequest(req) should evaluate to true")
+	provider := detectWebhookProvider(req)
+	if assert.NotNil(t, provider, "detectWebhookProvider(req) should detect a webhook") {
+		assert.Equal(t, "GitHub", provider.Name())
+	}
 }
 func TestGHWebHookRequestJenkinsIdled(t *testing.T) {
 	testGHWebHook(t, idler.Idled)
@@ -31,11 +33,11 @@ func testGHWebHook(t *testing.T, jenkinsState idler.PodState) {
 	p := NewMock(jenkinsState, wit.DefaultMockOwner)
 
 	w, req := getGHWebHookRecorderAndRequest()
-	ns, okToForward := p.handleGitHubRequest(w, req, proxyLogger)
+	ns, okToForward := p.handleWebhookRequest(w, req, &gitHubProvider{}, proxyLogger)
 
 	assert.Equal(t, ns, "namespace-jenkins")
 
-	_, ok := p.TenantCache.Get("https://github.com/test-username/test-repo.git")
+	ok := cached(p.TenantCache, "https://github.com/test-username/test-repo.git")
 	assert.True(t, ok, "An entry should have been created in tenant cache with repo url as key")
 
 	if jenkinsState == idler.Running {
@@ -53,14 +55,14 @@ func TestGHWebHookUnableToGetUser(t *testing.T) {
 	p := NewMock(idler.Idled, "")
 
 	w, req := getGHWebHookRecorderAndRequest()
-	ns, okToForward := p.handleGitHubRequest(w, req, proxyLogger)
+	ns, okToForward := p.handleWebhookRequest(w, req, &gitHubProvider{}, proxyLogger)
 
 	// Since we failed to get user because wit.OwnedBy being empty,
 	// we should have go an empty namespace and it should not be
 	// ok to forward
 	assert.Equal(t, ns, "")
 
-	_, ok := p.TenantCache.Get("https://github.com/test-username/test-repo.git")
+	ok := cached(p.TenantCache, "https://github.com/test-username/test-repo.git")
 	assert.False(t, ok, `An entry should not have been created in tenant cache with repo url as key,
 		since we failed to get the namespace associated with this repo url`)
 
@@ -70,8 +72,8 @@ func TestGHWebHookUnableToGetUser(t *testing.T) {
 
 }
 
-func getGHWebHookRecorderAndRequest() (*httptest.ResponseRecorder, *http.Request) {
-	gh := []byte(`{
+func ghPayload() []byte {
+	return []byte(`{
 		"repository": {
 			"name": "test-repo",
 			"full_name": "test-username/test-repo",
@@ -79,9 +81,11 @@ func getGHWebHookRecorderAndRequest() (*httptest.ResponseRecorder, *http.Request
 			"clone_url": "https://github.com/test-username/test-repo.git"
 		}
 	}`)
+}
 
+func getGHWebHookRecorderAndRequest() (*httptest.ResponseRecorder, *http.Request) {
 	w := httptest.NewRecorder()
-	req := httptest.NewRequest("GET", "http://proxy", bytes.NewBuffer(gh))
+	req := httptest.NewRequest("GET", "http://proxy", bytes.NewBuffer(ghPayload()))
 	req.Header.Add("User-Agent", "GitHub-Hookshot"+uuid.NewV4().String())
 
 	return w, req
@@ -1,14 +1,19 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/auth"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tenant"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tracing"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -18,9 +23,9 @@ import (
 // such as its url, which namespace it belongs to, which cluster it
 // belongs to etc
 type JenkinsService interface {
-	Login(osoToken string) (status int, cookie []*http.Cookie, err error)
-	State() (idler.PodState, error)
-	Start() (state idler.PodState, code int, err error)
+	Login(ctx context.Context, osoToken string) (status int, cookie []*http.Cookie, err error)
+	State(ctx context.Context) (idler.PodState, error)
+	Start(ctx context.Context) (state idler.PodState, code int, err error)
 }
 
 // Jenkins implements Jenkins interface
@@ -33,15 +38,21 @@ type Jenkins struct {
 	logger *log.Entry
 }
 
-// GetJenkins returns an intance of Jenkins struct
-func GetJenkins(clusters map[string]string,
+// GetJenkins returns an intance of Jenkins struct. Calls to upstream services
+// are cancelled once the given context is done.
+func GetJenkins(ctx context.Context,
+	clusters map[string]string,
 	pci *CacheItem,
 	idler idler.Service,
 	tenantClient tenant.Service,
 	tokenData string,
 	logger *log.Entry) (j *Jenkins, osioToken string, err error) {
 
+	ctx, span := tracing.Start(ctx, "proxy.GetJenkins")
+	defer func() { tracing.End(span, err) }()
+
 	if pci != nil {
+		span.SetAttributes(tracing.Namespace(pci.NS), tracing.Cluster(pci.ClusterURL))
 		if pci.NS != "" && pci.ClusterURL != "" {
 			return &Jenkins{
 				info:   *pci,
@@ -64,12 +75,12 @@ func GetJenkins(clusters map[string]string,
 	if err != nil {
 		return &Jenkins{}, "", err
 	}
-	uid, err := authClient.UIDFromToken(tokenJSON.AccessToken)
+	uid, err := authClient.UIDFromToken(ctx, tokenJSON.AccessToken)
 	if err != nil {
 		return &Jenkins{}, "", err
 	}
 
-	ti, err := tenantClient.GetTenantInfo(uid)
+	ti, err := tenantClient.GetTenantInfo(ctx, uid)
 	if err != nil {
 		return &Jenkins{}, "", err
 	}
@@ -80,6 +91,7 @@ func GetJenkins(clusters map[string]string,
 		return &Jenkins{}, osioToken, err
 	}
 
+	span.SetAttributes(tracing.Namespace(namespace.Name), tracing.Cluster(namespace.ClusterURL))
 	logger.WithField("ns", namespace.Name).Debug("Extracted information from token")
 	route, scheme, err := constructRoute(clusters, namespace.ClusterURL, namespace.Name)
 	if err != nil {
@@ -95,11 +107,22 @@ func GetJenkins(clusters map[string]string,
 }
 
 //Login to Jenkins with OSO token to get cookies
-func (j *Jenkins) Login(osoToken string) (status int, cookie []*http.Cookie, err error) {
+func (j *Jenkins) Login(ctx context.Context, osoToken string) (status int, cookie []*http.Cookie, err error) {
+	ctx, span := tracing.Start(ctx, "jenkins.Login", tracing.Namespace(j.info.NS), tracing.Cluster(j.info.ClusterURL))
+	defer func(start time.Time) {
+		metric.DefaultRecorder().RecordUpstreamLatency(metric.UpstreamJenkins, time.Since(start), err)
+		tracing.End(span, err)
+	}(time.Now())
 
 	jenkinsURL := fmt.Sprintf("%s://%s/securityRealm/commenceLogin?from=%%2F", j.info.Scheme, j.info.Route)
 
-	req, _ := http.NewRequest("GET", jenkinsURL, nil)
+	req, err := http.NewRequest("GET", jenkinsURL, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req = req.WithContext(ctx)
+	requestid.Propagate(req)
+	tracing.Inject(req)
 	if len(osoToken) > 0 {
 		j.logger.WithField("ns", j.info.NS).Infof("Jenkins login for %s", jenkinsURL)
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", osoToken))
@@ -116,19 +139,22 @@ func (j *Jenkins) Login(osoToken string) (status int, cookie []*http.Cookie, err
 }
 
 // State returns state of Jenkins associated with given namespace
-func (j *Jenkins) State() (idler.PodState, error) {
-	return j.idler.State(j.info.NS, j.info.ClusterURL)
+func (j *Jenkins) State(ctx context.Context) (idler.PodState, error) {
+	return j.idler.State(ctx, j.info.NS, j.info.ClusterURL)
 }
 
 // Start unidles Jenkins only if it is idled and returns the
 // state of the pod, the http status of calling unidle, and error if any
-func (j *Jenkins) Start() (state idler.PodState, code int, err error) {
+func (j *Jenkins) Start(ctx context.Context) (state idler.PodState, code int, err error) {
 	// Assume pods are starting and unidle only if it is in "idled" state
 	code = http.StatusAccepted
 	ns := j.info.NS
 	clusterURL := j.info.ClusterURL
 
-	state, err = j.idler.State(ns, clusterURL)
+	ctx, span := tracing.Start(ctx, "jenkins.Start", tracing.Namespace(ns), tracing.Cluster(clusterURL))
+	defer func() { tracing.End(span, err) }()
+
+	state, err = j.idler.State(ctx, ns, clusterURL)
 	if err != nil {
 		return
 	}
@@ -137,7 +163,7 @@ func (j *Jenkins) Start() (state idler.PodState, code int, err error) {
 	if state == idler.Idled {
 		// Unidle only if needed
 		j.logger.Infof("Unidling jenkins")
-		if code, err = j.idler.UnIdle(ns, clusterURL); err != nil {
+		if code, err = j.idler.UnIdle(ctx, ns, clusterURL); err != nil {
 			return
 		}
 	}
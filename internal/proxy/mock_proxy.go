@@ -5,12 +5,11 @@ import (
 	"time"
 
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/auth"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/cache"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tenant"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/wit"
-
-	cache "github.com/patrickmn/go-cache"
 )
 
 // NewMock returns an instance of proxy object that uses mocked dependency services
@@ -21,19 +20,28 @@ func NewMock(jenkinsState idler.PodState, ownedBy string) *Proxy {
 	}
 	auth.SetDefaultClient(auth.NewMockAuth("http://authURL"))
 
+	idlerService := idler.NewMock("", jenkinsState, false)
 	return &Proxy{
-		tenant: &tenant.Mock{},
-		idler:  idler.NewMock("", jenkinsState, false),
+		tenant:      &tenant.Mock{},
+		idler:       idlerService,
+		watcher:     idler.NewWatcher(idlerService, time.Second),
+		replayNow:   make(chan string, replayNowBuffer),
+		replicaID:   "mock",
+		replayLease: 5 * time.Minute,
 		wit: &wit.Mock{
 			OwnedBy: ownedBy,
 		},
 		clusters: map[string]string{
 			"Valid_OpenShift_API_URL": "test_route",
 		},
-		ProxyCache:     cache.New(15*time.Minute, 10*time.Minute),
-		TenantCache:    cache.New(30*time.Minute, 40*time.Minute),
-		redirect:       "http://redirect",
-		storageService: &storage.Mock{},
-		visitLock:      &sync.Mutex{},
+		ProxyCache:       recordLookups("sessions", cache.NewMemory(15*time.Minute, 10*time.Minute)),
+		TenantCache:      recordLookups("tenants", cache.NewMemory(30*time.Minute, 10*time.Minute)),
+		deliveryCache:    cache.NewMemory(time.Hour, 10*time.Minute),
+		redirect:         "http://redirect",
+		storageService:   &storage.Mock{},
+		visitLock:        &sync.Mutex{},
+		tuningLock:       &sync.RWMutex{},
+		readinessHistory: 10,
+		readinessTimeout: 30 * time.Minute,
 	}
 }
@@ -4,12 +4,10 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
-	"hash/fnv"
-
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/cache"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/configuration"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
@@ -17,10 +15,12 @@ import (
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/proxy/reverseproxy"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tenant"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tracing"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/wit"
-	"github.com/patrickmn/go-cache"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -32,24 +32,29 @@ const (
 
 var proxyLogger = log.WithFields(log.Fields{"component": "proxy"})
 
-// Recorder to capture events
-var Recorder = metric.PrometheusRecorder{}
-
 //Proxy handles requests, verifies authentication and proxies to Jenkins.
-//If the request comes from Github, it buffers it and replays if Jenkins
-//is not available.
+//If the request is a webhook (GitHub, GitLab, Bitbucket, ...), it buffers
+//it and replays if Jenkins is not available.
 type Proxy struct {
 	//TenantCache is used as a temporary cache to optimize number of requests
 	//going to tenant and wit services
-	TenantCache *cache.Cache
+	TenantCache cache.Cache
 
 	//ProxyCache is used as a cache for session ids passed by Jenkins in cookies
-	ProxyCache       *cache.Cache
+	ProxyCache       cache.Cache
 	visitLock        *sync.Mutex
 	bufferCheckSleep time.Duration
+	replayWorkers    int
+	retryBackoff     time.Duration
+	maxRetryBackoff  time.Duration
 	tenant           tenant.Service
 	wit              wit.Service
 	idler            idler.Service
+	watcher          *idler.Watcher
+	replayNow        chan string
+	//replicaID identifies this replica in the leases of the buffered requests it replays
+	replicaID   string
+	replayLease time.Duration
 	//redirect is a base URL of the proxy
 	redirect        string
 	responseTimeout time.Duration
@@ -58,11 +63,32 @@ type Proxy struct {
 	indexPath       string
 	maxRequestRetry int
 	clusters        map[string]string
+	//webhookSecret verifies webhooks of repositories not listed in webhookSecrets, which is keyed by normalized repository URL
+	webhookSecret  string
+	webhookSecrets map[string]string
+	eventPolicy    EventPolicy
+	//deliveryCache holds IDs of webhook deliveries forwarded within the delivery window
+	deliveryCache cache.Cache
+	//readinessHistory is how many time-to-ready measurements are kept per namespace
+	readinessHistory int
+	readinessTimeout time.Duration
+	//tuningLock guards the settings changed by Reconfigure while the proxy runs
+	tuningLock *sync.RWMutex
+}
+
+// tuning are the settings of the proxy which may be reconfigured while it runs.
+type tuning struct {
+	responseTimeout  time.Duration
+	maxRequestRetry  int
+	bufferCheckSleep time.Duration
+	retryBackoff     time.Duration
+	maxRetryBackoff  time.Duration
+	replayLease      time.Duration
 }
 
 // New creates an instance of Proxy client
 func New(
-	idler idler.Service,
+	idlerService idler.Service,
 	tenant tenant.Service,
 	wit wit.Service,
 	storageService storage.Store,
@@ -70,13 +96,18 @@ func New(
 	clusters map[string]string) (Proxy, error) {
 
 	p := Proxy{
-		TenantCache:      cache.New(30*time.Minute, 40*time.Minute),
-		ProxyCache:       cache.New(15*time.Minute, 10*time.Minute),
 		visitLock:        &sync.Mutex{},
 		tenant:           tenant,
 		wit:              wit,
-		idler:            idler,
-		bufferCheckSleep: 30 * time.Second,
+		idler:            idlerService,
+		bufferCheckSleep: config.GetReplayInterval(),
+		replayWorkers:    config.GetReplayWorkers(),
+		retryBackoff:     config.GetReplayBackoff(),
+		maxRetryBackoff:  config.GetReplayMaxBackoff(),
+		watcher:          idler.NewWatcher(idlerService, config.GetReplayWatchInterval()),
+		replayNow:        make(chan string, replayNowBuffer),
+		replicaID:        newReplicaID(),
+		replayLease:      config.GetReplayLease(),
 		redirect:         config.GetRedirectURL(),
 		responseTimeout:  config.GetGatewayTimeout(),
 		authURL:          config.GetAuthURL(),
@@ -84,30 +115,62 @@ func New(
 		indexPath:        config.GetIndexPath(),
 		maxRequestRetry:  config.GetMaxRequestRetry(),
 		clusters:         clusters,
+		webhookSecret:    config.GetWebhookSecret(),
+		webhookSecrets:   webhookSecretsByRepository(config.GetWebhookSecrets()),
+		readinessHistory: config.GetReadinessHistory(),
+		readinessTimeout: config.GetReadinessTimeout(),
+		tuningLock:       &sync.RWMutex{},
+	}
+
+	eventPolicy, err := NewEventPolicy(config.GetWebhookEventPolicy(), config.GetWebhookEventActions(), config.GetWebhookBranches())
+	if err != nil {
+		return p, err
+	}
+	p.eventPolicy = eventPolicy
+
+	p.replayLease = leaseFor(p.replayLease, p.responseTimeout)
+
+	if p.TenantCache, err = newCache(config, storageService, "tenants", config.GetTenantCacheTTL()); err != nil {
+		return p, err
+	}
+	if p.ProxyCache, err = newCache(config, storageService, "sessions", config.GetSessionCacheTTL()); err != nil {
+		return p, err
+	}
+	if window := config.GetWebhookDeliveryWindow(); window > 0 {
+		if p.deliveryCache, err = newCache(config, storageService, "deliveries", window); err != nil {
+			return p, err
+		}
 	}
 
 	//Initialize metrics
-	Recorder.Initialize()
+	metric.DefaultRecorder().Initialize()
 
-	//Spawn a routine to process buffered requests
-	go func() {
-		p.ProcessBuffer()
-	}()
 	return p, nil
 }
 
 //Handle handles requests coming to the proxy and performs action based on
 //the type of request and state of Jenkins.
 func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
-	isGH := p.isGitHubRequest(r)
+	provider := detectWebhookProvider(r)
+	isWebhook := provider != nil
 	var requestType string
-	if isGH {
-		requestType = "GitHub"
+	if isWebhook {
+		requestType = provider.Name()
 	} else {
 		requestType = "Jenkins UI"
 	}
 
-	Recorder.RecordReqByTypeTotal(requestType)
+	metric.DefaultRecorder().RecordReqByTypeTotal(requestType)
+
+	// The request ID is forwarded to Jenkins and upstream services, and returned to the client
+	r, requestID := requestid.Accept(w, r)
+
+	// The span covers the whole request, continuing the trace of the client if it sent one
+	ctx, span := tracing.Start(tracing.Extract(r), "proxy.Handle",
+		attribute.String("proxy.request_type", requestType),
+		attribute.String("proxy.request_id", requestID))
+	defer span.End()
+	r = r.WithContext(ctx)
 
 	// store copy of the actual url so that it can be passed to reverse-proxy
 	// to force refreshing by redirecting to the actual url
@@ -115,10 +178,9 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 
 	requestURL := logging.RequestMethodAndURL(r)
 	requestHeaders := logging.RequestHeaders(r)
-	requestHash := p.createRequestHash(requestURL, requestHeaders)
-	logEntryWithHash := proxyLogger.WithField("request-hash", requestHash)
+	requestLogger := proxyLogger.WithField(requestid.LogField, requestID)
 
-	logEntryWithHash.WithFields(
+	requestLogger.WithFields(
 		log.Fields{
 			"request": requestURL,
 			"header":  requestHeaders,
@@ -132,14 +194,17 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 	// NOTE: Response payload and status codes (including errors) are written
 	// to the ResponseWriter (w) in the called methods
 
-	if isGH {
-		ns, okToForward = p.handleGitHubRequest(w, r, logEntryWithHash)
+	if isWebhook {
+		ns, okToForward = p.handleWebhookRequest(w, r, provider, requestLogger)
 	} else {
-		// If this is no GitHub traffic (e.g. user accessing UI)
-		cacheKey, ns, okToForward = p.handleJenkinsUIRequest(w, r, logEntryWithHash)
-		logEntryWithHash.Infof("returned: |key: %q |ns: %q |fwd: %v|", cacheKey, ns, okToForward)
+		// If this is no webhook traffic (e.g. user accessing UI)
+		cacheKey, ns, okToForward = p.handleJenkinsUIRequest(w, r, requestLogger)
+		requestLogger.Infof("returned: |key: %q |ns: %q |fwd: %v|", logging.RedactCookie(cookieutil.SessionCookie, cacheKey), ns, okToForward)
 	}
 
+	if ns != "" {
+		span.SetAttributes(tracing.Namespace(ns))
+	}
 	if !okToForward {
 		return
 	}
@@ -150,7 +215,7 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	var onError func(http.ResponseWriter, *http.Request, int) error
-	if isGH {
+	if isWebhook {
 		onError = func(rw http.ResponseWriter, req *http.Request, code int) error {
 			return nil
 		}
@@ -161,27 +226,66 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 	// forward request to actual jenkins
 	rp := reverseproxy.NewReverseProxy(
 		actualURL,
-		p.responseTimeout,
+		p.tuned().responseTimeout,
 		onError,
-		logEntryWithHash,
+		requestLogger,
 	)
+	if isWebhook {
+		rp.OnResponse = p.rememberAcceptedDelivery(webhookDeliveryID(provider, r))
+	}
+	tracing.Inject(r)
 	rp.ServeHTTP(w, r)
 }
 
-func (p *Proxy) isGitHubRequest(r *http.Request) bool {
-	isGH := false
-	// Is the request coming from Github Webhook?
-	// FIXME - should we only care about push?
-	if ua, exist := r.Header[GHHeader]; exist {
-		isGH = strings.HasPrefix(ua[0], GHAgent)
+// upstreamContext returns the context of the calls to upstream services made while
+// handling a request. They are cancelled once the client goes away or the gateway
+// timeout passed.
+func (p *Proxy) upstreamContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := p.tuned().responseTimeout
+	if timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// Reconfigure applies the settings which may change while the proxy runs: the gateway timeout,
+// the retries and the backoff of buffered requests and how often they are replayed. The replay
+// lease is extended like in New if the gateway timeout grows beyond half of it.
+func (p *Proxy) Reconfigure(config configuration.Configuration) {
+	p.tuningLock.Lock()
+	defer p.tuningLock.Unlock()
+
+	p.responseTimeout = config.GetGatewayTimeout()
+	p.maxRequestRetry = config.GetMaxRequestRetry()
+	p.bufferCheckSleep = config.GetReplayInterval()
+	p.retryBackoff = config.GetReplayBackoff()
+	p.maxRetryBackoff = config.GetReplayMaxBackoff()
+	p.replayLease = leaseFor(config.GetReplayLease(), p.responseTimeout)
+}
+
+// leaseFor returns the replay lease, extended to twice the gateway timeout if shorter. A lease
+// must outlast at least one replay, which may take up to the gateway timeout.
+func leaseFor(lease time.Duration, timeout time.Duration) time.Duration {
+	if minLease := 2 * timeout; lease < minLease {
+		proxyLogger.Warnf("Replay lease %s is shorter than twice the gateway timeout, using %s", lease, minLease)
+		return minLease
 	}
-	return isGH
+	return lease
 }
 
-func (p *Proxy) createRequestHash(url string, headers string) uint32 {
-	h := fnv.New32a()
-	h.Write([]byte(url + headers + fmt.Sprint(time.Now())))
-	return h.Sum32()
+// tuned returns the current settings which may be reconfigured while the proxy runs.
+func (p *Proxy) tuned() tuning {
+	p.tuningLock.RLock()
+	defer p.tuningLock.RUnlock()
+
+	return tuning{
+		responseTimeout:  p.responseTimeout,
+		maxRequestRetry:  p.maxRequestRetry,
+		bufferCheckSleep: p.bufferCheckSleep,
+		retryBackoff:     p.retryBackoff,
+		maxRetryBackoff:  p.maxRetryBackoff,
+		replayLease:      p.replayLease,
+	}
 }
 
 //RecordStatistics writes usage statistics to a database
@@ -231,12 +335,16 @@ func (p *Proxy) invalidateSession(w http.ResponseWriter, sessionCookies []*http.
 		var pci CacheItem
 
 		cacheKey := cookie.Value
-		cacheVal, ok := p.ProxyCache.Get(cacheKey)
+		ok, err := p.ProxyCache.Get(cacheKey, &pci)
+		if err != nil {
+			proxyLogger.Errorf("Could not look up session in cache: %s", err)
+		}
 		if ok {
-			pci = cacheVal.(CacheItem)
-			p.ProxyCache.Delete(cacheKey)
+			if err := p.ProxyCache.Delete(cacheKey); err != nil {
+				proxyLogger.Errorf("Could not remove session from cache: %s", err)
+			}
 
-			proxyLogger.Infof("clearing cache for namespace: %s, cache_key: %s", pci.NS, cacheKey)
+			proxyLogger.Infof("clearing cache for namespace: %s, cache_key: %s", pci.NS, logging.RedactCookie(cookie.Name, cacheKey))
 		}
 
 		cookieutil.ExpireCookie(w, cookie)
@@ -289,7 +397,7 @@ func (p *Proxy) OnErrorUIRequest(rw http.ResponseWriter, req *http.Request, code
 		return nil
 	}
 
-	valid, err := checkSessionValidity(req, sessionCookies[0], p.responseTimeout)
+	valid, err := checkSessionValidity(req, sessionCookies[0], p.tuned().responseTimeout)
 	if err != nil {
 		return err
 	}
@@ -1,5 +1,15 @@
 package proxy
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/cache"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/configuration"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+)
+
 // CacheItem represents a cache item  consisting of cluster URL, namespace, route, scheme(HTTP, HTTPS etc).
 type CacheItem struct {
 	ClusterURL string
@@ -17,3 +27,39 @@ func NewCacheItem(ns string, scheme string, route string, clusterURL string) Cac
 		ClusterURL: clusterURL,
 	}
 }
+
+// newCache creates the named cache of the configured cache backend. Postgres caches are
+// kept in the database of the store, so that sessions issued by one replica are known to all.
+func newCache(config configuration.Configuration, store storage.Store, name string, ttl time.Duration) (cache.Cache, error) {
+	switch config.GetCacheBackend() {
+	case configuration.CachePostgres:
+		dbStore, ok := store.(*storage.DBStore)
+		if !ok {
+			return nil, fmt.Errorf("cache backend %s needs storage backend %s", configuration.CachePostgres, configuration.StoragePostgres)
+		}
+		return recordLookups(name, dbStore.NewCache(name, ttl, config.GetCacheCleanupInterval())), nil
+	case configuration.CacheLRU:
+		return recordLookups(name, cache.NewLRU(config.GetCacheSize(), ttl)), nil
+	default:
+		return recordLookups(name, cache.NewMemory(ttl, config.GetCacheCleanupInterval())), nil
+	}
+}
+
+// recordedCache records whether lookups in the named cache hit or missed.
+type recordedCache struct {
+	cache.Cache
+	name string
+}
+
+func recordLookups(name string, c cache.Cache) cache.Cache {
+	return recordedCache{Cache: c, name: name}
+}
+
+// Get decodes the value of the given key into value. Failed lookups are neither hits nor misses.
+func (c recordedCache) Get(key string, value interface{}) (bool, error) {
+	found, err := c.Cache.Get(key, value)
+	if err == nil {
+		metric.DefaultRecorder().RecordCacheLookup(c.name, found)
+	}
+	return found, err
+}
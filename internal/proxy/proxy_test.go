@@ -1,13 +1,22 @@
 package proxy
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"errors"
 
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/cache"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/configuration"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tracing"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/wit"
-	cache "github.com/patrickmn/go-cache"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -16,7 +25,7 @@ type mockWit struct {
 	testCounter int // we will use this to count how many times this we get there
 }
 
-func (mw *mockWit) SearchCodebase(repo string) (*wit.Info, error) {
+func (mw *mockWit) SearchCodebase(ctx context.Context, repo string) (*wit.Info, error) {
 	mw.testCounter++
 	return &wit.Info{
 		OwnedBy: "Faker",
@@ -35,10 +44,107 @@ func TestGetUserWithRetry(t *testing.T) {
 	numberofretry := 1
 
 	logEntry := log.WithFields(log.Fields{"component": "proxy"})
-	cache := cache.New(2*time.Millisecond, 1*time.Millisecond)
-	p.TenantCache = cache
+	p.TenantCache = cache.NewMemory(2*time.Millisecond, 1*time.Millisecond)
 
-	_, err := p.getUserWithRetry("http://test", logEntry, numberofretry)
+	_, err := p.getUserWithRetry(context.Background(), "http://test", logEntry, numberofretry)
 	assert.Error(t, err, "Faker")
 	assert.Equal(t, numberofretry, wit.testCounter)
 }
+
+func TestGetUserWithRetryStopsWhenCancelled(t *testing.T) {
+	wit := &mockWit{testCounter: 0}
+
+	p := &fakeProxy{}
+	p.wit = wit
+	p.TenantCache = cache.NewMemory(2*time.Millisecond, 1*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := p.getUserWithRetry(ctx, "http://test", proxyLogger, 5)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, wit.testCounter, "Cancelled lookup should not be retried")
+}
+
+func TestCacheBackends(t *testing.T) {
+	config := configuration.NewMock()
+
+	c, err := newCache(&config, &storage.Mock{}, "sessions", time.Minute)
+	assert.NoError(t, err)
+	assert.IsType(t, &cache.Memory{}, c.(recordedCache).Cache)
+
+	config.CacheBackend = configuration.CacheLRU
+	c, err = newCache(&config, &storage.Mock{}, "sessions", time.Minute)
+	assert.NoError(t, err)
+	assert.IsType(t, &cache.LRU{}, c.(recordedCache).Cache)
+
+	config.CacheBackend = configuration.CachePostgres
+	_, err = newCache(&config, storage.NewMemoryStore(), "sessions", time.Minute)
+	assert.Error(t, err, "Postgres cache should need a DB store.")
+}
+
+func TestCacheLookupsAreRecorded(t *testing.T) {
+	defer metric.SetDefaultRecorder(metric.DefaultRecorder())
+	recorder := metric.NewMock()
+	metric.SetDefaultRecorder(recorder)
+
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	for i := 0; i < 3; i++ {
+		_, err := p.getUser(context.Background(), "https://github.com/owner/repo.git", proxyLogger)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, float64(1), recorder.Value("cache_lookups_total", "tenants", "miss"))
+	assert.Equal(t, float64(2), recorder.Value("cache_lookups_total", "tenants", "hit"))
+}
+
+// cached returns true if the key is in the cache
+func cached(c cache.Cache, key string) bool {
+	var value interface{}
+	found, _ := c.Get(key, &value)
+	return found
+}
+
+func TestHandleKeepsRequestID(t *testing.T) {
+	p := NewMock(idler.Idled, wit.DefaultMockOwner)
+	store := &deliveryStore{deliveries: map[string]*storage.Request{}}
+	p.storageService = store
+
+	req := ghDelivery("72d3162e-cc78-11e3-81ab-4c9367dc0958")
+	req.Header.Set(requestid.Header, "support-42")
+	w := httptest.NewRecorder()
+	p.Handle(w, req)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "support-42", w.Header().Get(requestid.Header), "Request ID should be returned")
+	if assert.Len(t, store.deliveries, 1, "The delivery should have been buffered") {
+		assert.Equal(t, "support-42", store.deliveries["72d3162e-cc78-11e3-81ab-4c9367dc0958"].RequestID,
+			"Request ID should be stored for the replay")
+	}
+
+	w = httptest.NewRecorder()
+	p.Handle(w, ghDelivery("b"))
+	assert.True(t, requestid.Valid(w.Header().Get(requestid.Header)), "Request ID should have been generated")
+}
+
+func TestHandleIsTraced(t *testing.T) {
+	exporter, restore := tracing.NewInMemory()
+	defer restore()
+
+	p := NewMock(idler.Idled, wit.DefaultMockOwner)
+	p.storageService = &deliveryStore{deliveries: map[string]*storage.Request{}}
+
+	w := httptest.NewRecorder()
+	p.Handle(w, ghDelivery("72d3162e-cc78-11e3-81ab-4c9367dc0958"))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	assert.Equal(t, []string{"proxy.GetJenkins", "jenkins.Start", "proxy.Handle"}, tracing.SpanNames(exporter))
+	spans := exporter.GetSpans()
+	if assert.Len(t, spans, 3) {
+		handle := spans[2]
+		for _, span := range spans[:2] {
+			assert.Equal(t, handle.SpanContext.SpanID(), span.Parent.SpanID(), "%s should be nested in the handling of the request", span.Name)
+			assert.Contains(t, span.Attributes, tracing.Namespace("namespace-jenkins"))
+		}
+		assert.Contains(t, handle.Attributes, tracing.Namespace("namespace-jenkins"))
+	}
+}
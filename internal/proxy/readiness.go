@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// startJenkins starts Jenkins like Jenkins.Start does. If Jenkins was idled, it also starts
+// measuring how long Jenkins takes to be ready. trigger is what made Jenkins start, one of
+// metric.TriggerUI or metric.TriggerWebhook.
+func (p *Proxy) startJenkins(ctx context.Context, jenkins *Jenkins, trigger string) (idler.PodState, int, error) {
+	state, code, err := jenkins.Start(ctx)
+	if err == nil && state == idler.Idled && code != http.StatusServiceUnavailable {
+		p.jenkinsUnidled(jenkins.info, trigger, jenkins.logger)
+	}
+	return state, code, err
+}
+
+// jenkinsUnidled records when Jenkins of a namespace was unidled. Only the first unidle counts
+// while Jenkins is not ready yet, unless it was waited for longer than the readiness timeout.
+func (p *Proxy) jenkinsUnidled(info CacheItem, trigger string, logger *log.Entry) {
+	r := storage.NewReadiness(info.NS, info.ClusterURL, trigger)
+	started, err := p.storageService.StartReadiness(r, r.UnidledAt.Add(-p.readinessTimeout))
+	if err != nil {
+		logger.Errorf("Could not record unidle of Jenkins: %s", err)
+		return
+	}
+	if started {
+		logger.WithField("trigger", trigger).Info("Waiting for unidled Jenkins to be ready")
+	}
+}
+
+// jenkinsReady records that Jenkins of a namespace is running or served a login. If Jenkins
+// was waited for since it was unidled, the time it took to be ready is recorded.
+func (p *Proxy) jenkinsReady(ns string, logger *log.Entry) {
+	r, err := p.storageService.FinishReadiness(ns, time.Now(), p.readinessHistory)
+	if err != nil {
+		logger.Errorf("Could not record readiness of Jenkins: %s", err)
+		return
+	}
+	if r == nil {
+		return
+	}
+	logger.WithField("trigger", r.Trigger).Infof("Jenkins was ready %s after it was unidled", r.Duration())
+	metric.DefaultRecorder().RecordTimeToReady(r.Cluster, r.Trigger, r.Duration())
+}
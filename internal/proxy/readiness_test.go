@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/wit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeToReadyIsMeasuredFromFirstUnidle(t *testing.T) {
+	defer metric.SetDefaultRecorder(metric.DefaultRecorder())
+	recorder := metric.NewMock()
+	metric.SetDefaultRecorder(recorder)
+
+	p := NewMock(idler.Idled, wit.DefaultMockOwner)
+	store := storage.NewMemoryStore()
+	p.storageService = store
+
+	for _, id := range []string{"72d3162e-cc78-11e3-81ab-4c9367dc0958", "72d3162e-cc78-11e3-81ab-4c9367dc0959"} {
+		w := httptest.NewRecorder()
+		p.Handle(w, ghDelivery(id))
+		require.Equal(t, http.StatusAccepted, w.Code)
+	}
+
+	measurements, err := store.GetReadiness("namespace-jenkins")
+	require.NoError(t, err)
+	require.Len(t, measurements, 1, "Only the first unidle should be measured")
+	assert.Equal(t, metric.TriggerWebhook, measurements[0].Trigger)
+	assert.Nil(t, measurements[0].ReadyAt)
+
+	p.jenkinsReady("namespace-jenkins", proxyLogger)
+	p.jenkinsReady("namespace-jenkins", proxyLogger)
+
+	measurements, err = store.GetReadiness("namespace-jenkins")
+	require.NoError(t, err)
+	require.Len(t, measurements, 1)
+	assert.NotNil(t, measurements[0].ReadyAt)
+	assert.Equal(t, float64(1), recorder.Value("time_to_ready_seconds", "Valid_OpenShift_API_URL", metric.TriggerWebhook),
+		"Readiness should be recorded once")
+}
+
+func TestRunningJenkinsIsNotMeasured(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	store := storage.NewMemoryStore()
+	p.storageService = store
+
+	jenkins := &Jenkins{info: CacheItem{NS: "namespace-jenkins", ClusterURL: "Valid_OpenShift_API_URL"}, idler: p.idler, logger: proxyLogger}
+	state, _, err := p.startJenkins(context.Background(), jenkins, metric.TriggerUI)
+	require.NoError(t, err)
+	assert.Equal(t, idler.PodState(idler.Running), state)
+
+	measurements, err := store.GetReadiness("namespace-jenkins")
+	require.NoError(t, err)
+	assert.Len(t, measurements, 0, "Running Jenkins was not unidled")
+}
@@ -0,0 +1,384 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tracing"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// replayNowBuffer is how many namespaces can wait to be replayed on demand
+const replayNowBuffer = 16
+
+var replayLogger = log.WithFields(log.Fields{"component": "replay"})
+
+// ProcessBuffer replays buffered webhook requests until the context is cancelled.
+// Each namespace with buffered requests is handed to one of the replay workers,
+// which replays its requests in the order they were buffered. A namespace is
+// never replayed by two workers at once, so a slow namespace only blocks itself;
+// one signalled while being replayed is replayed again once its worker is done.
+// Namespaces are replayed as soon as the watcher sees their Jenkins running, and
+// all of them are checked every bufferCheckSleep in case a signal was missed.
+func (p *Proxy) ProcessBuffer(ctx context.Context) {
+	queue := newReplayQueue()
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.watcher.Run(ctx)
+	}()
+
+	workers := p.replayWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				ns, ok := queue.next()
+				if !ok {
+					return
+				}
+				p.replayNamespace(ctx, ns)
+				queue.done(ns)
+			}
+		}()
+	}
+
+	replayLogger.Infof("Replaying buffered requests with %d workers", workers)
+	defer func() {
+		queue.close()
+		wg.Wait()
+		replayLogger.Info("Stopped replaying buffered requests")
+	}()
+
+	for {
+		namespaces, err := p.storageService.GetUsers()
+		if err != nil {
+			replayLogger.Error(err)
+		} else {
+			p.recordBufferedRequests(namespaces)
+		}
+		for _, ns := range namespaces {
+			queue.add(ns)
+		}
+
+		timer := time.NewTimer(p.tuned().bufferCheckSleep)
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case ns := <-p.watcher.Running():
+				replayLogger.WithField("ns", ns).Info("Replaying requests of running Jenkins")
+				p.jenkinsReady(ns, replayLogger.WithField("ns", ns))
+				queue.add(ns)
+			case ns := <-p.replayNow:
+				replayLogger.WithField("ns", ns).Info("Replaying requests on demand")
+				queue.add(ns)
+			case <-timer.C:
+				break wait
+			}
+		}
+	}
+}
+
+// recordBufferedRequests records how many requests are buffered for each of the given namespaces.
+func (p *Proxy) recordBufferedRequests(namespaces []string) {
+	counts := make(map[string]int, len(namespaces))
+	for _, ns := range namespaces {
+		count, err := p.storageService.GetRequestsCount(ns)
+		if err != nil {
+			replayLogger.WithField("ns", ns).Errorf("Could not count buffered requests: %s", err)
+			return
+		}
+		if count > 0 {
+			counts[ns] = count
+		}
+	}
+	metric.DefaultRecorder().RecordBufferedRequests(counts)
+}
+
+// Replay asks for the buffered requests of a namespace to be replayed right away.
+// It never blocks; if too many namespaces are waiting already, the namespace is
+// replayed with the next periodic check instead.
+func (p *Proxy) Replay(ns string) {
+	select {
+	case p.replayNow <- ns:
+	default:
+		replayLogger.WithField("ns", ns).Warn("Too many namespaces waiting to be replayed, replaying with the next check")
+	}
+}
+
+// newReplicaID returns an ID of this process which is unique among the replicas
+// sharing the store
+func newReplicaID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + "-" + uuid.NewV4().String()
+}
+
+// replayNamespace replays the buffered requests of a namespace in order. It stops
+// at the first request which cannot be replayed yet, so that later requests
+// never overtake it.
+// The requests are leased to this replica while they are replayed, so that other
+// replicas sharing the store leave them alone. If a replica crashes, its lease
+// expires and the requests are replayed by another one.
+func (p *Proxy) replayNamespace(ctx context.Context, ns string) {
+	nsLogger := replayLogger.WithField("ns", ns)
+
+	lease := p.tuned().replayLease
+	leaseEnd := time.Now().Add(lease)
+	requests, err := p.storageService.ClaimRequests(ns, p.replicaID, lease)
+	if err != nil {
+		nsLogger.Error(err)
+		return
+	}
+	if len(requests) == 0 {
+		return
+	}
+	defer func() {
+		if err := p.storageService.ReleaseRequests(ns, p.replicaID); err != nil {
+			nsLogger.Errorf("Could not release requests: %s", err)
+		}
+	}()
+
+	for _, r := range requests {
+		if ctx.Err() != nil {
+			return
+		}
+
+		//Leave the remaining requests to the next round rather than replay them after the lease expired
+		if time.Until(leaseEnd) < p.tuned().responseTimeout {
+			nsLogger.Info("Replay lease expires soon, replaying the remaining requests with the next round")
+			p.Replay(ns)
+			return
+		}
+
+		//Later requests must not overtake a request which is backing off
+		if !r.Due(time.Now()) {
+			return
+		}
+
+		if !p.replayRequest(ctx, r, leaseEnd, nsLogger) {
+			return
+		}
+	}
+}
+
+// replayRequest replays a buffered request before the lease of its namespace ends.
+// It returns whether the next request of the namespace may be replayed.
+func (p *Proxy) replayRequest(ctx context.Context, r storage.Request, leaseEnd time.Time, nsLogger *log.Entry) bool {
+	reqCtx, reqLogger := replayContext(ctx, r, nsLogger)
+	reqCtx, span := tracing.Start(reqCtx, "proxy.Replay",
+		tracing.Namespace(r.Namespace),
+		attribute.String("proxy.request_id", r.RequestID),
+		attribute.Int("proxy.retries", r.Retries))
+	defer span.End()
+
+	if r.Retries >= p.tuned().maxRequestRetry {
+		p.deadLetter(&r, reqLogger)
+		return true
+	}
+
+	repositoryURL, err := bufferedRepositoryURL(r)
+	if err != nil {
+		tracing.Fail(span, err)
+		reqLogger.Error(err)
+		return false
+	}
+
+	reqLogger.WithFields(log.Fields{"repository": repositoryURL}).Info("Retrying request")
+	namespace, err := p.getUserWithRetry(reqCtx, repositoryURL, reqLogger, defaultRetry)
+	if err != nil {
+		tracing.Fail(span, err)
+		reqLogger.Error(err)
+		return false
+	}
+	span.SetAttributes(tracing.Cluster(namespace.ClusterURL))
+	pci := CacheItem{
+		NS:         namespace.Name,
+		ClusterURL: namespace.ClusterURL,
+	}
+
+	jenkins, _, err := GetJenkins(reqCtx, p.clusters, &pci, p.idler, p.tenant, "", reqLogger)
+	if err != nil {
+		tracing.Fail(span, err)
+		reqLogger.Error(err)
+		return false
+	}
+
+	state, err := jenkins.State(reqCtx)
+	if err != nil {
+		tracing.Fail(span, err)
+		reqLogger.Error(err)
+		return false
+	}
+	err = p.recordStatistics(r.Namespace, 0, time.Now().Unix())
+	if err != nil {
+		reqLogger.Error(err)
+	}
+
+	//Do not try other requests for user if Jenkins is not running, but replay them once it is
+	if state != idler.Running {
+		span.SetAttributes(attribute.String("jenkins.state", string(state)))
+		p.watcher.Watch(r.Namespace, namespace.ClusterURL)
+		return false
+	}
+
+	req, err := r.GetHTTPRequest()
+	if err != nil {
+		tracing.Fail(span, err)
+		reqLogger.Errorf("Could not format request %s (%s): %s - deleting", r.ID, r.Namespace, err)
+		metric.DefaultRecorder().RecordReplayOutcome(metric.ReplayDropped)
+		p.deleteBufferedRequest(&r)
+		return false
+	}
+
+	deliveryID := bufferedDeliveryID(r)
+	if p.deliveryForwarded(deliveryID) {
+		reqLogger.WithField("delivery", deliveryID).Infof("Delivery of request %s already forwarded - deleting", r.ID)
+		metric.DefaultRecorder().RecordReplayOutcome(metric.ReplayDropped)
+		p.deleteBufferedRequest(&r)
+		return true
+	}
+
+	//No replica may claim the request before its replay is done
+	replayCtx, cancel := context.WithDeadline(reqCtx, leaseEnd)
+	defer cancel()
+	req = req.WithContext(replayCtx)
+	requestid.Propagate(req)
+	tracing.Inject(req)
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	metric.DefaultRecorder().RecordUpstreamLatency(metric.UpstreamJenkins, time.Since(start), err)
+	if err != nil {
+		if ctx.Err() != nil {
+			//Interrupted by shutdown, which is no failure of the request
+			return false
+		}
+		tracing.Fail(span, err)
+		reqLogger.Error("Error: ", err)
+		p.retryLater(&r, 0, err.Error(), reqLogger)
+		return false
+	}
+	resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+
+	if resp.StatusCode == 200 {
+		reqLogger.Infof("Request to %q forwarded.", req.Host)
+		metric.DefaultRecorder().RecordReplayOutcome(metric.ReplayForwarded)
+		p.rememberDelivery(deliveryID)
+	} else if resp.StatusCode == 404 || resp.StatusCode == 400 {
+		reqLogger.Warnf("Got status %q after retrying request on %s, throwing away the request", resp.Status, logging.RedactURL(req.URL))
+		metric.DefaultRecorder().RecordReplayOutcome(metric.ReplayDropped)
+	} else {
+		//Retry later if the response is not 200 or 400 or 404
+		tracing.Fail(span, fmt.Errorf("got status %q", resp.Status))
+		reqLogger.Errorf("Got status %q after retrying request on %s", resp.Status, logging.RedactURL(req.URL))
+		p.retryLater(&r, resp.StatusCode, fmt.Sprintf("got status %q", resp.Status), reqLogger)
+		return false
+	}
+
+	// Deleting request since the replay was successful with 200
+	// or request was failed with 404 or 400
+	p.deleteBufferedRequest(&r)
+	return true
+}
+
+// replayContext returns the context and logger of the replay of a request, which carry
+// the ID of the request which buffered it. Requests buffered before their ID was
+// recorded get a new one for every replay.
+func replayContext(ctx context.Context, r storage.Request, logger *log.Entry) (context.Context, *log.Entry) {
+	id := r.RequestID
+	if id == "" {
+		id = requestid.New()
+	}
+	return requestid.NewContext(ctx, id), logger.WithField(requestid.LogField, id)
+}
+
+// retryLater records a failed replay of a request. The request is retried after a backoff
+// which doubles with every retry, or moved to the dead letters once its retries are exhausted.
+func (p *Proxy) retryLater(r *storage.Request, status int, reason string, logger *log.Entry) {
+	r.LastStatus = status
+	r.LastError = reason
+	if r.Retries+1 >= p.tuned().maxRequestRetry {
+		r.Retries++
+		p.deadLetter(r, logger)
+		return
+	}
+
+	next := time.Now().Add(p.backoff(r.Retries))
+	r.NextAttempt = &next
+	for _, e := range p.storageService.IncrementRequestRetry(r) {
+		logger.Error(e)
+	}
+	metric.DefaultRecorder().RecordReplayOutcome(metric.ReplayRetried)
+}
+
+// backoff returns how long to wait before replaying a request which failed
+// the given number of times before, at most maxRetryBackoff.
+func (p *Proxy) backoff(retries int) time.Duration {
+	settings := p.tuned()
+	backoff := settings.retryBackoff
+	for i := 0; i < retries && backoff < settings.maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > settings.maxRetryBackoff {
+		backoff = settings.maxRetryBackoff
+	}
+	return backoff
+}
+
+// deadLetter gives up on replaying a request and moves it to the dead letters,
+// from where operators can inspect and re-enqueue it
+func (p *Proxy) deadLetter(r *storage.Request, logger *log.Entry) {
+	logger.Warnf("Giving up on request %s after %d retries, last error: %s", r.ID, r.Retries, r.LastError)
+	metric.DefaultRecorder().RecordReplayOutcome(metric.ReplayExpired)
+	if err := p.storageService.MoveToDeadLetters(r); err != nil {
+		logger.Errorf("Could not move request %s (%s) to dead letters: %s", r.ID, r.Namespace, err)
+	}
+}
+
+func (p *Proxy) deleteBufferedRequest(r *storage.Request) {
+	if err := p.storageService.DeleteRequest(r); err != nil {
+		replayLogger.Errorf(storage.ErrorFailedDelete, r.ID, r.Namespace, err)
+	}
+}
+
+// bufferedRepositoryURL finds the provider which delivered the buffered
+// request and extracts the repository URL from its payload
+func bufferedRepositoryURL(r storage.Request) (string, error) {
+	req, err := r.GetHTTPRequest()
+	if err != nil {
+		return "", err
+	}
+
+	provider := detectWebhookProvider(req)
+	if provider == nil {
+		return "", fmt.Errorf("could not detect webhook provider of request %s (%s)", r.ID, r.Namespace)
+	}
+	payload, err := r.GetPayload()
+	if err != nil {
+		return "", err
+	}
+	return provider.RepositoryURL(payload)
+}
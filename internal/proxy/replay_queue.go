@@ -0,0 +1,91 @@
+package proxy
+
+import "sync"
+
+// replayState tells whether a namespace is queued or being replayed
+type replayState int
+
+const (
+	replayQueued replayState = iota + 1
+	replayRunning
+	// replayRunningAgain is a namespace which is queued again once its worker is done
+	replayRunningAgain
+)
+
+// replayQueue hands namespaces with buffered requests to the replay workers. Adding a
+// namespace never blocks, so that the replay loop keeps taking signals while all workers
+// are busy. A namespace is queued at most once and never handed to two workers at once.
+type replayQueue struct {
+	lock    sync.Mutex
+	ready   *sync.Cond
+	pending []string
+	// active holds the namespaces which are queued or being replayed
+	active map[string]replayState
+	closed bool
+}
+
+func newReplayQueue() *replayQueue {
+	q := &replayQueue{active: map[string]replayState{}}
+	q.ready = sync.NewCond(&q.lock)
+	return q
+}
+
+// add queues a namespace unless it is queued already. A namespace being replayed is queued
+// again once its worker is done, as requests it was asked for may have been left behind.
+func (q *replayQueue) add(ns string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return
+	}
+	switch q.active[ns] {
+	case replayRunning:
+		q.active[ns] = replayRunningAgain
+	case 0:
+		q.push(ns)
+	}
+}
+
+func (q *replayQueue) push(ns string) {
+	q.active[ns] = replayQueued
+	q.pending = append(q.pending, ns)
+	q.ready.Signal()
+}
+
+// next waits for a queued namespace and hands it to the calling worker. It returns false
+// once the queue is closed.
+func (q *replayQueue) next() (string, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for len(q.pending) == 0 && !q.closed {
+		q.ready.Wait()
+	}
+	if q.closed {
+		return "", false
+	}
+	ns := q.pending[0]
+	q.pending = q.pending[1:]
+	q.active[ns] = replayRunning
+	return ns, true
+}
+
+// done tells that the worker finished replaying the namespace, which is queued again if
+// it was added meanwhile.
+func (q *replayQueue) done(ns string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.active[ns] == replayRunningAgain && !q.closed {
+		q.push(ns)
+		return
+	}
+	delete(q.active, ns)
+}
+
+// close makes the workers stop taking namespaces. Namespaces still queued are left to
+// the next start.
+func (q *replayQueue) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.closed = true
+	q.ready.Broadcast()
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayQueueHandsOutNamespacesOnceInOrder(t *testing.T) {
+	q := newReplayQueue()
+	for _, ns := range []string{"ns-1", "ns-2", "ns-1", "ns-3"} {
+		q.add(ns)
+	}
+
+	var namespaces []string
+	for i := 0; i < 3; i++ {
+		ns, ok := q.next()
+		assert.True(t, ok)
+		namespaces = append(namespaces, ns)
+	}
+	assert.Equal(t, []string{"ns-1", "ns-2", "ns-3"}, namespaces, "namespaces should be handed out once, in the order they were added")
+
+	q.done("ns-1")
+	q.add("ns-1")
+	ns, ok := q.next()
+	assert.True(t, ok)
+	assert.Equal(t, "ns-1", ns, "a replayed namespace should be queued again")
+}
+
+func TestReplayQueueRequeuesNamespaceAddedWhileReplaying(t *testing.T) {
+	q := newReplayQueue()
+	q.add("ns")
+	ns, _ := q.next()
+
+	q.add("ns")
+	q.add("ns")
+	q.done(ns)
+	ns, ok := q.next()
+	assert.True(t, ok)
+	assert.Equal(t, "ns", ns, "a namespace added while being replayed should be queued again once replayed")
+
+	q.done(ns)
+	q.add("other")
+	ns, _ = q.next()
+	assert.Equal(t, "other", ns, "a namespace should be queued again only once")
+}
+
+func TestReplayQueueCloseStopsWaitingWorkers(t *testing.T) {
+	q := newReplayQueue()
+	stopped := make(chan bool)
+	go func() {
+		_, ok := q.next()
+		stopped <- ok
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	q.close()
+	select {
+	case ok := <-stopped:
+		assert.False(t, ok, "no namespace should be handed out once the queue is closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the queue should stop waiting workers")
+	}
+}
@@ -0,0 +1,560 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/configuration"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tracing"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/wit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// eventually polls the condition every tick until it holds, and fails the test if it
+// does not within waitFor
+func eventually(t *testing.T, condition func() bool, waitFor time.Duration, tick time.Duration, msgAndArgs ...interface{}) bool {
+	deadline := time.Now().Add(waitFor)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return assert.Fail(t, "Condition never satisfied", msgAndArgs...)
+		}
+		time.Sleep(tick)
+	}
+	return true
+}
+
+// replayStore holds buffered requests per namespace in memory
+type replayStore struct {
+	storage.Mock
+	lock        sync.Mutex
+	requests    map[string][]storage.Request
+	deadLetters []storage.DeadLetter
+}
+
+func (s *replayStore) GetUsers() ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var namespaces []string
+	for ns, requests := range s.requests {
+		if len(requests) > 0 {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces, nil
+}
+
+func (s *replayStore) GetRequestsCount(ns string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.requests[ns]), nil
+}
+
+func (s *replayStore) GetRequests(ns string) ([]storage.Request, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]storage.Request{}, s.requests[ns]...), nil
+}
+
+func (s *replayStore) ClaimRequests(ns string, owner string, lease time.Duration) ([]storage.Request, error) {
+	return s.GetRequests(ns)
+}
+
+func (s *replayStore) ReleaseRequests(ns string, owner string) error {
+	return nil
+}
+
+func (s *replayStore) DeleteRequest(r *storage.Request) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	requests := s.requests[r.Namespace]
+	for i := range requests {
+		if requests[i].ID == r.ID {
+			s.requests[r.Namespace] = append(requests[:i], requests[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *replayStore) IncrementRequestRetry(r *storage.Request) []error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r.Retries++
+	requests := s.requests[r.Namespace]
+	for i := range requests {
+		if requests[i].ID == r.ID {
+			requests[i] = *r
+		}
+	}
+	return nil
+}
+
+func (s *replayStore) MoveToDeadLetters(r *storage.Request) error {
+	s.DeleteRequest(r)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.deadLetters = append(s.deadLetters, *storage.NewDeadLetter(*r))
+	return nil
+}
+
+func (s *replayStore) dead() []storage.DeadLetter {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]storage.DeadLetter{}, s.deadLetters...)
+}
+
+func (s *replayStore) count(ns string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.requests[ns])
+}
+
+func bufferRequest(t *testing.T, s *replayStore, target string, ns string, path string) {
+	req := httptest.NewRequest("POST", target+path, bytes.NewReader(ghPayload()))
+	req.Header.Set(GHHeader, GHAgent+"/c494ff1")
+	u, _ := url.Parse(target)
+	req.URL.Scheme = u.Scheme
+	req.Host = u.Host
+
+	r, err := storage.NewRequest(req, ns, ghPayload())
+	require.NoError(t, err)
+	s.requests[ns] = append(s.requests[ns], *r)
+}
+
+func TestProcessBufferReplaysNamespacesConcurrentlyAndInOrder(t *testing.T) {
+	release := make(chan struct{})
+	var lock sync.Mutex
+	var replayed []string
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+		lock.Lock()
+		replayed = append(replayed, r.URL.Path)
+		lock.Unlock()
+	}))
+	defer jenkins.Close()
+
+	store := &replayStore{requests: map[string][]storage.Request{}}
+	bufferRequest(t, store, jenkins.URL, "slow-ns", "/slow")
+	for _, path := range []string{"/first", "/second", "/third"} {
+		bufferRequest(t, store, jenkins.URL, "fast-ns", path)
+	}
+
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.storageService = store
+	p.maxRequestRetry = 10
+	p.replayWorkers = 2
+	p.bufferCheckSleep = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.ProcessBuffer(ctx)
+		close(done)
+	}()
+
+	eventually(t, func() bool { return store.count("fast-ns") == 0 }, 10*time.Second, 10*time.Millisecond,
+		"fast namespace should be replayed while the slow one is blocked")
+	assert.Equal(t, 1, store.count("slow-ns"), "slow namespace should still be replaying")
+
+	lock.Lock()
+	assert.Equal(t, []string{"/first", "/second", "/third"}, replayed, "requests should be replayed in order")
+	lock.Unlock()
+
+	close(release)
+	eventually(t, func() bool { return store.count("slow-ns") == 0 }, 10*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProcessBuffer should stop once the context is cancelled")
+	}
+}
+
+func TestProcessBufferStopsWhileReplaying(t *testing.T) {
+	release := make(chan struct{})
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the body is never read, so the server would not notice the client going away
+		<-release
+	}))
+	defer jenkins.Close()
+	defer close(release)
+
+	store := &replayStore{requests: map[string][]storage.Request{}}
+	bufferRequest(t, store, jenkins.URL, "ns", "/blocked")
+
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.storageService = store
+	p.maxRequestRetry = 10
+	p.bufferCheckSleep = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.ProcessBuffer(ctx)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProcessBuffer should stop once the context is cancelled")
+	}
+	assert.Equal(t, 1, store.count("ns"), "the interrupted request should stay buffered")
+}
+
+func TestProcessBufferTakesSignalsWhileWorkersAreBusy(t *testing.T) {
+	release := make(chan struct{})
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer jenkins.Close()
+
+	store := &replayStore{requests: map[string][]storage.Request{}}
+	bufferRequest(t, store, jenkins.URL, "slow-ns", "/slow")
+	bufferRequest(t, store, jenkins.URL, "fast-ns", "/fast")
+
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.storageService = store
+	p.maxRequestRetry = 10
+	p.replayWorkers = 1
+	p.bufferCheckSleep = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.ProcessBuffer(ctx)
+
+	eventually(t, func() bool { return store.count("fast-ns") == 0 || store.count("slow-ns") == 1 }, 5*time.Second, 10*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		p.Replay("fast-ns")
+	}
+	eventually(t, func() bool { return len(p.replayNow) == 0 }, 5*time.Second, 10*time.Millisecond,
+		"on demand replays should be taken while all workers are busy")
+
+	close(release)
+	eventually(t, func() bool { return store.count("slow-ns") == 0 && store.count("fast-ns") == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestProcessBufferReplaysOnceAcrossReplicas(t *testing.T) {
+	var lock sync.Mutex
+	replayed := map[string]int{}
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		lock.Lock()
+		replayed[r.URL.Path]++
+		lock.Unlock()
+	}))
+	defer jenkins.Close()
+
+	store := storage.NewMemoryStore()
+	paths := []string{"/first", "/second", "/third"}
+	for _, path := range paths {
+		req := httptest.NewRequest("POST", jenkins.URL+path, bytes.NewReader(ghPayload()))
+		req.Header.Set(GHHeader, GHAgent+"/c494ff1")
+		u, _ := url.Parse(jenkins.URL)
+		req.URL.Scheme = u.Scheme
+		req.Host = u.Host
+		r, err := storage.NewRequest(req, "ns", ghPayload())
+		require.NoError(t, err)
+		require.NoError(t, store.CreateRequest(r))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, replica := range []string{"replica-1", "replica-2"} {
+		p := NewMock(idler.Running, wit.DefaultMockOwner)
+		p.storageService = store
+		p.replicaID = replica
+		p.maxRequestRetry = 10
+		p.bufferCheckSleep = 5 * time.Millisecond
+		go p.ProcessBuffer(ctx)
+	}
+
+	eventually(t, func() bool {
+		count, _ := store.GetRequestsCount("ns")
+		return count == 0
+	}, 10*time.Second, 10*time.Millisecond, "requests should be replayed")
+
+	lock.Lock()
+	defer lock.Unlock()
+	for _, path := range paths {
+		assert.Equal(t, 1, replayed[path], "%s should be replayed by one replica only", path)
+	}
+}
+
+// switchableIdler reports the Jenkins state set by the test
+type switchableIdler struct {
+	idler.Mock
+	lock  sync.Mutex
+	state idler.PodState
+}
+
+func (i *switchableIdler) State(ctx context.Context, tenant string, openShiftAPIURL string) (idler.PodState, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.state, nil
+}
+
+func (i *switchableIdler) set(state idler.PodState) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.state = state
+}
+
+func TestProcessBufferReplaysOnceJenkinsIsRunning(t *testing.T) {
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer jenkins.Close()
+
+	store := &replayStore{requests: map[string][]storage.Request{}}
+	bufferRequest(t, store, jenkins.URL, "ns", "/hook")
+
+	service := &switchableIdler{state: idler.Idled}
+	p := NewMock(idler.Idled, wit.DefaultMockOwner)
+	p.storageService = store
+	p.maxRequestRetry = 10
+	p.idler = service
+	p.watcher = idler.NewWatcher(service, 10*time.Millisecond)
+	// only the watcher can trigger the replay within the test
+	p.bufferCheckSleep = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.ProcessBuffer(ctx)
+
+	eventually(t, func() bool { return p.watcher.Watching("ns") }, 5*time.Second, 10*time.Millisecond,
+		"namespace with idled Jenkins should be watched")
+	assert.Equal(t, 1, store.count("ns"), "request should stay buffered while Jenkins is idled")
+
+	service.set(idler.Running)
+	eventually(t, func() bool { return store.count("ns") == 0 }, 5*time.Second, 10*time.Millisecond,
+		"request should be replayed as soon as Jenkins is running")
+}
+
+func TestProcessBufferMovesExhaustedRequestsToDeadLetters(t *testing.T) {
+	var lock sync.Mutex
+	var attempts []time.Time
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		attempts = append(attempts, time.Now())
+		lock.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer jenkins.Close()
+
+	defer metric.SetDefaultRecorder(metric.DefaultRecorder())
+	recorder := metric.NewMock()
+	metric.SetDefaultRecorder(recorder)
+
+	store := &replayStore{requests: map[string][]storage.Request{}}
+	bufferRequest(t, store, jenkins.URL, "ns", "/failing")
+
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.storageService = store
+	p.maxRequestRetry = 3
+	p.retryBackoff = 50 * time.Millisecond
+	p.maxRetryBackoff = time.Second
+	p.bufferCheckSleep = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.ProcessBuffer(ctx)
+
+	eventually(t, func() bool { return len(store.dead()) == 1 }, 10*time.Second, 10*time.Millisecond,
+		"request should be moved to the dead letters once its retries are exhausted")
+	assert.Equal(t, 0, store.count("ns"), "dead request should no longer be buffered")
+
+	dead := store.dead()[0]
+	assert.Equal(t, 3, dead.Retries)
+	assert.Equal(t, http.StatusInternalServerError, dead.LastStatus)
+	assert.Contains(t, dead.LastError, "500")
+	assert.Equal(t, float64(2), recorder.Value("replay_outcomes_total", metric.ReplayRetried))
+	assert.Equal(t, float64(1), recorder.Value("replay_outcomes_total", metric.ReplayExpired))
+	assert.Equal(t, float64(3), recorder.Value("upstream_request_duration_seconds", metric.UpstreamJenkins, "success"),
+		"Jenkins answered every replay, if with an error status")
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, attempts, 3, "request should be replayed once per retry")
+	assert.True(t, attempts[1].Sub(attempts[0]) >= 50*time.Millisecond, "second replay should back off")
+	assert.True(t, attempts[2].Sub(attempts[1]) >= 100*time.Millisecond, "backoff should double")
+}
+
+func TestBackoffDoublesUpToMaximum(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.retryBackoff = 10 * time.Second
+	p.maxRetryBackoff = time.Minute
+
+	assert.Equal(t, 10*time.Second, p.backoff(0))
+	assert.Equal(t, 20*time.Second, p.backoff(1))
+	assert.Equal(t, 40*time.Second, p.backoff(2))
+	assert.Equal(t, time.Minute, p.backoff(3))
+	assert.Equal(t, time.Minute, p.backoff(100))
+}
+
+func TestReconfigureChangesBackoff(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	config := configuration.NewMock()
+	config.ReplayBackoff = 5 * time.Second
+	config.ReplayMaxBackoff = 15 * time.Second
+	p.Reconfigure(&config)
+
+	assert.Equal(t, 5*time.Second, p.backoff(0))
+	assert.Equal(t, 15*time.Second, p.backoff(2))
+}
+
+func TestReconfigureExtendsLease(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	config := configuration.NewMock()
+	config.ReplayLease = time.Minute
+	config.GatewayTimeout = 10 * time.Second
+	p.Reconfigure(&config)
+	assert.Equal(t, time.Minute, p.tuned().replayLease)
+
+	config.GatewayTimeout = 2 * time.Minute
+	p.Reconfigure(&config)
+	assert.Equal(t, 4*time.Minute, p.tuned().replayLease, "Lease should outlast a replay taking up to the gateway timeout")
+}
+
+func TestReplayOnDemand(t *testing.T) {
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer jenkins.Close()
+
+	store := &replayStore{requests: map[string][]storage.Request{}}
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.storageService = store
+	p.maxRequestRetry = 10
+	// only an on-demand replay can replay the request within the test
+	p.bufferCheckSleep = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.ProcessBuffer(ctx)
+
+	// buffered after the first check
+	time.Sleep(50 * time.Millisecond)
+	store.lock.Lock()
+	bufferRequest(t, store, jenkins.URL, "ns", "/hook")
+	store.lock.Unlock()
+
+	p.Replay("ns")
+	eventually(t, func() bool { return store.count("ns") == 0 }, 5*time.Second, 10*time.Millisecond,
+		"request should be replayed on demand")
+}
+
+func TestReplayOnDemandWhileReplaying(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+	}))
+	defer jenkins.Close()
+
+	store := &replayStore{requests: map[string][]storage.Request{}}
+	bufferRequest(t, store, jenkins.URL, "ns", "/slow")
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.storageService = store
+	p.maxRequestRetry = 10
+	// only an on-demand replay can replay the second request within the test
+	p.bufferCheckSleep = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.ProcessBuffer(ctx)
+
+	// buffered while the first request is replayed
+	<-started
+	store.lock.Lock()
+	bufferRequest(t, store, jenkins.URL, "ns", "/hook")
+	store.lock.Unlock()
+
+	p.Replay("ns")
+	eventually(t, func() bool { return len(p.replayNow) == 0 }, 5*time.Second, 10*time.Millisecond)
+	close(release)
+	eventually(t, func() bool { return store.count("ns") == 0 }, 5*time.Second, 10*time.Millisecond,
+		"request should be replayed once the namespace is replayed no more")
+}
+
+func TestReplayIsTracedWithRequestID(t *testing.T) {
+	exporter, restore := tracing.NewInMemory()
+	defer restore()
+
+	var received http.Header
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer jenkins.Close()
+
+	store := &replayStore{requests: map[string][]storage.Request{}}
+	bufferRequest(t, store, jenkins.URL, "ns", "/hook")
+	store.requests["ns"][0].RequestID = "support-42"
+
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.storageService = store
+	p.maxRequestRetry = 10
+	p.replayNamespace(context.Background(), "ns")
+
+	require.NotNil(t, received, "request should have been replayed")
+	assert.Equal(t, "support-42", received.Get(requestid.Header), "Replay should keep the ID of the buffered request")
+
+	var replay *tracetest.SpanStub
+	spans := exporter.GetSpans()
+	for i := range spans {
+		if spans[i].Name == "proxy.Replay" {
+			replay = &spans[i]
+		}
+	}
+	require.NotNil(t, replay, "Replay should have been traced")
+	assert.Contains(t, replay.Attributes, tracing.Namespace("ns"))
+	assert.Contains(t, replay.Attributes, tracing.Cluster("Valid_OpenShift_API_URL"))
+	assert.Contains(t, received.Get("traceparent"), replay.SpanContext.TraceID().String(), "Jenkins should continue the trace of the replay")
+}
+
+func TestBufferedRequestsAreRecorded(t *testing.T) {
+	defer metric.SetDefaultRecorder(metric.DefaultRecorder())
+	recorder := metric.NewMock()
+	metric.SetDefaultRecorder(recorder)
+
+	store := &replayStore{requests: map[string][]storage.Request{}}
+	bufferRequest(t, store, "http://jenkins", "ns1", "/hook")
+	bufferRequest(t, store, "http://jenkins", "ns1", "/hook")
+	bufferRequest(t, store, "http://jenkins", "ns2", "/hook")
+
+	p := NewMock(idler.Idled, wit.DefaultMockOwner)
+	p.storageService = store
+	p.recordBufferedRequests([]string{"ns1", "ns2"})
+	assert.Equal(t, float64(2), recorder.Value("buffered_requests_by_namespace", "ns1"))
+	assert.Equal(t, float64(1), recorder.Value("buffered_requests_by_namespace", "ns2"))
+	assert.Equal(t, float64(3), recorder.Value("buffered_requests"))
+
+	store.requests["ns1"] = nil
+	p.recordBufferedRequests([]string{"ns2"})
+	assert.Equal(t, float64(0), recorder.Value("buffered_requests_by_namespace", "ns1"))
+	assert.Equal(t, float64(1), recorder.Value("buffered_requests"))
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -19,7 +20,9 @@ type ReverseProxy struct {
 	RedirectURL     url.URL
 	ResponseTimeout time.Duration
 	OnError         func(http.ResponseWriter, *http.Request, int) error
-	Logger          *log.Entry
+	// OnResponse, if set, is called with every response received from the server
+	OnResponse func(*http.Response)
+	Logger     *log.Entry
 }
 
 // NewReverseProxy returns an instance of reverse proxy on passing redirect url,
@@ -43,8 +46,8 @@ func director(req *http.Request) {
 
 func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	logger := rp.Logger.WithFields(log.Fields{
-		"redirect_url":     rp.RedirectURL.String(),
-		"request_url":      req.URL.String(),
+		"redirect_url":     logging.RedactURL(&rp.RedirectURL),
+		"request_url":      logging.RedactURL(req.URL),
 		"response_timeout": rp.ResponseTimeout,
 	})
 
@@ -55,6 +58,12 @@ func (rp *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 	rr := newResponseRecorder(rw, logger)
 	proxy := &httputil.ReverseProxy{Director: director}
+	if rp.OnResponse != nil {
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			rp.OnResponse(resp)
+			return nil
+		}
+	}
 	proxy.ServeHTTP(rr, outreq)
 
 	if rr.err != nil {
@@ -185,6 +185,25 @@ func TestServeHTTP(t *testing.T) {
 	testProxyStatus(t, rp, http.StatusFound, http.StatusFound)
 }
 
+func TestOnResponse(t *testing.T) {
+	var statusCodes []int
+	rp := NewReverseProxy(
+		url.URL{Scheme: "https", Host: "proxy", Path: "/path"},
+		3*time.Second,
+		func(rw http.ResponseWriter, req *http.Request, code int) error {
+			return nil
+		},
+		log.WithFields(log.Fields{"component": "reverseproxy"}),
+	)
+	rp.OnResponse = func(resp *http.Response) {
+		statusCodes = append(statusCodes, resp.StatusCode)
+	}
+
+	testProxyStatus(t, rp, http.StatusOK, http.StatusOK)
+	testProxyStatus(t, rp, http.StatusBadGateway, http.StatusFound)
+	assert.Equal(t, []int{http.StatusOK, http.StatusBadGateway}, statusCodes)
+}
+
 func testProxyStatus(t *testing.T, rp *ReverseProxy, jenkinsStatusCode int, proxyStatusCode int) {
 	defer gock.Off()
 
@@ -9,13 +9,18 @@ import (
 
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/auth"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/proxy/cookieutil"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
 	log "github.com/sirupsen/logrus"
 )
 
 func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, logger *log.Entry) (cacheKey, ns string, okToForward bool) {
 	logger.Infof("Incoming request: %s Cookies: %v ", r.URL.Path, cookieutil.CookieNames(r.Cookies()))
 
+	ctx, cancel := p.upstreamContext(r)
+	defer cancel()
+
 	needsAuth := true   // indicates if we need to redirect to auth service
 	okToForward = false // indicates if its ready to forward requests to Jenkins
 
@@ -36,7 +41,7 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 			return
 		}
 
-		jenkins, osioToken, err := GetJenkins(p.clusters, nil, p.idler, p.tenant, tj[0], logger)
+		jenkins, osioToken, err := GetJenkins(ctx, p.clusters, nil, p.idler, p.tenant, tj[0], logger)
 		if err != nil {
 			p.HandleError(w, fmt.Errorf("Error processing token_json to get osio-token: %q", err), tjLogger)
 			return
@@ -53,7 +58,7 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 			p.HandleError(w, fmt.Errorf("Error while getting default auth client: %q", err), tjLogger)
 			return
 		}
-		osoToken, err := authClient.OSOTokenForCluster(jenkins.info.ClusterURL, osioToken)
+		osoToken, err := authClient.OSOTokenForCluster(ctx, jenkins.info.ClusterURL, osioToken)
 		if err != nil {
 			p.HandleError(w, fmt.Errorf("Error when fetching OSO token: %s", err), nsLogger)
 			return
@@ -62,7 +67,7 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 
 		// we don't care about code here since only the state of jenkins pod -
 		// running or not is what is relevant
-		state, _, err := jenkins.Start()
+		state, _, err := p.startJenkins(ctx, jenkins, metric.TriggerUI)
 		if err != nil {
 			p.HandleError(w, fmt.Errorf("Error when starting Jenkins: %s", err), nsLogger)
 			return
@@ -80,7 +85,10 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 			// Set "idled" cookie to indicate that jenkins is idled
 			// also cache the ns & cluster for faster lookup next time
 			uuid := cookieutil.SetIdledCookie(w)
-			p.ProxyCache.SetDefault(uuid, jenkins.info)
+			if err := p.ProxyCache.Set(uuid, jenkins.info); err != nil {
+				p.HandleError(w, fmt.Errorf("Error when caching idled Jenkins: %s", err), nsLogger)
+				return
+			}
 
 			// Redirect to set the idled cookied and to  get rid of token in URL
 			nsLogger.Info("Redirecting to remove token from URL")
@@ -89,7 +97,7 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 		}
 
 		// Jenkins is running at this point; login and set the jenkins cookies
-		status, jenkinsCookies, err := jenkins.Login(osoToken)
+		status, jenkinsCookies, err := jenkins.Login(ctx, osoToken)
 		if err != nil {
 			p.HandleError(w, fmt.Errorf("Error when logging into jenkins: %s", err), nsLogger)
 			return
@@ -102,6 +110,7 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 			http.Redirect(w, r, redirectURL.String(), http.StatusFound)
 			return
 		}
+		p.jenkinsReady(ns, nsLogger)
 
 		// there could be old session cookies, so lets clear it
 		cookieutil.ExpireCookiesMatching(w, r, cookieutil.IsSessionOrIdledCookie)
@@ -117,11 +126,14 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 		// Update proxy-cache to associate pci with the session cookie
 		// the cache so that, the subsequent request that would contain the
 		// the jession cookie can be used to lookup the cache
-		p.ProxyCache.SetDefault(jsessionCookie.Value, jenkins.info)
-		nsLogger.Infof("Cached Jenkins route %q in %q", jenkins.info.Route, jsessionCookie.Value)
+		if err := p.ProxyCache.Set(jsessionCookie.Value, jenkins.info); err != nil {
+			p.HandleError(w, fmt.Errorf("Error when caching Jenkins session: %s", err), nsLogger)
+			return
+		}
+		nsLogger.Infof("Cached Jenkins route %q in %q", jenkins.info.Route, logging.RedactCookie(jsessionCookie.Name, jsessionCookie.Value))
 
 		// If all good, redirect to self to remove token from url
-		nsLogger.Infof("Redirecting to %q", redirectURL)
+		nsLogger.Infof("Redirecting to %q", logging.RedactURL(redirectURL))
 		http.Redirect(w, r, redirectURL.String(), http.StatusFound)
 		return
 	}
@@ -136,7 +148,12 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 				continue // only the session and idled cookies are cached
 			}
 
-			cacheVal, ok := p.ProxyCache.Get(cookie.Value)
+			var pci CacheItem
+			ok, err := p.ProxyCache.Get(cookie.Value, &pci)
+			if err != nil {
+				p.HandleError(w, fmt.Errorf("Error when looking up cookie %q in cache: %s", cookie.Name, err), cookieLogger)
+				return
+			}
 			if !ok {
 				// if the cookie is not in cache, it could be an old idled or jsessionid
 				// cookie so lets clear it
@@ -146,10 +163,9 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 			}
 
 			cacheKey = cookie.Value
-			pci := cacheVal.(CacheItem)
 			ns = pci.NS
 			clusterURL := pci.ClusterURL
-			jenkins, _, err := GetJenkins(nil, &pci, p.idler, p.tenant, "", cookieLogger)
+			jenkins, _, err := GetJenkins(ctx, nil, &pci, p.idler, p.tenant, "", cookieLogger)
 			if err != nil {
 				p.HandleError(w, err, cookieLogger)
 				return
@@ -162,10 +178,10 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 			if cookieutil.IsSessionCookie(cookie) {
 				// We found a session cookie in cache
 				scLogger := nsLogger.WithField("cookietype", "session")
-				scLogger.Infof("Cache has Jenkins route %q in %q", pci.Route, cookie.Value)
+				scLogger.Infof("Cache has Jenkins route %q in %q", pci.Route, logging.RedactCookie(cookie.Name, cookie.Value))
 
 				// ensure jenkins is running
-				state, _, err := jenkins.Start()
+				state, _, err := p.startJenkins(ctx, jenkins, metric.TriggerUI)
 				if err != nil {
 					p.HandleError(w, err, scLogger)
 					return
@@ -184,7 +200,9 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 
 				// we find a session cookie in cache but the pod is not running
 				// so lets clear the cookie and the cache entry
-				p.ProxyCache.Delete(cacheKey)
+				if err := p.ProxyCache.Delete(cacheKey); err != nil {
+					scLogger.Errorf("Could not remove session from cache: %s", err)
+				}
 				cacheKey = "" // cacheKey isn't valid any more
 				cookieutil.ExpireCookiesMatching(w, r, cookieutil.IsSessionOrIdledCookie)
 				p.recordStatistics(pci.NS, time.Now().Unix(), 0) //FIXME - maybe do this at the beginning?
@@ -195,10 +213,10 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 			if cookieutil.IsIdledCookie(cookie) {
 				// Found a cookie saying Jenkins is idled
 				icLogger := nsLogger.WithField("cookietype", "idle")
-				icLogger.Infof("Cache has Jenkins route %q in %q", pci.Route, cookie.Value)
+				icLogger.Infof("Cache has Jenkins route %q in %q", pci.Route, logging.RedactCookie(cookie.Name, cookie.Value))
 
 				needsAuth = false
-				state, code, err := jenkins.Start()
+				state, code, err := p.startJenkins(ctx, jenkins, metric.TriggerUI)
 				if err != nil {
 					p.HandleError(w, err, icLogger)
 					return
@@ -230,7 +248,7 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 
 				// login is performed using "" token to only verify if jenkins is actually running
 				var statusCode int
-				statusCode, _, err = jenkins.Login("")
+				statusCode, _, err = jenkins.Login(ctx, "")
 
 				if err != nil {
 					p.HandleError(w, err, icLogger)
@@ -240,6 +258,7 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 				if statusCode == http.StatusOK ||
 					statusCode == http.StatusForbidden {
 					icLogger.Infof("jenkins is running fine and returned %d", statusCode)
+					p.jenkinsReady(ns, icLogger)
 
 					// jenkins is up and running; so expire both session and idled cookies
 					// so that the next request will end up in re-auth and thus try
@@ -247,7 +266,9 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 					// the jsession cookies
 
 					cookieutil.ExpireCookiesMatching(w, r, cookieutil.IsSessionOrIdledCookie)
-					p.ProxyCache.Delete(cacheKey)
+					if err := p.ProxyCache.Delete(cacheKey); err != nil {
+						icLogger.Errorf("Could not remove idled cookie from cache: %s", err)
+					}
 					cacheKey = ""
 
 				} else {
@@ -265,7 +286,7 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 		if len(cacheKey) == 0 {
 			logger.WithField("ns", ns).Info("Could not find cache, redirecting to re-login")
 		} else {
-			logger.WithField("ns", ns).Infof("Found cookie %s", cacheKey)
+			logger.WithField("ns", ns).Info("Found cookie in cache")
 		}
 	}
 
@@ -279,7 +300,7 @@ func (p *Proxy) handleJenkinsUIRequest(w http.ResponseWriter, r *http.Request, l
 		}
 
 		redirAuth := authClient.CreateRedirectURL(redirectURL.String())
-		logger.Infof("Redirecting to auth: %q", redirAuth)
+		logger.Infof("Redirecting to auth: %q", logging.RedactURLString(redirAuth))
 
 		// clear session and idle cookies as this is a fresh start
 		cookieutil.ExpireCookiesMatching(w, r, cookieutil.IsSessionOrIdledCookie)
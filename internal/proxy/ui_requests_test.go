@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/configuration"
@@ -11,6 +12,7 @@ import (
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/proxy/reverseproxy"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/wit"
 	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 
 	uuid "github.com/satori/go.uuid"
 	gock "gopkg.in/h2non/gock.v1"
@@ -22,6 +24,23 @@ const (
 	testTokenJSON = "%7B%22access_token%22%3A%22test_access_token%22%2C%22expires_in%22%3A2592000%2C%22not-before-policy%22%3Anull%2C%22refresh_expires_in%22%3A2592000%2C%22refresh_token%22%3A%22test_refresh_token%22%2C%22token_type%22%3A%22bearer%22%7D"
 )
 
+var testCacheItem = CacheItem{
+	ClusterURL: "Valid_OpenShift_API_URL",
+	NS:         "namespace-jenkins",
+	Scheme:     "https",
+	Route:      "jenkins-namespace-jenkins.test_route",
+}
+
+// responseCookie returns the value of the last cookie set in the response, whose name starts with prefix
+func responseCookie(w *httptest.ResponseRecorder, prefix string) (value string) {
+	for _, cookie := range w.Result().Cookies() {
+		if strings.HasPrefix(cookie.Name, prefix) {
+			value = cookie.Value
+		}
+	}
+	return
+}
+
 func TestBadToken(t *testing.T) {
 	p := NewMock("", wit.DefaultMockOwner)
 	req := httptest.NewRequest("GET", "http://proxy?token_json=BADTOKEN", nil)
@@ -68,19 +87,11 @@ func TestCorrectTokenWithJenkinsIdled(t *testing.T) {
 	assert.NotContains(t, setCookieHeaders[1], "Expires")
 
 	// A proxy cacheitem is added to proxycache
-	items := p.ProxyCache.Items()
-	assert.Equal(t, len(items), 1)
-	for _, item := range items {
-		info, ok := item.Object.(CacheItem)
-		cacheItem := CacheItem{
-			ClusterURL: "Valid_OpenShift_API_URL",
-			NS:         "namespace-jenkins",
-			Scheme:     "https",
-			Route:      "jenkins-namespace-jenkins.test_route",
-		}
-		assert.True(t, ok, "item object should be of type cache item")
-		assert.Equal(t, info, cacheItem)
-	}
+	var info CacheItem
+	ok, err := p.ProxyCache.Get(responseCookie(w, "JenkinsIdled"), &info)
+	assert.NoError(t, err)
+	assert.True(t, ok, "idled cookie should be cached")
+	assert.Equal(t, testCacheItem, info)
 }
 
 func TestWithTokenJenkinsRunningButLoginFailed(t *testing.T) {
@@ -135,19 +146,11 @@ func TestWithTokenJenkinsRunningAndLoginSuccessful(t *testing.T) {
 	assert.Contains(t, setCookieHeaders[2], "JSESSIONID")
 	assert.NotContains(t, setCookieHeaders[2], "Expires")
 
-	items := p.ProxyCache.Items()
-	assert.Equal(t, len(items), 1)
-	for _, item := range items {
-		info, ok := item.Object.(CacheItem)
-		cacheItem := CacheItem{
-			ClusterURL: "Valid_OpenShift_API_URL",
-			NS:         "namespace-jenkins",
-			Scheme:     "https",
-			Route:      "jenkins-namespace-jenkins.test_route",
-		}
-		assert.True(t, ok, "item object should be of type cache item")
-		assert.Equal(t, info, cacheItem)
-	}
+	var info CacheItem
+	ok, err := p.ProxyCache.Get(responseCookie(w, "JSESSIONID"), &info)
+	assert.NoError(t, err)
+	assert.True(t, ok, "session should be cached")
+	assert.Equal(t, testCacheItem, info)
 }
 
 func TestExpireCookieIfNotInCache(t *testing.T) {
@@ -192,7 +195,7 @@ func TestValidateSession(t *testing.T) {
 		Scheme:     "https",
 		Route:      "https://jenkinsHost",
 	}
-	p.ProxyCache.SetDefault(cookieVal, info)
+	p.ProxyCache.Set(cookieVal, info)
 
 	req := httptest.NewRequest("GET", "https://jenkinsHost/path", nil)
 	req.AddCookie(&http.Cookie{
@@ -221,11 +224,9 @@ func TestValidateSession(t *testing.T) {
 	// Jenkins would return status forbidden on this, we expire cookie
 	// and delete the cache
 
-	_, ok := p.ProxyCache.Get(cookieVal)
-	assert.True(t, ok, "CacheItem exists")
+	assert.True(t, cached(p.ProxyCache, cookieVal), "CacheItem exists")
 	rp.ServeHTTP(w, req)
-	_, ok = p.ProxyCache.Get(cookieVal)
-	assert.False(t, ok, "CacheItem has been deleted")
+	assert.False(t, cached(p.ProxyCache, cookieVal), "CacheItem has been deleted")
 
 	setCookieHeaders := w.Header()["Set-Cookie"]
 	assert.Equal(t, 1, len(setCookieHeaders))
@@ -235,3 +236,41 @@ func TestValidateSession(t *testing.T) {
 	// Redirects to the redirect url
 	assert.Equal(t, w.Header().Get("Location"), "https://proxy/path")
 }
+
+func TestTokensAndSessionsAreNotLogged(t *testing.T) {
+	defer gock.Off()
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	sessionCookie := "JSESSIONID." + uuid.NewV4().String()
+	sessionID := uuid.NewV4().String()
+	gock.New("https://jenkins-namespace-jenkins.test_route/securityRealm/commenceLogin?from=%2F").
+		Get("").
+		Reply(200).
+		SetHeaders(map[string]string{
+			"Set-Cookie": sessionCookie + "=" + sessionID,
+		})
+
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+
+	req := httptest.NewRequest("GET", "http://proxy?token_json="+testTokenJSON, nil)
+	w := httptest.NewRecorder()
+	p.handleJenkinsUIRequest(w, req, proxyLogger)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	// the next request is authenticated by the cached session
+	req = httptest.NewRequest("GET", "http://proxy/job", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: sessionID})
+	w = httptest.NewRecorder()
+	_, _, okToForward := p.handleJenkinsUIRequest(w, req, proxyLogger)
+	assert.True(t, okToForward, "Cached session should be forwarded.")
+
+	assert.NotEmpty(t, hook.Entries)
+	for _, entry := range hook.Entries {
+		logged, err := entry.String()
+		assert.NoError(t, err)
+		for _, secret := range []string{"test_access_token", "test_refresh_token", sessionID} {
+			assert.NotContains(t, logged, secret, "Secret should have been redacted.")
+		}
+	}
+}
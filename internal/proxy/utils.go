@@ -13,10 +13,19 @@ import (
 
 //HandleError creates a JSON response with a given error and writes it to ResponseWriter
 func (p *Proxy) HandleError(w http.ResponseWriter, err error, requestLogEntry *log.Entry) {
-	// log the error
+	p.handleError(w, http.StatusInternalServerError, err, requestLogEntry)
+}
+
+// HandleErrorWithStatus is like HandleError, but responds with the given HTTP status code
+func (p *Proxy) HandleErrorWithStatus(w http.ResponseWriter, status int, err error, requestLogEntry *log.Entry) {
+	p.handleError(w, status, err, requestLogEntry)
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, status int, err error, requestLogEntry *log.Entry) {
+	// log the error, skipping the exported wrapper to point at the actual caller
 	location := ""
 	if err != nil {
-		pc, fn, line, _ := runtime.Caller(1)
+		pc, fn, line, _ := runtime.Caller(2)
 
 		location = fmt.Sprintf(" %s[%s:%d]", runtime.FuncForPC(pc).Name(), fn, line)
 	}
@@ -28,10 +37,10 @@ func (p *Proxy) HandleError(w http.ResponseWriter, err error, requestLogEntry *l
 		}).Error("Error Handling proxy request request.")
 
 	// create error response
-	w.WriteHeader(http.StatusInternalServerError)
+	w.WriteHeader(status)
 
 	pei := util.ErrorInfo{
-		Code:   fmt.Sprintf("%d", http.StatusInternalServerError),
+		Code:   fmt.Sprintf("%d", status),
 		Detail: err.Error(),
 	}
 	e := util.Error{
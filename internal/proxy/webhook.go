@@ -0,0 +1,327 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+const (
+	// GitLabEventHeader is the header GitLab sets on each webhook delivery
+	GitLabEventHeader = "X-Gitlab-Event"
+	// BitbucketEventHeader is the header Bitbucket sets on each webhook delivery
+	BitbucketEventHeader = "X-Event-Key"
+	// GenericWebhookPath is the path prefix of the Jenkins generic webhook trigger
+	GenericWebhookPath = "/generic-webhook-trigger/"
+	// GHDeliveryHeader carries the GUID of a GitHub webhook delivery, it is kept on redelivery
+	GHDeliveryHeader = "X-GitHub-Delivery"
+	// GitLabEventUUIDHeader carries the UUID of a GitLab webhook event, it is kept on retries
+	GitLabEventUUIDHeader = "X-Gitlab-Event-UUID"
+	// GHEventHeader names the event type of a GitHub webhook delivery
+	GHEventHeader = "X-GitHub-Event"
+	// GHSignatureHeader carries the HMAC SHA1 hex digest of a GitHub webhook payload
+	GHSignatureHeader = "X-Hub-Signature"
+	// GHSignature256Header carries the HMAC SHA256 hex digest of a GitHub webhook payload
+	GHSignature256Header = "X-Hub-Signature-256"
+	// GitLabTokenHeader carries the secret token configured for a GitLab webhook
+	GitLabTokenHeader = "X-Gitlab-Token"
+	// BitbucketSignatureHeader carries the HMAC SHA256 hex digest of a Bitbucket webhook payload
+	BitbucketSignatureHeader = "X-Hub-Signature"
+)
+
+// ErrInvalidSignature is returned if the signature of a webhook delivery is missing
+// or does not match the payload
+var ErrInvalidSignature = errors.New("webhook signature is missing or invalid")
+
+// WebhookProvider knows how to recognise the webhook deliveries of a code
+// hosting service and how to find the repository they belong to. All providers
+// feed the same codebase to namespace lookup, buffering and replay.
+type WebhookProvider interface {
+	// Name returns a human readable name of the provider, e.g. GitHub
+	Name() string
+	// Detect returns true if the request is a webhook delivery of this provider
+	Detect(r *http.Request) bool
+	// RepositoryURL extracts the clone URL of the repository from the payload
+	RepositoryURL(payload []byte) (string, error)
+}
+
+// SignatureVerifier is implemented by providers which sign their webhook
+// deliveries with a shared secret
+type SignatureVerifier interface {
+	// VerifySignature returns ErrInvalidSignature unless the request carries
+	// a valid signature of the payload for the given secret
+	VerifySignature(r *http.Request, payload []byte, secret string) error
+}
+
+// DeliveryIdentifier is implemented by providers which send an identifier
+// with each webhook delivery that is kept when the delivery is repeated
+type DeliveryIdentifier interface {
+	// DeliveryID returns the identifier or an empty string if there is none
+	DeliveryID(r *http.Request) string
+}
+
+// webhookProviders are consulted in order, the first provider detecting
+// a request handles it.
+var webhookProviders = []WebhookProvider{
+	&gitHubProvider{},
+	&gitLabProvider{},
+	&bitbucketProvider{},
+	&genericProvider{},
+}
+
+// detectWebhookProvider returns the provider the request is a webhook
+// delivery of, or nil if the request is not a webhook
+func detectWebhookProvider(r *http.Request) WebhookProvider {
+	for _, provider := range webhookProviders {
+		if provider.Detect(r) {
+			return provider
+		}
+	}
+	return nil
+}
+
+// GitLabHookStruct a simplified structure to get info from
+// a GitLab webhook request
+type GitLabHookStruct struct {
+	Project struct {
+		Name          string `json:"name"`
+		WebURL        string `json:"web_url"`
+		GitHTTPURL    string `json:"git_http_url"`
+		PathNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	Repository struct {
+		Name       string `json:"name"`
+		Homepage   string `json:"homepage"`
+		GitHTTPURL string `json:"git_http_url"`
+	} `json:"repository"`
+}
+
+// BitbucketHookStruct a simplified structure to get info from
+// a Bitbucket Cloud or Bitbucket Server webhook request
+type BitbucketHookStruct struct {
+	Repository struct {
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+		Links    struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+			Clone []struct {
+				Href string `json:"href"`
+				Name string `json:"name"`
+			} `json:"clone"`
+		} `json:"links"`
+	} `json:"repository"`
+}
+
+type gitHubProvider struct{}
+
+func (p *gitHubProvider) Name() string {
+	return "GitHub"
+}
+
+func (p *gitHubProvider) Detect(r *http.Request) bool {
+	if ua, exist := r.Header[GHHeader]; exist {
+		return strings.HasPrefix(ua[0], GHAgent)
+	}
+	return false
+}
+
+func (p *gitHubProvider) RepositoryURL(payload []byte) (string, error) {
+	gh := GHHookStruct{}
+	if err := json.Unmarshal(payload, &gh); err != nil {
+		return "", err
+	}
+	return nonEmptyRepositoryURL(p, gh.Repository.CloneURL)
+}
+
+func (p *gitHubProvider) DeliveryID(r *http.Request) string {
+	return r.Header.Get(GHDeliveryHeader)
+}
+
+// Event reads the event type from X-GitHub-Event and the action and branch
+// from the payload. Tag events have no branch.
+func (p *gitHubProvider) Event(r *http.Request, payload []byte) (WebhookEvent, error) {
+	gh := struct {
+		Action      string `json:"action"`
+		Ref         string `json:"ref"`
+		RefType     string `json:"ref_type"`
+		PullRequest struct {
+			Base struct {
+				Ref string `json:"ref"`
+			} `json:"base"`
+		} `json:"pull_request"`
+	}{}
+	if err := json.Unmarshal(payload, &gh); err != nil {
+		return WebhookEvent{}, err
+	}
+
+	event := WebhookEvent{
+		Name:   r.Header.Get(GHEventHeader),
+		Action: gh.Action,
+	}
+	switch {
+	case gh.PullRequest.Base.Ref != "":
+		event.Branch = gh.PullRequest.Base.Ref
+	case strings.HasPrefix(gh.Ref, "refs/heads/"):
+		event.Branch = strings.TrimPrefix(gh.Ref, "refs/heads/")
+	case gh.RefType == "branch":
+		event.Branch = gh.Ref
+	}
+	return event, nil
+}
+
+// VerifySignature checks X-Hub-Signature-256 and falls back to the legacy
+// SHA1 based X-Hub-Signature if GitHub did not send the former.
+func (p *gitHubProvider) VerifySignature(r *http.Request, payload []byte, secret string) error {
+	if signature := r.Header.Get(GHSignature256Header); signature != "" {
+		return verifyHMAC(sha256.New, "sha256=", signature, payload, secret)
+	}
+	if signature := r.Header.Get(GHSignatureHeader); signature != "" {
+		return verifyHMAC(sha1.New, "sha1=", signature, payload, secret)
+	}
+	return ErrInvalidSignature
+}
+
+func verifyHMAC(h func() hash.Hash, prefix string, signature string, payload []byte, secret string) error {
+	if !strings.HasPrefix(signature, prefix) {
+		return ErrInvalidSignature
+	}
+	actual, err := hex.DecodeString(strings.TrimPrefix(signature, prefix))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(actual, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type gitLabProvider struct{}
+
+func (p *gitLabProvider) Name() string {
+	return "GitLab"
+}
+
+func (p *gitLabProvider) Detect(r *http.Request) bool {
+	return r.Header.Get(GitLabEventHeader) != ""
+}
+
+func (p *gitLabProvider) DeliveryID(r *http.Request) string {
+	return r.Header.Get(GitLabEventUUIDHeader)
+}
+
+// VerifySignature compares X-Gitlab-Token with the secret, as GitLab sends the
+// secret token itself rather than signing the payload.
+func (p *gitLabProvider) VerifySignature(r *http.Request, payload []byte, secret string) error {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(GitLabTokenHeader)), []byte(secret)) != 1 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (p *gitLabProvider) RepositoryURL(payload []byte) (string, error) {
+	gl := GitLabHookStruct{}
+	if err := json.Unmarshal(payload, &gl); err != nil {
+		return "", err
+	}
+	if gl.Project.GitHTTPURL != "" {
+		return gl.Project.GitHTTPURL, nil
+	}
+	return nonEmptyRepositoryURL(p, gl.Repository.GitHTTPURL)
+}
+
+type bitbucketProvider struct{}
+
+func (p *bitbucketProvider) Name() string {
+	return "Bitbucket"
+}
+
+func (p *bitbucketProvider) Detect(r *http.Request) bool {
+	return r.Header.Get(BitbucketEventHeader) != ""
+}
+
+func (p *bitbucketProvider) RepositoryURL(payload []byte) (string, error) {
+	bb := BitbucketHookStruct{}
+	if err := json.Unmarshal(payload, &bb); err != nil {
+		return "", err
+	}
+
+	// Bitbucket Server lists the clone URLs explicitly
+	for _, clone := range bb.Repository.Links.Clone {
+		if clone.Name == "http" || clone.Name == "https" {
+			return clone.Href, nil
+		}
+	}
+
+	// Bitbucket Cloud only links the repository page
+	href := strings.TrimRight(bb.Repository.Links.HTML.Href, "/")
+	if href == "" {
+		return nonEmptyRepositoryURL(p, href)
+	}
+	return href + ".git", nil
+}
+
+// VerifySignature checks X-Hub-Signature, which Bitbucket Cloud and Bitbucket
+// Server set to the HMAC SHA256 of the payload.
+func (p *bitbucketProvider) VerifySignature(r *http.Request, payload []byte, secret string) error {
+	return verifyHMAC(sha256.New, "sha256=", r.Header.Get(BitbucketSignatureHeader), payload, secret)
+}
+
+type genericProvider struct{}
+
+func (p *genericProvider) Name() string {
+	return "Generic"
+}
+
+func (p *genericProvider) Detect(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, GenericWebhookPath)
+}
+
+// RepositoryURL tries the repository fields commonly used by code hosting
+// services (e.g. Gitea, Gogs or custom scripts) in order.
+func (p *genericProvider) RepositoryURL(payload []byte) (string, error) {
+	gen := struct {
+		Repository struct {
+			CloneURL   string `json:"clone_url"`
+			GitHTTPURL string `json:"git_http_url"`
+			URL        string `json:"url"`
+		} `json:"repository"`
+		Project struct {
+			GitHTTPURL string `json:"git_http_url"`
+		} `json:"project"`
+	}{}
+	if err := json.Unmarshal(payload, &gen); err != nil {
+		return "", err
+	}
+
+	for _, u := range []string{
+		gen.Repository.CloneURL,
+		gen.Repository.GitHTTPURL,
+		gen.Project.GitHTTPURL,
+		gen.Repository.URL,
+	} {
+		if u != "" {
+			return u, nil
+		}
+	}
+	return nonEmptyRepositoryURL(p, "")
+}
+
+func nonEmptyRepositoryURL(p WebhookProvider, u string) (string, error) {
+	if len(strings.TrimSpace(u)) == 0 {
+		return "", fmt.Errorf("could not find repository URL in %s webhook payload", p.Name())
+	}
+	return u, nil
+}
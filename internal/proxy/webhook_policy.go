@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// EventOutcome describes what the proxy does with a webhook event
+type EventOutcome string
+
+const (
+	// EventUnidle forwards the event, buffering it and unidling Jenkins if needed
+	EventUnidle EventOutcome = "unidle"
+	// EventForward forwards the event only if Jenkins is running and drops it otherwise
+	EventForward EventOutcome = "forward"
+	// EventDrop acknowledges the event without forwarding it
+	EventDrop EventOutcome = "drop"
+
+	// anyEvent is the policy key matching all events without an own entry
+	anyEvent = "*"
+)
+
+// WebhookEvent describes a single webhook delivery
+type WebhookEvent struct {
+	// Name is the event type, e.g. push or pull_request
+	Name string
+	// Action is the activity which triggered the event, e.g. opened, if any
+	Action string
+	// Branch is the branch the event refers to, if any
+	Branch string
+}
+
+// EventDescriber is implemented by providers which can tell which event
+// a webhook delivery is about
+type EventDescriber interface {
+	Event(r *http.Request, payload []byte) (WebhookEvent, error)
+}
+
+// EventPolicy decides on the outcome of webhook events. The zero value
+// unidles Jenkins for all events.
+type EventPolicy struct {
+	outcomes map[string]EventOutcome
+	actions  map[string][]string
+	branches []string
+}
+
+// NewEventPolicy creates an EventPolicy from the outcomes keyed by event name,
+// the |-separated actions keyed by event name and the branch patterns
+// for which events are allowed to unidle Jenkins.
+func NewEventPolicy(outcomes map[string]string, actions map[string]string, branches []string) (EventPolicy, error) {
+	policy := EventPolicy{
+		outcomes: map[string]EventOutcome{},
+		actions:  map[string][]string{},
+	}
+
+	for event, o := range outcomes {
+		outcome := EventOutcome(strings.ToLower(o))
+		switch outcome {
+		case EventUnidle, EventForward, EventDrop:
+			policy.outcomes[event] = outcome
+		default:
+			return EventPolicy{}, fmt.Errorf("invalid outcome %q for webhook event %s", o, event)
+		}
+	}
+
+	for event, a := range actions {
+		policy.actions[event] = strings.Split(a, "|")
+	}
+
+	for _, b := range branches {
+		b = strings.TrimSpace(b)
+		if b == "" {
+			continue
+		}
+		if _, err := path.Match(b, ""); err != nil {
+			return EventPolicy{}, fmt.Errorf("invalid branch pattern %q: %s", b, err)
+		}
+		policy.branches = append(policy.branches, b)
+	}
+
+	return policy, nil
+}
+
+// Outcome returns the outcome for the given event. Events which would unidle
+// Jenkins but don't match the action or branch filters are only forwarded
+// to a running Jenkins.
+func (ep EventPolicy) Outcome(e WebhookEvent) EventOutcome {
+	outcome, found := ep.outcomes[e.Name]
+	if !found {
+		outcome, found = ep.outcomes[anyEvent]
+	}
+	if !found {
+		outcome = EventUnidle
+	}
+
+	if outcome != EventUnidle {
+		return outcome
+	}
+
+	if allowed, ok := ep.actions[e.Name]; ok && e.Action != "" && !contains(allowed, e.Action) {
+		return EventForward
+	}
+
+	if len(ep.branches) > 0 && e.Branch != "" && !ep.matchesBranch(e.Branch) {
+		return EventForward
+	}
+
+	return outcome
+}
+
+func (ep EventPolicy) matchesBranch(branch string) bool {
+	for _, pattern := range ep.branches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if strings.TrimSpace(e) == s {
+			return true
+		}
+	}
+	return false
+}
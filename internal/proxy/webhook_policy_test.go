@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/wit"
+	"github.com/stretchr/testify/assert"
+)
+
+func testEventPolicy(t *testing.T) EventPolicy {
+	policy, err := NewEventPolicy(
+		map[string]string{"push": "unidle", "pull_request": "unidle", "ping": "drop", "*": "forward"},
+		map[string]string{"pull_request": "opened|synchronize"},
+		[]string{"master", "release/*"},
+	)
+	assert.NoError(t, err)
+	return policy
+}
+
+func TestEventPolicyOutcome(t *testing.T) {
+	policy := testEventPolicy(t)
+
+	tests := []struct {
+		name     string
+		event    WebhookEvent
+		expected EventOutcome
+	}{
+		{name: "push to master", event: WebhookEvent{Name: "push", Branch: "master"}, expected: EventUnidle},
+		{name: "push to release branch", event: WebhookEvent{Name: "push", Branch: "release/1.0"}, expected: EventUnidle},
+		{name: "push to other branch", event: WebhookEvent{Name: "push", Branch: "feature"}, expected: EventForward},
+		{name: "push of tag", event: WebhookEvent{Name: "push"}, expected: EventUnidle},
+		{name: "pull request opened", event: WebhookEvent{Name: "pull_request", Action: "opened", Branch: "master"}, expected: EventUnidle},
+		{name: "pull request labeled", event: WebhookEvent{Name: "pull_request", Action: "labeled", Branch: "master"}, expected: EventForward},
+		{name: "ping", event: WebhookEvent{Name: "ping"}, expected: EventDrop},
+		{name: "issue comment", event: WebhookEvent{Name: "issue_comment", Action: "created"}, expected: EventForward},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, policy.Outcome(test.event))
+		})
+	}
+}
+
+func TestEventPolicyZeroValueUnidles(t *testing.T) {
+	assert.Equal(t, EventUnidle, EventPolicy{}.Outcome(WebhookEvent{Name: "watch", Action: "started"}))
+}
+
+func TestNewEventPolicyInvalid(t *testing.T) {
+	_, err := NewEventPolicy(map[string]string{"push": "maybe"}, nil, nil)
+	assert.Error(t, err, "an unknown outcome should be rejected")
+
+	_, err = NewEventPolicy(nil, nil, []string{"release/["})
+	assert.Error(t, err, "a malformed branch pattern should be rejected")
+}
+
+func TestGitHubEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		payload  string
+		expected WebhookEvent
+	}{
+		{name: "push", header: "push", payload: `{"ref": "refs/heads/master"}`, expected: WebhookEvent{Name: "push", Branch: "master"}},
+		{name: "tag push", header: "push", payload: `{"ref": "refs/tags/v1.0"}`, expected: WebhookEvent{Name: "push"}},
+		{name: "create branch", header: "create", payload: `{"ref": "feature", "ref_type": "branch"}`, expected: WebhookEvent{Name: "create", Branch: "feature"}},
+		{name: "pull request", header: "pull_request", payload: `{"action": "opened", "pull_request": {"base": {"ref": "master"}}}`, expected: WebhookEvent{Name: "pull_request", Action: "opened", Branch: "master"}},
+		{name: "star", header: "watch", payload: `{"action": "started"}`, expected: WebhookEvent{Name: "watch", Action: "started"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://proxy/github-webhook/", nil)
+			req.Header.Set(GHEventHeader, test.header)
+
+			event, err := (&gitHubProvider{}).Event(req, []byte(test.payload))
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, event)
+		})
+	}
+}
+
+func TestGHWebHookRequestDropped(t *testing.T) {
+	p := NewMock(idler.Idled, wit.DefaultMockOwner)
+	p.eventPolicy = testEventPolicy(t)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://proxy/github-webhook/", bytes.NewReader(ghPayload()))
+	req.Header.Set(GHHeader, GHAgent+"/c494ff1")
+	req.Header.Set(GHEventHeader, "ping")
+
+	ns, okToForward := p.handleWebhookRequest(w, req, &gitHubProvider{}, proxyLogger)
+
+	assert.Equal(t, "", ns)
+	assert.False(t, okToForward, "A dropped event should not be forwarded")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	ok := cached(p.TenantCache, "https://github.com/test-username/test-repo.git")
+	assert.False(t, ok, "A dropped event should not be looked up")
+}
+
+func TestGHWebHookRequestForwardOnly(t *testing.T) {
+	tests := []struct {
+		state       idler.PodState
+		okToForward bool
+	}{
+		{state: idler.Idled, okToForward: false},
+		{state: idler.Running, okToForward: true},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.state), func(t *testing.T) {
+			p := NewMock(test.state, wit.DefaultMockOwner)
+			p.eventPolicy = testEventPolicy(t)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "http://proxy/github-webhook/", bytes.NewReader(ghPayload()))
+			req.Header.Set(GHHeader, GHAgent+"/c494ff1")
+			req.Header.Set(GHEventHeader, "issue_comment")
+
+			ns, okToForward := p.handleWebhookRequest(w, req, &gitHubProvider{}, proxyLogger)
+
+			assert.Equal(t, "namespace-jenkins", ns)
+			assert.Equal(t, test.okToForward, okToForward)
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
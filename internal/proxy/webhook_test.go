@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/wit"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	gitLabPayload = `{
+		"object_kind": "push",
+		"project": {
+			"name": "test-repo",
+			"web_url": "https://gitlab.com/test-username/test-repo",
+			"git_http_url": "https://gitlab.com/test-username/test-repo.git",
+			"path_with_namespace": "test-username/test-repo"
+		}
+	}`
+
+	bitbucketCloudPayload = `{
+		"repository": {
+			"name": "test-repo",
+			"full_name": "test-username/test-repo",
+			"links": {
+				"html": {"href": "https://bitbucket.org/test-username/test-repo"}
+			}
+		}
+	}`
+
+	bitbucketServerPayload = `{
+		"repository": {
+			"name": "test-repo",
+			"links": {
+				"clone": [
+					{"href": "ssh://git@bitbucket.example.com:7999/test/test-repo.git", "name": "ssh"},
+					{"href": "https://bitbucket.example.com/scm/test/test-repo.git", "name": "http"}
+				]
+			}
+		}
+	}`
+
+	genericPayload = `{"repository": {"url": "https://git.example.com/test-username/test-repo.git"}}`
+)
+
+func TestDetectWebhookProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		expected string
+	}{
+		{name: "GitHub", path: "/github-webhook/", headers: map[string]string{"User-Agent": "GitHub-Hookshot/c494ff1"}, expected: "GitHub"},
+		{name: "GitLab", path: "/project/test", headers: map[string]string{"X-Gitlab-Event": "Push Hook"}, expected: "GitLab"},
+		{name: "Bitbucket", path: "/bitbucket-hook/", headers: map[string]string{"X-Event-Key": "repo:push"}, expected: "Bitbucket"},
+		{name: "Generic", path: "/generic-webhook-trigger/invoke", headers: map[string]string{}, expected: "Generic"},
+		{name: "Jenkins UI", path: "/job/test", headers: map[string]string{"User-Agent": "Mozilla/5.0"}, expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://proxy"+test.path, nil)
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			provider := detectWebhookProvider(req)
+			if test.expected == "" {
+				assert.Nil(t, provider, "request should not be detected as a webhook")
+				return
+			}
+			if assert.NotNil(t, provider, "request should be detected as a webhook") {
+				assert.Equal(t, test.expected, provider.Name())
+			}
+		})
+	}
+}
+
+func TestWebhookProviderRepositoryURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider WebhookProvider
+		payload  string
+		expected string
+	}{
+		{name: "GitHub", provider: &gitHubProvider{}, payload: string(ghPayload()), expected: "https://github.com/test-username/test-repo.git"},
+		{name: "GitLab", provider: &gitLabProvider{}, payload: gitLabPayload, expected: "https://gitlab.com/test-username/test-repo.git"},
+		{name: "Bitbucket Cloud", provider: &bitbucketProvider{}, payload: bitbucketCloudPayload, expected: "https://bitbucket.org/test-username/test-repo.git"},
+		{name: "Bitbucket Server", provider: &bitbucketProvider{}, payload: bitbucketServerPayload, expected: "https://bitbucket.example.com/scm/test/test-repo.git"},
+		{name: "Generic", provider: &genericProvider{}, payload: genericPayload, expected: "https://git.example.com/test-username/test-repo.git"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := test.provider.RepositoryURL([]byte(test.payload))
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, u)
+		})
+	}
+}
+
+func TestWebhookProviderRepositoryURLMissing(t *testing.T) {
+	for _, provider := range webhookProviders {
+		_, err := provider.RepositoryURL([]byte(`{}`))
+		assert.Error(t, err, "%s should fail on a payload without repository", provider.Name())
+	}
+}
+
+func TestGitLabWebHookRequestJenkinsIdled(t *testing.T) {
+	p := NewMock(idler.Idled, wit.DefaultMockOwner)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://proxy/project/test", bytes.NewBufferString(gitLabPayload))
+	req.Header.Set(GitLabEventHeader, "Push Hook")
+
+	ns, okToForward := p.handleWebhookRequest(w, req, &gitLabProvider{}, proxyLogger)
+
+	assert.Equal(t, "namespace-jenkins", ns)
+	assert.False(t, okToForward, "It should not be ok to forward, because state of jenkins is idled")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	ok := cached(p.TenantCache, "https://gitlab.com/test-username/test-repo.git")
+	assert.True(t, ok, "An entry should have been created in tenant cache with repo url as key")
+}
+
+func TestBitbucketWebHookRequestJenkinsRunning(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://proxy/bitbucket-hook/", bytes.NewBufferString(bitbucketCloudPayload))
+	req.Header.Set(BitbucketEventHeader, "repo:push")
+
+	ns, okToForward := p.handleWebhookRequest(w, req, &bitbucketProvider{}, proxyLogger)
+
+	assert.Equal(t, "namespace-jenkins", ns)
+	assert.True(t, okToForward, "It should be ok to forward, because state of jenkins is running")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func sign(h func() hash.Hash, secret string, payload []byte) string {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitHubVerifySignature(t *testing.T) {
+	payload := ghPayload()
+	tests := []struct {
+		name    string
+		headers map[string]string
+		valid   bool
+	}{
+		{name: "sha256", headers: map[string]string{GHSignature256Header: "sha256=" + sign(sha256.New, "secret", payload)}, valid: true},
+		{name: "sha1", headers: map[string]string{GHSignatureHeader: "sha1=" + sign(sha1.New, "secret", payload)}, valid: true},
+		{name: "sha256 preferred", headers: map[string]string{
+			GHSignature256Header: "sha256=" + sign(sha256.New, "wrong", payload),
+			GHSignatureHeader:    "sha1=" + sign(sha1.New, "secret", payload),
+		}, valid: false},
+		{name: "wrong secret", headers: map[string]string{GHSignature256Header: "sha256=" + sign(sha256.New, "wrong", payload)}, valid: false},
+		{name: "wrong algorithm", headers: map[string]string{GHSignature256Header: "sha1=" + sign(sha1.New, "secret", payload)}, valid: false},
+		{name: "not hex", headers: map[string]string{GHSignature256Header: "sha256=xyz"}, valid: false},
+		{name: "missing", headers: map[string]string{}, valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://proxy/github-webhook/", nil)
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			err := (&gitHubProvider{}).VerifySignature(req, payload, "secret")
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, ErrInvalidSignature, err)
+			}
+		})
+	}
+}
+
+func TestGitLabAndBitbucketVerifySignature(t *testing.T) {
+	payload := []byte(gitLabPayload)
+	tests := []struct {
+		name     string
+		provider SignatureVerifier
+		headers  map[string]string
+		valid    bool
+	}{
+		{name: "gitlab token", provider: &gitLabProvider{}, headers: map[string]string{GitLabTokenHeader: "secret"}, valid: true},
+		{name: "gitlab wrong token", provider: &gitLabProvider{}, headers: map[string]string{GitLabTokenHeader: "wrong"}, valid: false},
+		{name: "gitlab missing", provider: &gitLabProvider{}, headers: map[string]string{}, valid: false},
+		{name: "bitbucket sha256", provider: &bitbucketProvider{}, headers: map[string]string{BitbucketSignatureHeader: "sha256=" + sign(sha256.New, "secret", payload)}, valid: true},
+		{name: "bitbucket wrong secret", provider: &bitbucketProvider{}, headers: map[string]string{BitbucketSignatureHeader: "sha256=" + sign(sha256.New, "wrong", payload)}, valid: false},
+		{name: "bitbucket missing", provider: &bitbucketProvider{}, headers: map[string]string{}, valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://proxy/webhook/", nil)
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			err := test.provider.VerifySignature(req, payload, "secret")
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, ErrInvalidSignature, err)
+			}
+		})
+	}
+}
+
+func TestGenericWebHookRequestRejectedWithSecret(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.webhookSecret = "global"
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://proxy"+GenericWebhookPath+"invoke", bytes.NewBufferString(gitLabPayload))
+
+	ns, okToForward := p.handleWebhookRequest(w, req, &genericProvider{}, proxyLogger)
+
+	assert.Equal(t, "", ns)
+	assert.False(t, okToForward, "A webhook which cannot be verified should not be forwarded once a secret is set")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestGHWebHookRequestInvalidSignature(t *testing.T) {
+	p := NewMock(idler.Idled, wit.DefaultMockOwner)
+	p.webhookSecret = "global"
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://proxy/github-webhook/", bytes.NewReader(ghPayload()))
+	req.Header.Set(GHHeader, GHAgent+"/c494ff1")
+	req.Header.Set(GHSignature256Header, "sha256="+sign(sha256.New, "other", ghPayload()))
+
+	ns, okToForward := p.handleWebhookRequest(w, req, &gitHubProvider{}, proxyLogger)
+
+	assert.Equal(t, "", ns)
+	assert.False(t, okToForward, "A webhook with an invalid signature should not be forwarded")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	ok := cached(p.TenantCache, "https://github.com/test-username/test-repo.git")
+	assert.False(t, ok, "A webhook with an invalid signature should not be looked up")
+}
+
+func TestGHWebHookRequestCodebaseSecret(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.webhookSecret = "global"
+	p.webhookSecrets = webhookSecretsByRepository(map[string]string{"https://github.com/test-username/test-repo.git": "codebase"})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://proxy/github-webhook/", bytes.NewReader(ghPayload()))
+	req.Header.Set(GHHeader, GHAgent+"/c494ff1")
+	req.Header.Set(GHSignature256Header, "sha256="+sign(sha256.New, "codebase", ghPayload()))
+
+	ns, okToForward := p.handleWebhookRequest(w, req, &gitHubProvider{}, proxyLogger)
+
+	assert.Equal(t, "namespace-jenkins", ns)
+	assert.True(t, okToForward, "A webhook signed with the codebase secret should be forwarded")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGHWebHookRequestCodebaseSecretOfURLVariant(t *testing.T) {
+	p := NewMock(idler.Running, wit.DefaultMockOwner)
+	p.webhookSecrets = webhookSecretsByRepository(map[string]string{"https://GitHub.com/test-username/test-repo/": "codebase"})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://proxy/github-webhook/", bytes.NewReader(ghPayload()))
+	req.Header.Set(GHHeader, GHAgent+"/c494ff1")
+
+	ns, okToForward := p.handleWebhookRequest(w, req, &gitHubProvider{}, proxyLogger)
+
+	assert.Equal(t, "", ns)
+	assert.False(t, okToForward, "An unsigned webhook should be rejected if its repository has a secret under another form of its URL")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/api"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/health"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/jenkinsapi"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/proxy"
 	"github.com/julienschmidt/httprouter"
@@ -11,11 +12,30 @@ import (
 )
 
 // CreateAPIRouter is creating a router for the REST API of the Proxy.
-func CreateAPIRouter(api api.ProxyAPI) *httprouter.Router {
+// Requests are checked by the authorizer unless it is nil, except for the liveness
+// and readiness probes served by the checker.
+func CreateAPIRouter(proxyAPI api.ProxyAPI, authorizer *api.Authorizer, checker *health.Checker) *httprouter.Router {
 	// Create router for API
 	proxyRouter := httprouter.New()
-	proxyRouter.GET("/api/info/:namespace", api.Info)
-	proxyRouter.Handler("GET", "/metrics", promhttp.Handler())
+	proxyRouter.GET("/api/info/:namespace", authorizer.Namespace(proxyAPI.Info))
+	proxyRouter.GET("/api/requests/:namespace", authorizer.Namespace(proxyAPI.Requests))
+	proxyRouter.DELETE("/api/requests/:namespace", authorizer.ServiceAccount(proxyAPI.PurgeRequests))
+	proxyRouter.GET("/api/requests/:namespace/:id", authorizer.ServiceAccount(proxyAPI.Request))
+	proxyRouter.DELETE("/api/requests/:namespace/:id", authorizer.ServiceAccount(proxyAPI.DeleteRequest))
+	proxyRouter.POST("/api/requests/:namespace/:id/replay", authorizer.ServiceAccount(proxyAPI.ReplayRequest))
+	proxyRouter.GET("/api/readiness/:namespace", authorizer.Namespace(proxyAPI.Readiness))
+	proxyRouter.GET("/api/deadletters", authorizer.ServiceAccount(proxyAPI.DeadLetters))
+	proxyRouter.GET("/api/deadletters/:id", authorizer.ServiceAccount(proxyAPI.DeadLetter))
+	proxyRouter.POST("/api/deadletters/:id/requeue", authorizer.ServiceAccount(proxyAPI.RequeueDeadLetter))
+	proxyRouter.POST("/api/purge", authorizer.ServiceAccount(proxyAPI.PurgeExpired))
+
+	proxyRouter.GET("/healthz", checker.Live)
+	proxyRouter.GET("/readyz", checker.Ready)
+
+	metrics := promhttp.Handler()
+	proxyRouter.GET("/metrics", authorizer.ServiceAccount(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		metrics.ServeHTTP(w, r)
+	}))
 	return proxyRouter
 }
 
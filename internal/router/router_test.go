@@ -5,12 +5,18 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/api"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/auth"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/health"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/idler"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/jenkinsapi"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/storage"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tenant"
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/require"
 )
@@ -48,6 +54,46 @@ func (i *mockProxyAPI) Info(w http.ResponseWriter, r *http.Request, ps httproute
 	w.WriteHeader(http.StatusOK)
 }
 
+func (i *mockProxyAPI) DeadLetters(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Write([]byte("DeadLetters"))
+}
+
+func (i *mockProxyAPI) DeadLetter(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Write([]byte("DeadLetter " + ps.ByName("id")))
+}
+
+func (i *mockProxyAPI) RequeueDeadLetter(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Write([]byte("RequeueDeadLetter " + ps.ByName("id")))
+}
+
+func (i *mockProxyAPI) Requests(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Write([]byte("Requests " + ps.ByName("namespace")))
+}
+
+func (i *mockProxyAPI) Request(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Write([]byte("Request " + ps.ByName("namespace") + " " + ps.ByName("id")))
+}
+
+func (i *mockProxyAPI) DeleteRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Write([]byte("DeleteRequest " + ps.ByName("namespace") + " " + ps.ByName("id")))
+}
+
+func (i *mockProxyAPI) ReplayRequest(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Write([]byte("ReplayRequest " + ps.ByName("namespace") + " " + ps.ByName("id")))
+}
+
+func (i *mockProxyAPI) PurgeRequests(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Write([]byte("PurgeRequests " + ps.ByName("namespace")))
+}
+
+func (i *mockProxyAPI) PurgeExpired(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Write([]byte("PurgeExpired"))
+}
+
+func (i *mockProxyAPI) Readiness(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Write([]byte("Readiness " + ps.ByName("namespace")))
+}
+
 type mockJenkinsAPI struct{}
 
 // Start mock returns the Jenkins status for the current user
@@ -86,16 +132,87 @@ func (api *mockJenkinsAPI) Status(w http.ResponseWriter, r *http.Request, _ http
 
 func Test_API_routes_are_setup(t *testing.T) {
 	mockedProxyAPI := &mockProxyAPI{}
-	mockedRouter := CreateAPIRouter(mockedProxyAPI)
+	mockedRouter := CreateAPIRouter(mockedProxyAPI, nil, health.NewChecker(time.Second))
 	req, _ := http.NewRequest("GET", "/api/info/:namespace", nil)
 	w := new(mockResponseWriter)
 	mockedRouter.ServeHTTP(w, req)
 	require.Equal(t, "Info", w.GetBody(), "Routing failed for /api/info/:namespace")
 
+	for _, route := range []struct{ method, path, body string }{
+		{"GET", "/api/requests/foo", "Requests foo"},
+		{"DELETE", "/api/requests/foo", "PurgeRequests foo"},
+		{"GET", "/api/requests/foo/42", "Request foo 42"},
+		{"DELETE", "/api/requests/foo/42", "DeleteRequest foo 42"},
+		{"POST", "/api/requests/foo/42/replay", "ReplayRequest foo 42"},
+		{"POST", "/api/purge", "PurgeExpired"},
+		{"GET", "/api/readiness/foo", "Readiness foo"},
+	} {
+		req, _ = http.NewRequest(route.method, route.path, nil)
+		w = new(mockResponseWriter)
+		mockedRouter.ServeHTTP(w, req)
+		require.Equal(t, route.body, w.GetBody(), "Routing failed for %s %s", route.method, route.path)
+	}
+
+	req, _ = http.NewRequest("GET", "/api/deadletters", nil)
+	w = new(mockResponseWriter)
+	mockedRouter.ServeHTTP(w, req)
+	require.Equal(t, "DeadLetters", w.GetBody(), "Routing failed for /api/deadletters")
+
+	req, _ = http.NewRequest("GET", "/api/deadletters/42", nil)
+	w = new(mockResponseWriter)
+	mockedRouter.ServeHTTP(w, req)
+	require.Equal(t, "DeadLetter 42", w.GetBody(), "Routing failed for /api/deadletters/:id")
+
+	req, _ = http.NewRequest("POST", "/api/deadletters/42/requeue", nil)
+	w = new(mockResponseWriter)
+	mockedRouter.ServeHTTP(w, req)
+	require.Equal(t, "RequeueDeadLetter 42", w.GetBody(), "Routing failed for /api/deadletters/:id/requeue")
+
 	req, _ = http.NewRequest("GET", "/metrics", nil)
 	w = new(mockResponseWriter)
 	mockedRouter.ServeHTTP(w, req)
 	require.Contains(t, w.GetBody(), "go_gc_duration_seconds", "Routing failed for /metrics")
+
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	w = new(mockResponseWriter)
+	mockedRouter.ServeHTTP(w, req)
+	require.Contains(t, w.GetBody(), `"status":"ok"`, "Routing failed for /readyz")
+}
+
+func Test_API_routes_are_authorized(t *testing.T) {
+	mockedProxyAPI := &mockProxyAPI{}
+	serve := func(authorizer *api.Authorizer, method string, path string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		CreateAPIRouter(mockedProxyAPI, authorizer, health.NewChecker(time.Second)).ServeHTTP(w, req)
+		return w
+	}
+
+	// the mocked auth service reports test_subject as subject of every token
+	users := api.NewAuthorizer(auth.NewMockAuth("http://authURL"), tenant.Mock{}, []string{"sa-subject"})
+	require.Equal(t, http.StatusUnauthorized, serve(users, "GET", "/api/info/namespace-jenkins", "").Code, "Request without token should be rejected")
+	require.Equal(t, http.StatusOK, serve(users, "GET", "/api/info/namespace-jenkins", "ValidToken").Code, "User should read own namespace")
+	require.Equal(t, http.StatusOK, serve(users, "GET", "/api/requests/namespace", "ValidToken").Code, "User should read own namespace")
+	require.Equal(t, http.StatusOK, serve(users, "GET", "/api/readiness/namespace-jenkins", "ValidToken").Code, "User should read own namespace")
+	require.Equal(t, http.StatusForbidden, serve(users, "GET", "/api/info/other-jenkins", "ValidToken").Code, "User should not read other namespaces")
+	require.Equal(t, http.StatusForbidden, serve(users, "GET", "/api/readiness/other-jenkins", "ValidToken").Code, "User should not read other namespaces")
+	require.Equal(t, http.StatusForbidden, serve(users, "DELETE", "/api/requests/namespace-jenkins", "ValidToken").Code, "User should not purge namespaces")
+	require.Equal(t, http.StatusForbidden, serve(users, "GET", "/api/requests/namespace-jenkins/42", "ValidToken").Code, "User should not read buffered requests with their headers")
+	require.Equal(t, http.StatusForbidden, serve(users, "GET", "/api/deadletters", "ValidToken").Code, "User should not list dead letters")
+	require.Equal(t, http.StatusForbidden, serve(users, "GET", "/metrics", "ValidToken").Code, "User should not read metrics")
+	require.Equal(t, http.StatusForbidden, serve(users, "POST", "/api/purge", "ValidToken").Code, "User should not purge expired rows")
+	require.Equal(t, http.StatusOK, serve(users, "GET", "/healthz", "").Code, "Liveness probe should need no token")
+	require.Equal(t, http.StatusOK, serve(users, "GET", "/readyz", "").Code, "Readiness probe should need no token")
+
+	serviceAccounts := api.NewAuthorizer(auth.NewMockAuth("http://authURL"), tenant.Mock{}, []string{"test_subject"})
+	require.Equal(t, http.StatusOK, serve(serviceAccounts, "GET", "/api/info/other-jenkins", "SAToken").Code, "Service account should read every namespace")
+	require.Equal(t, http.StatusOK, serve(serviceAccounts, "DELETE", "/api/requests/other-jenkins", "SAToken").Code, "Service account should purge namespaces")
+	require.Equal(t, http.StatusOK, serve(serviceAccounts, "GET", "/api/requests/other-jenkins/42", "SAToken").Code, "Service account should read buffered requests")
+	require.Equal(t, http.StatusOK, serve(serviceAccounts, "GET", "/api/deadletters", "SAToken").Code, "Service account should list dead letters")
+	require.Equal(t, http.StatusOK, serve(serviceAccounts, "GET", "/metrics", "SAToken").Code, "Service account should read metrics")
 }
 
 func Test_JenkinsAPI_routes_are_setup(t *testing.T) {
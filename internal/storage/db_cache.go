@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DBCache is a cache shared by all replicas connected to the same database.
+// Entries of all caches are kept in the cache_entries table, keyed by cache name.
+// Keys are stored hashed, as they may be secrets like session cookies.
+type DBCache struct {
+	db              *gorm.DB
+	name            string
+	ttl             time.Duration
+	cleanupInterval time.Duration
+
+	lock        sync.Mutex
+	lastCleanup time.Time
+}
+
+// NewCache creates the named cache in the database of the store. Expired entries are
+// removed on writes, at most once every cleanup interval.
+func (s *DBStore) NewCache(name string, ttl time.Duration, cleanupInterval time.Duration) *DBCache {
+	return &DBCache{
+		db:              s.db,
+		name:            name,
+		ttl:             ttl,
+		cleanupInterval: cleanupInterval,
+		lastCleanup:     time.Now(),
+	}
+}
+
+// Get decodes the value of the given key into value.
+func (c *DBCache) Get(key string, value interface{}) (bool, error) {
+	var data []byte
+	err := c.db.Raw("SELECT value FROM cache_entries WHERE cache = ? AND key = ? AND expires_at > ?", c.name, hashKey(key), time.Now()).
+		Row().Scan(&data)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+// Set caches the value for the given key.
+func (c *DBCache) Set(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	err = c.db.Exec(`INSERT INTO cache_entries (cache, key, value, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (cache, key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`,
+		c.name, hashKey(key), data, time.Now().Add(c.ttl)).Error
+	if err != nil {
+		return err
+	}
+	return c.cleanup()
+}
+
+// Delete removes the given key.
+func (c *DBCache) Delete(key string) error {
+	return c.db.Exec("DELETE FROM cache_entries WHERE cache = ? AND key = ?", c.name, hashKey(key)).Error
+}
+
+// hashKey returns the hex encoded SHA-256 of a key, which is stored instead of the key
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// cleanup removes the expired entries of the cache if the cleanup interval passed since the last cleanup.
+func (c *DBCache) cleanup() error {
+	c.lock.Lock()
+	if time.Since(c.lastCleanup) < c.cleanupInterval {
+		c.lock.Unlock()
+		return nil
+	}
+	c.lastCleanup = time.Now()
+	c.lock.Unlock()
+
+	db := c.db.Exec("DELETE FROM cache_entries WHERE cache = ? AND expires_at <= ?", c.name, time.Now())
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected > 0 {
+		storeLogger.WithField("cache", c.name).Debugf("Removed %d expired cache entries", db.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cachedSession struct {
+	NS    string
+	Route string
+}
+
+func Test_db_cache_is_shared_between_stores(t *testing.T) {
+	db, store, _ := setUp(t)
+	defer db.Close()
+	other, _, _ := setUp(t)
+	defer other.Close()
+
+	sessions := store.(*DBStore).NewCache("sessions", time.Hour, time.Hour)
+	replica := NewDBStorage(other).(*DBStore).NewCache("sessions", time.Hour, time.Hour)
+	tenants := store.(*DBStore).NewCache("tenants", time.Hour, time.Hour)
+
+	require.NoError(t, sessions.Set("cookie", cachedSession{NS: "foo", Route: "jenkins-foo"}))
+	var raw int
+	require.NoError(t, db.Raw("SELECT count(*) FROM cache_entries WHERE key = ?", "cookie").Row().Scan(&raw))
+	assert.Equal(t, 0, raw, "Keys should not be stored in plain text.")
+
+	var s cachedSession
+	found, err := replica.Get("cookie", &s)
+	require.NoError(t, err)
+	assert.True(t, found, "Session cached by one replica should be known to the other.")
+	assert.Equal(t, cachedSession{NS: "foo", Route: "jenkins-foo"}, s)
+
+	found, err = tenants.Get("cookie", &s)
+	require.NoError(t, err)
+	assert.False(t, found, "Caches should not share keys.")
+
+	require.NoError(t, sessions.Set("cookie", cachedSession{NS: "bar"}))
+	_, err = replica.Get("cookie", &s)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", s.NS, "Setting a key again should replace its value.")
+
+	require.NoError(t, replica.Delete("cookie"))
+	found, err = sessions.Get("cookie", &s)
+	require.NoError(t, err)
+	assert.False(t, found, "Session deleted by one replica should be gone for the other.")
+}
+
+func Test_db_cache_entries_expire(t *testing.T) {
+	db, store, _ := setUp(t)
+	defer db.Close()
+
+	c := store.(*DBStore).NewCache("expiring", 10*time.Millisecond, 0)
+	require.NoError(t, c.Set("a", true))
+	time.Sleep(20 * time.Millisecond)
+
+	var forwarded bool
+	found, err := c.Get("a", &forwarded)
+	require.NoError(t, err)
+	assert.False(t, found, "Entry should have expired.")
+
+	// writing removes expired entries once the cleanup interval passed
+	require.NoError(t, c.Set("b", true))
+	var count int
+	require.NoError(t, db.Raw("SELECT COUNT(*) FROM cache_entries WHERE cache = 'expiring' AND key = 'a'").Row().Scan(&count))
+	assert.Equal(t, 0, count, "Expired entry should have been removed.")
+}
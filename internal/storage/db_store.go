@@ -1,17 +1,28 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/jinzhu/gorm"
-	// Importing postgres driver to connect to the database
-	// The underscore import is used for the side-effect of a package.
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 )
 
 var dbLogger = log.WithFields(log.Fields{"component": "db"})
 
+// uniqueViolation is the Postgres error code for a violated unique constraint
+const uniqueViolation = "23505"
+
+// claimLockID is the first key of the Postgres advisory lock held while claiming the requests
+// of a namespace, the second key is the hash of the namespace.
+const claimLockID = 1392706713
+
+// readinessLockID is the first key of the Postgres advisory lock held while changing the readiness
+// measurements of a namespace, the second key is the hash of the namespace.
+const readinessLockID = 1392706714
+
 // NewDBStorage creates an instance of database client.
 func NewDBStorage(db *gorm.DB) Store {
 	return &DBStore{db: db}
@@ -23,17 +34,104 @@ type DBStore struct {
 }
 
 // CreateRequest creates an entry of request in the database.
+// It returns ErrDuplicateDelivery if the delivery ID of the request is already stored.
 func (s *DBStore) CreateRequest(r *Request) error {
-	return s.db.Create(r).Error
+	err := s.db.Create(r).Error
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation && r.DeliveryID != nil {
+		return ErrDuplicateDelivery
+	}
+	return err
+}
+
+// GetRequestByDeliveryID gets the request of a webhook delivery from the database.
+func (s *DBStore) GetRequestByDeliveryID(id string) (r *Request, notFound bool, err error) {
+	r = &Request{}
+	d := s.db.Table(r.TableName()).Where("delivery_id = ?", id).First(r)
+	err = d.Error
+	notFound = d.RecordNotFound()
+	return
 }
 
 // GetRequests gets one or more requests from the database given a namespace as input.
+// The requests are ordered by the time they were buffered, oldest first.
 func (s *DBStore) GetRequests(ns string) (result []Request, err error) {
 	var r Request
-	err = s.db.Table(r.TableName()).Where("namespace = ?", ns).Find(&result).Error
+	err = s.db.Table(r.TableName()).Where("namespace = ?", ns).Order("created_at ASC NULLS FIRST").Find(&result).Error
+	return
+}
+
+// ClaimRequests leases the requests of a namespace to owner in the database, unless another
+// owner holds an unexpired lease on any of them. Leases expire by the clock of the database,
+// so that clocks of replicas cannot disagree on them.
+func (s *DBStore) ClaimRequests(ns string, owner string, lease time.Duration) (result []Request, err error) {
+	var r Request
+	tx := s.db.Begin()
+	// Claims of a namespace are serialized, so that two replicas never both see it unclaimed
+	if err = tx.Exec("SELECT pg_advisory_xact_lock(?, hashtext(?))", claimLockID, ns).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Exec(`UPDATE requests SET lease_owner = ?, lease_expires_at = now() + make_interval(secs => ?)
+		WHERE namespace = ? AND NOT EXISTS (SELECT 1 FROM requests
+			WHERE namespace = ? AND lease_owner <> ? AND lease_expires_at > now())`,
+		owner, lease.Seconds(), ns, ns, owner).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Table(r.TableName()).Where("namespace = ? AND lease_owner = ?", ns, owner).
+		Order("created_at ASC NULLS FIRST").Find(&result).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return result, tx.Commit().Error
+}
+
+// ReleaseRequests ends the lease of owner on the requests of a namespace in the database.
+func (s *DBStore) ReleaseRequests(ns string, owner string) error {
+	return s.db.Exec("UPDATE requests SET lease_owner = NULL, lease_expires_at = NULL WHERE namespace = ? AND lease_owner = ?",
+		ns, owner).Error
+}
+
+// GetRequestsPage gets a page of the requests of a namespace from the database.
+// The requests are ordered by the time they were buffered, oldest first.
+func (s *DBStore) GetRequestsPage(ns string, offset int, limit int) (result []Request, err error) {
+	var r Request
+	err = s.db.Table(r.TableName()).Where("namespace = ?", ns).Order("created_at ASC NULLS FIRST").Order("id").
+		Offset(offset).Limit(limit).Find(&result).Error
+	return
+}
+
+// GetRequest gets a request by its ID from the database.
+func (s *DBStore) GetRequest(id string) (r *Request, notFound bool, err error) {
+	r = &Request{}
+	d := s.db.Table(r.TableName()).Where("id = ?", id).First(r)
+	err = d.Error
+	notFound = d.RecordNotFound()
 	return
 }
 
+// ResetNextAttempt clears the next attempt of a request in the database.
+func (s *DBStore) ResetNextAttempt(r *Request) error {
+	r.NextAttempt = nil
+	return s.db.Model(r).Update("next_attempt", gorm.Expr("NULL")).Error
+}
+
+// DeleteRequests deletes all requests of a namespace from the database.
+func (s *DBStore) DeleteRequests(ns string) (deleted int64, err error) {
+	var r Request
+	d := s.db.Where("namespace = ?", ns).Delete(&r)
+	return d.RowsAffected, d.Error
+}
+
+// DeleteRequestsBefore deletes the requests buffered before t from the database.
+func (s *DBStore) DeleteRequestsBefore(t time.Time) (deleted int64, err error) {
+	var r Request
+	d := s.db.Where("created_at < ?", t).Delete(&r)
+	return d.RowsAffected, d.Error
+}
+
 // IncrementRequestRetry increases retries for a given request in the database.
 func (s *DBStore) IncrementRequestRetry(r *Request) (errs []error) {
 	r.Retries++
@@ -69,6 +167,67 @@ func (s *DBStore) DeleteRequest(r *Request) error {
 	return s.db.Delete(r).Error
 }
 
+// MoveToDeadLetters stores the dead letter of a request and deletes the request in one transaction.
+func (s *DBStore) MoveToDeadLetters(r *Request) error {
+	tx := s.db.Begin()
+	if err := tx.Create(NewDeadLetter(*r)).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(r).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// GetDeadLetters gets the dead letters of a namespace from the database, most recent first.
+// The dead letters of all namespaces are returned if ns is empty.
+func (s *DBStore) GetDeadLetters(ns string) (result []DeadLetter, err error) {
+	var d DeadLetter
+	query := s.db.Table(d.TableName())
+	if ns != "" {
+		query = query.Where("namespace = ?", ns)
+	}
+	err = query.Order("dead_at DESC").Find(&result).Error
+	return
+}
+
+// GetDeadLetter gets a dead letter by its ID from the database.
+func (s *DBStore) GetDeadLetter(id string) (d *DeadLetter, notFound bool, err error) {
+	d = &DeadLetter{}
+	q := s.db.Table(d.TableName()).Where("id = ?", id).First(d)
+	err = q.Error
+	notFound = q.RecordNotFound()
+	return
+}
+
+// RequeueDeadLetter buffers the request of a dead letter again and deletes the dead letter in one transaction.
+// It returns ErrDuplicateDelivery if a redelivery of the request is already buffered.
+func (s *DBStore) RequeueDeadLetter(d *DeadLetter) error {
+	r := d.Request()
+	tx := s.db.Begin()
+	if err := tx.Create(r).Error; err != nil {
+		tx.Rollback()
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation && r.DeliveryID != nil {
+			return ErrDuplicateDelivery
+		}
+		return err
+	}
+	if err := tx.Delete(d).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// DeleteDeadLettersBefore deletes the dead letters given up on before t from the database.
+func (s *DBStore) DeleteDeadLettersBefore(t time.Time) (deleted int64, err error) {
+	var d DeadLetter
+	q := s.db.Where("dead_at < ?", t).Delete(&d)
+	return q.RowsAffected, q.Error
+}
+
 // CreateStatistics creates an entry of Statistics in the database.
 func (s *DBStore) CreateStatistics(o *Statistics) error {
 	return s.db.Create(o).Error
@@ -89,6 +248,13 @@ func (s *DBStore) GetStatisticsUser(ns string) (o *Statistics, notFound bool, er
 	return
 }
 
+// DeleteStatisticsBefore deletes the statistics of namespaces neither accessed nor buffered to since t from the database.
+func (s *DBStore) DeleteStatisticsBefore(t time.Time) (deleted int64, err error) {
+	var o Statistics
+	d := s.db.Where("last_accessed < ? AND last_buffered_request < ?", t.Unix(), t.Unix()).Delete(&o)
+	return d.RowsAffected, d.Error
+}
+
 // LogStats logs number of cached number of cached requests and statistics entries count.
 func (s *DBStore) LogStats() {
 	var requestCount, statisticCount int
@@ -97,6 +263,87 @@ func (s *DBStore) LogStats() {
 	dbLogger.Infof("Cached requests: %d. Statistic entries count: %d", requestCount, statisticCount)
 }
 
+// Ping checks that the database can be reached.
+func (s *DBStore) Ping(ctx context.Context) error {
+	return s.db.DB().PingContext(ctx)
+}
+
 func (s *DBStore) updateRequest(r *Request) error {
 	return s.db.Save(r).Error
 }
+
+// StartReadiness stores a readiness measurement in the database, unless one of the same namespace
+// is pending since pendingSince or later. Older pending measurements are deleted.
+func (s *DBStore) StartReadiness(r *Readiness, pendingSince time.Time) (started bool, err error) {
+	tx := s.db.Begin()
+	if err = lockReadiness(tx, r.Namespace); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	err = tx.Where("namespace = ? AND ready_at IS NULL AND unidled_at < ?", r.Namespace, pendingSince).Delete(&Readiness{}).Error
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	var pending int
+	err = tx.Table(r.TableName()).Where("namespace = ? AND ready_at IS NULL", r.Namespace).Count(&pending).Error
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if pending > 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	if err = tx.Create(r).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit().Error
+}
+
+// FinishReadiness marks the pending readiness measurement of a namespace ready in the database
+// and deletes all but the last keep measurements of the namespace.
+func (s *DBStore) FinishReadiness(ns string, readyAt time.Time, keep int) (r *Readiness, err error) {
+	tx := s.db.Begin()
+	if err = lockReadiness(tx, ns); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	r = &Readiness{}
+	q := tx.Table(r.TableName()).Where("namespace = ? AND ready_at IS NULL", ns).First(r)
+	if q.RecordNotFound() {
+		tx.Rollback()
+		return nil, nil
+	}
+	if q.Error != nil {
+		tx.Rollback()
+		return nil, q.Error
+	}
+	r.ReadyAt = &readyAt
+	if err = tx.Save(r).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Exec(`DELETE FROM readiness WHERE namespace = ? AND ready_at IS NOT NULL AND id NOT IN
+		(SELECT id FROM readiness WHERE namespace = ? AND ready_at IS NOT NULL ORDER BY unidled_at DESC LIMIT ?)`,
+		ns, ns, keep).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return r, tx.Commit().Error
+}
+
+// GetReadiness gets the readiness measurements of a namespace from the database, most recent first.
+func (s *DBStore) GetReadiness(ns string) (result []Readiness, err error) {
+	var r Readiness
+	err = s.db.Table(r.TableName()).Where("namespace = ?", ns).Order("unidled_at DESC").Find(&result).Error
+	return
+}
+
+// lockReadiness serializes the changes of the readiness measurements of a namespace until
+// the end of the transaction, so that two replicas never both start or finish one.
+func lockReadiness(tx *gorm.DB, ns string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?, hashtext(?))", readinessLockID, ns).Error
+}
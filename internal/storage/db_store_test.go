@@ -1,9 +1,11 @@
 package storage
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
 	"io/ioutil"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"testing"
@@ -98,3 +100,187 @@ func setUp(t *testing.T) (*gorm.DB, Store, *test.Hook) {
 
 	return db, store, hook
 }
+
+func Test_buffered_request_keeps_query_and_request_uri(t *testing.T) {
+	db, store, _ := setUp(t)
+	defer db.Close()
+
+	r := httptest.NewRequest("POST", "http://jenkins-foo.example.com/github-webhook/?token=s3cr3t", bytes.NewBufferString("{}"))
+	request, err := NewRequest(r, "query-ns", []byte("{}"))
+	assert.NoError(t, err, "Unexpected error creating request.")
+
+	err = store.CreateRequest(request)
+	assert.NoError(t, err, "Unexpected error storing request.")
+
+	requests, err := store.GetRequests("query-ns")
+	assert.NoError(t, err, "Unexpected error loading requests.")
+	if assert.Len(t, requests, 1, "Unexpected number of requests.") {
+		assert.Equal(t, "token=s3cr3t", requests[0].RawQuery)
+		assert.Equal(t, "/github-webhook/?token=s3cr3t", requests[0].RequestURI)
+	}
+}
+
+func Test_connect_migrates_existing_requests_table(t *testing.T) {
+	db, _, _ := setUp(t)
+	defer db.Close()
+
+	// recreate the requests table as it was before raw query and request URI were recorded
+	dropSchema(t, db)
+	err := db.Exec(`CREATE TABLE statistics (namespace text PRIMARY KEY, last_accessed bigint, last_buffered_request bigint)`).Error
+	assert.NoError(t, err, "Unexpected error creating legacy table.")
+	err = db.Exec(`CREATE TABLE requests (id uuid PRIMARY KEY, method text, headers bytea, payload bytea,
+		host text, scheme text, path text, namespace text, retries integer)`).Error
+	assert.NoError(t, err, "Unexpected error creating legacy table.")
+	err = db.Exec(`INSERT INTO requests (id, method, headers, payload, host, scheme, path, namespace, retries)
+		VALUES (?, 'POST', '{}', '{}', 'jenkins-foo.example.com', 'https', '/github-webhook/', 'legacy-ns', 0)`, uuid.NewV4().String()).Error
+	assert.NoError(t, err, "Unexpected error inserting legacy request.")
+
+	migrated, err := Connect(&mockConfig)
+	assert.NoError(t, err, "Unexpected error migrating.")
+	defer migrated.Close()
+
+	assert.True(t, migrated.NewScope(nil).Dialect().HasColumn("requests", "raw_query"), "raw_query column should have been added")
+	assert.True(t, migrated.NewScope(nil).Dialect().HasColumn("requests", "request_uri"), "request_uri column should have been added")
+
+	requests, err := NewDBStorage(migrated).GetRequests("legacy-ns")
+	assert.NoError(t, err, "Unexpected error loading legacy requests.")
+	if assert.Len(t, requests, 1, "Unexpected number of requests.") {
+		r, err := requests[0].GetHTTPRequest()
+		assert.NoError(t, err, "Unexpected error replaying legacy request.")
+		assert.Equal(t, "https://jenkins-foo.example.com/github-webhook/", r.URL.String())
+	}
+}
+
+func Test_delivery_id_is_unique(t *testing.T) {
+	db, store, _ := setUp(t)
+	defer db.Close()
+
+	deliveryID := uuid.NewV4().String()
+	request := &Request{ID: uuid.NewV4(), Namespace: "delivery-ns", DeliveryID: &deliveryID}
+	err := store.CreateRequest(request)
+	assert.NoError(t, err, "Unexpected error creating request.")
+
+	found, notFound, err := store.GetRequestByDeliveryID(deliveryID)
+	assert.NoError(t, err, "Unexpected error loading request.")
+	assert.False(t, notFound, "Request should have been found by delivery ID.")
+	assert.Equal(t, request.ID, found.ID)
+
+	redelivery := &Request{ID: uuid.NewV4(), Namespace: "delivery-ns", DeliveryID: &deliveryID}
+	err = store.CreateRequest(redelivery)
+	assert.Equal(t, ErrDuplicateDelivery, err, "Redelivery should have been rejected.")
+
+	_, notFound, err = store.GetRequestByDeliveryID(uuid.NewV4().String())
+	assert.True(t, notFound, "Unknown delivery ID should not be found.")
+
+	// requests without delivery ID never conflict
+	for i := 0; i < 2; i++ {
+		err = store.CreateRequest(&Request{ID: uuid.NewV4(), Namespace: "delivery-ns"})
+		assert.NoError(t, err, "Unexpected error creating request without delivery ID.")
+	}
+}
+
+func Test_dead_letters_can_be_listed_and_requeued(t *testing.T) {
+	db, store, _ := setUp(t)
+	defer db.Close()
+
+	deliveryID := uuid.NewV4().String()
+	r := httptest.NewRequest("POST", "http://jenkins-foo.example.com/github-webhook/", bytes.NewBufferString("{}"))
+	request, err := NewRequest(r, "dead-ns", []byte("{}"))
+	assert.NoError(t, err, "Unexpected error creating request.")
+	request.DeliveryID = &deliveryID
+	err = store.CreateRequest(request)
+	assert.NoError(t, err, "Unexpected error storing request.")
+
+	request.Retries = 10
+	request.LastStatus = 500
+	request.LastError = `got status "500 Internal Server Error"`
+	err = store.MoveToDeadLetters(request)
+	assert.NoError(t, err, "Unexpected error moving request to dead letters.")
+
+	requests, err := store.GetRequests("dead-ns")
+	assert.NoError(t, err, "Unexpected error loading requests.")
+	assert.Len(t, requests, 0, "Dead request should no longer be buffered.")
+
+	deadLetters, err := store.GetDeadLetters("dead-ns")
+	assert.NoError(t, err, "Unexpected error loading dead letters.")
+	if assert.Len(t, deadLetters, 1, "Unexpected number of dead letters.") {
+		assert.Equal(t, request.ID, deadLetters[0].ID)
+		assert.Equal(t, 500, deadLetters[0].LastStatus)
+		assert.Equal(t, request.LastError, deadLetters[0].LastError)
+	}
+
+	deadLetters, err = store.GetDeadLetters("other-ns")
+	assert.NoError(t, err, "Unexpected error loading dead letters.")
+	assert.Len(t, deadLetters, 0, "Dead letters of other namespaces should not be listed.")
+
+	d, notFound, err := store.GetDeadLetter(request.ID.String())
+	assert.NoError(t, err, "Unexpected error loading dead letter.")
+	assert.False(t, notFound, "Dead letter should have been found.")
+
+	err = store.RequeueDeadLetter(d)
+	assert.NoError(t, err, "Unexpected error re-enqueuing dead letter.")
+
+	_, notFound, _ = store.GetDeadLetter(request.ID.String())
+	assert.True(t, notFound, "Re-enqueued dead letter should have been deleted.")
+
+	requests, err = store.GetRequests("dead-ns")
+	assert.NoError(t, err, "Unexpected error loading requests.")
+	if assert.Len(t, requests, 1, "Re-enqueued request should be buffered.") {
+		assert.Equal(t, 0, requests[0].Retries, "Retries should have been reset.")
+		assert.Nil(t, requests[0].NextAttempt, "Re-enqueued request should be due.")
+		assert.Equal(t, deliveryID, *requests[0].DeliveryID)
+	}
+}
+
+func Test_requests_can_be_paged_and_purged(t *testing.T) {
+	db, store, _ := setUp(t)
+	defer db.Close()
+
+	var ids []uuid.UUID
+	for i := 0; i < 5; i++ {
+		created := time.Now().Add(time.Duration(i) * time.Second)
+		request := &Request{ID: uuid.NewV4(), Namespace: "paged-ns", CreatedAt: &created}
+		err := store.CreateRequest(request)
+		assert.NoError(t, err, "Unexpected error creating request.")
+		ids = append(ids, request.ID)
+	}
+	err := store.CreateRequest(&Request{ID: uuid.NewV4(), Namespace: "other-paged-ns"})
+	assert.NoError(t, err, "Unexpected error creating request.")
+
+	page, err := store.GetRequestsPage("paged-ns", 1, 2)
+	assert.NoError(t, err, "Unexpected error loading page.")
+	if assert.Len(t, page, 2, "Unexpected page size.") {
+		assert.Equal(t, ids[1], page[0].ID, "Requests should be paged in buffer order.")
+		assert.Equal(t, ids[2], page[1].ID, "Requests should be paged in buffer order.")
+	}
+
+	next := time.Now().Add(time.Hour)
+	request, notFound, err := store.GetRequest(ids[3].String())
+	assert.NoError(t, err, "Unexpected error loading request.")
+	assert.False(t, notFound, "Request should have been found.")
+	request.NextAttempt = &next
+	errs := store.IncrementRequestRetry(request)
+	assert.Len(t, errs, 0, "Unexpected error updating request.")
+
+	err = store.ResetNextAttempt(request)
+	assert.NoError(t, err, "Unexpected error resetting next attempt.")
+	request, _, err = store.GetRequest(ids[3].String())
+	assert.NoError(t, err, "Unexpected error loading request.")
+	assert.Nil(t, request.NextAttempt, "Request should be due again.")
+	assert.Equal(t, 1, request.Retries, "Retries should be kept.")
+
+	deleted, err := store.DeleteRequests("paged-ns")
+	assert.NoError(t, err, "Unexpected error purging namespace.")
+	assert.Equal(t, int64(5), deleted)
+
+	count, err := store.GetRequestsCount("other-paged-ns")
+	assert.NoError(t, err, "Unexpected error counting requests.")
+	assert.Equal(t, 1, count, "Requests of other namespaces should be kept.")
+}
+
+func Test_db_store_conformance(t *testing.T) {
+	db, store, _ := setUp(t)
+	defer db.Close()
+
+	testStoreConformance(t, store)
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// DeadLetter describes a buffered request which could not be replayed within
+// the allowed number of retries. It keeps everything needed to replay it again.
+type DeadLetter struct {
+	ID         uuid.UUID `sql:"type:uuid" gorm:"primary_key" json:"id"`
+	Method     string    `json:"method"`
+	Headers    []byte    `json:"-"`
+	Payload    []byte    `json:"-"`
+	Host       string    `json:"host"`
+	Scheme     string    `json:"scheme"`
+	Path       string    `json:"path"`
+	RawQuery   string    `json:"raw_query"`
+	RequestURI string    `json:"request_uri"`
+	// DeliveryID is not unique as a delivery may fail again after it was re-enqueued.
+	DeliveryID *string    `json:"delivery_id,omitempty"`
+	RequestID  string     `json:"request_id,omitempty"`
+	Namespace  string     `json:"namespace"`
+	Retries    int        `json:"retries"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	LastError  string     `json:"last_error"`
+	LastStatus int        `json:"last_status"`
+	// DeadAt is when the request was given up on.
+	DeadAt time.Time `json:"dead_at"`
+	// KeyID and DataKey are those of the request, see Request.
+	KeyID   string `json:"-"`
+	DataKey []byte `json:"-"`
+}
+
+// NewDeadLetter creates the dead letter of a request which exhausted its retries.
+func NewDeadLetter(r Request) *DeadLetter {
+	return &DeadLetter{
+		ID:         r.ID,
+		Method:     r.Method,
+		Headers:    r.Headers,
+		Payload:    r.Payload,
+		Host:       r.Host,
+		Scheme:     r.Scheme,
+		Path:       r.Path,
+		RawQuery:   r.RawQuery,
+		RequestURI: r.RequestURI,
+		DeliveryID: r.DeliveryID,
+		RequestID:  r.RequestID,
+		Namespace:  r.Namespace,
+		Retries:    r.Retries,
+		CreatedAt:  r.CreatedAt,
+		LastError:  r.LastError,
+		LastStatus: r.LastStatus,
+		DeadAt:     time.Now(),
+		KeyID:      r.KeyID,
+		DataKey:    r.DataKey,
+	}
+}
+
+// TableName for dead letters.
+func (d DeadLetter) TableName() string {
+	return "dead_letters"
+}
+
+// Request recreates the buffered request of a dead letter, with its retries reset.
+// It is queued behind the requests buffered so far.
+func (d DeadLetter) Request() *Request {
+	now := time.Now()
+	return &Request{
+		ID:         d.ID,
+		Method:     d.Method,
+		Headers:    d.Headers,
+		Payload:    d.Payload,
+		Host:       d.Host,
+		Scheme:     d.Scheme,
+		Path:       d.Path,
+		RawQuery:   d.RawQuery,
+		RequestURI: d.RequestURI,
+		DeliveryID: d.DeliveryID,
+		RequestID:  d.RequestID,
+		Namespace:  d.Namespace,
+		Retries:    0,
+		CreatedAt:  &now,
+		KeyID:      d.KeyID,
+		DataKey:    d.DataKey,
+	}
+}
+
+// GetHeaders gets headers of the dead request, decrypted if needed.
+func (d DeadLetter) GetHeaders() (map[string][]string, error) {
+	return d.Request().GetHeaders()
+}
+
+// GetPayload gets the payload of the dead request, decrypted if needed.
+func (d DeadLetter) GetPayload() ([]byte, error) {
+	return d.Request().GetPayload()
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// keySize is the size of the AES-256 keys wrapping data keys and of the data keys themselves.
+const keySize = 32
+
+var (
+	keyringLock sync.RWMutex
+	keyring     *Keyring
+)
+
+// Keyring holds the keys wrapping the data keys of encrypted requests, by key ID.
+// Requests are encrypted with a random data key of their own, which is stored on the
+// request wrapped with the current key. To rotate keys, a new current key is added and
+// the previous ones are kept until the requests wrapped with them are gone.
+type Keyring struct {
+	currentID string
+	keys      map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring from base64 encoded 256 bit keys keyed by key ID.
+// Requests are encrypted with the key of currentID.
+func NewKeyring(currentID string, keys map[string]string) (*Keyring, error) {
+	k := &Keyring{
+		currentID: currentID,
+		keys:      make(map[string]cipher.AEAD),
+	}
+	for id, encoded := range keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s is not base64 encoded: %s", id, err)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %s", id, err)
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[currentID]; !ok {
+		return nil, fmt.Errorf("encryption key %s is not configured", currentID)
+	}
+	return k, nil
+}
+
+// SetKeyring sets the keyring encrypting newly buffered requests and decrypting
+// buffered ones. Requests are buffered in plaintext if it is nil.
+func SetKeyring(k *Keyring) {
+	keyringLock.Lock()
+	defer keyringLock.Unlock()
+	keyring = k
+}
+
+func currentKeyring() *Keyring {
+	keyringLock.RLock()
+	defer keyringLock.RUnlock()
+	return keyring
+}
+
+// encrypt encrypts the given plaintexts with a new data key and returns them together
+// with the data key wrapped with the current key.
+func (k *Keyring) encrypt(plaintexts ...[]byte) (keyID string, dataKey []byte, ciphertexts [][]byte, err error) {
+	key := make([]byte, keySize)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return
+	}
+
+	for _, plaintext := range plaintexts {
+		var ciphertext []byte
+		ciphertext, err = seal(aead, plaintext)
+		if err != nil {
+			return
+		}
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+
+	dataKey, err = seal(k.keys[k.currentID], key)
+	return k.currentID, dataKey, ciphertexts, err
+}
+
+// decrypt unwraps the data key with the key of keyID and decrypts the given ciphertexts with it.
+func (k *Keyring) decrypt(keyID string, dataKey []byte, ciphertexts ...[]byte) (plaintexts [][]byte, err error) {
+	wrapping, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("encryption key %s is not configured", keyID)
+	}
+	key, err := unseal(wrapping, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not unwrap data key with encryption key %s: %s", keyID, err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ciphertext := range ciphertexts {
+		plaintext, err := unseal(aead, ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		plaintexts = append(plaintexts, plaintext)
+	}
+	return plaintexts, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key needs to be %d bytes, not %d", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext and prepends the random nonce it used
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func unseal(aead cipher.AEAD, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], nil)
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oldKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, keySize))
+	newKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, keySize))
+)
+
+func bufferSecretRequest(t *testing.T) *Request {
+	r := httptest.NewRequest("POST", "http://jenkins-foo.example.com/github-webhook/", bytes.NewBufferString(`{"private": true}`))
+	r.Header.Set("X-Hub-Signature", "sha1=s3cr3t")
+	request, err := NewRequest(r, "foo", []byte(`{"private": true}`))
+	require.NoError(t, err, "Unexpected error buffering request")
+	return request
+}
+
+func Test_requests_are_encrypted_with_current_key(t *testing.T) {
+	k, err := NewKeyring("old", map[string]string{"old": oldKey})
+	require.NoError(t, err)
+	SetKeyring(k)
+	defer SetKeyring(nil)
+
+	request := bufferSecretRequest(t)
+	assert.Equal(t, "old", request.KeyID)
+	assert.NotEmpty(t, request.DataKey)
+	assert.NotContains(t, string(request.Headers), "s3cr3t", "Headers should be encrypted.")
+	assert.NotContains(t, string(request.Payload), "private", "Payload should be encrypted.")
+
+	replayed, err := request.GetHTTPRequest()
+	require.NoError(t, err, "Unexpected error replaying request")
+	assert.Equal(t, "sha1=s3cr3t", replayed.Header.Get("X-Hub-Signature"))
+	body, _ := ioutil.ReadAll(replayed.Body)
+	assert.Equal(t, `{"private": true}`, string(body))
+
+	payload, err := NewDeadLetter(*request).GetPayload()
+	require.NoError(t, err, "Unexpected error decrypting dead letter")
+	assert.Equal(t, `{"private": true}`, string(payload), "Dead letter should keep the key of its request.")
+}
+
+func Test_rotated_keys_decrypt_requests_of_previous_keys(t *testing.T) {
+	k, err := NewKeyring("old", map[string]string{"old": oldKey})
+	require.NoError(t, err)
+	SetKeyring(k)
+	defer SetKeyring(nil)
+	request := bufferSecretRequest(t)
+
+	k, err = NewKeyring("new", map[string]string{"old": oldKey, "new": newKey})
+	require.NoError(t, err)
+	SetKeyring(k)
+	payload, err := request.GetPayload()
+	require.NoError(t, err, "Request of previous key should be decrypted.")
+	assert.Equal(t, `{"private": true}`, string(payload))
+	assert.Equal(t, "new", bufferSecretRequest(t).KeyID, "New requests should use the current key.")
+
+	k, err = NewKeyring("new", map[string]string{"new": newKey})
+	require.NoError(t, err)
+	SetKeyring(k)
+	_, err = request.GetPayload()
+	assert.Error(t, err, "Request of removed key cannot be decrypted.")
+
+	SetKeyring(nil)
+	_, err = request.GetHeaders()
+	assert.Error(t, err, "Encrypted request cannot be decrypted without keys.")
+}
+
+func Test_plaintext_requests_stay_readable(t *testing.T) {
+	plain := bufferSecretRequest(t)
+	assert.Empty(t, plain.KeyID, "Request should be plaintext without keyring.")
+
+	k, err := NewKeyring("new", map[string]string{"new": newKey})
+	require.NoError(t, err)
+	SetKeyring(k)
+	defer SetKeyring(nil)
+
+	headers, err := plain.GetHeaders()
+	require.NoError(t, err, "Plaintext request should be readable.")
+	assert.Equal(t, []string{"sha1=s3cr3t"}, headers["X-Hub-Signature"])
+	payload, err := plain.GetPayload()
+	require.NoError(t, err)
+	assert.Equal(t, `{"private": true}`, string(payload))
+}
+
+func Test_invalid_keys_are_rejected(t *testing.T) {
+	_, err := NewKeyring("old", map[string]string{"old": "not base64!"})
+	assert.Error(t, err, "Key should need to be base64 encoded.")
+
+	_, err = NewKeyring("old", map[string]string{"old": base64.StdEncoding.EncodeToString([]byte("short"))})
+	assert.Error(t, err, "Key should need to be 256 bit.")
+
+	_, err = NewKeyring("new", map[string]string{"old": oldKey})
+	assert.Error(t, err, "Current key should need to be configured.")
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// compactFileAfter is the number of changes appended to the file of a file store before
+// it is rewritten with the content of the store only.
+var compactFileAfter = 1000
+
+// errIncompleteChange is returned for a change of which only a part was written, which
+// happens if the proxy stops while writing it.
+var errIncompleteChange = errors.New("change was not completely written")
+
+// fileLog is the file of a file store. It holds the changes of the store, each of them
+// prefixed by its length and checksum, and starts with the whole content of the store
+// once it is compacted.
+type fileLog struct {
+	path string
+	// changes is the number of changes appended since the file was compacted
+	changes int
+}
+
+// NewFileStore creates a store which keeps everything in memory and appends every change
+// to a file, so that it survives restarts. Existing content of the file is loaded. A change
+// only takes effect in memory once it is written. The file is compacted when the store is
+// created and after every compactFileAfter changes, by replacing it atomically.
+func NewFileStore(path string) (*MemoryStore, error) {
+	s := NewMemoryStore()
+	if err := loadFileLog(path, &s.memoryState); err != nil {
+		return nil, err
+	}
+	storeLogger.Infof("Loaded %d requests from %s", len(s.requests), path)
+
+	file := &fileLog{path: path}
+	// fail early if the file cannot be written
+	if err := file.compact(&s.memoryState); err != nil {
+		return nil, err
+	}
+	s.persist = func(change storeChange) error {
+		if file.changes >= compactFileAfter {
+			if err := file.compact(&s.memoryState); err != nil {
+				storeLogger.Warnf("Could not compact %s: %s", path, err)
+			}
+		}
+		return file.append(change)
+	}
+	return s, nil
+}
+
+// loadFileLog applies the changes of the file at path to s. A change which was not
+// completely written is ignored, it never took effect.
+func loadFileLog(path string, s *memoryState) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		change, err := readChange(r)
+		if err == io.EOF {
+			return nil
+		} else if err == errIncompleteChange {
+			storeLogger.Warnf("Ignoring the last change in %s: %s", path, err)
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not load %s: %s", path, err)
+		}
+		s.apply(change)
+	}
+}
+
+// append writes a change to the end of the file. The file is not created if it is missing,
+// as that would lose the changes written before.
+func (l *fileLog) append(change storeChange) error {
+	data, err := encodeChange(change)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		// cut off what was written, so that later changes are not appended to a broken one
+		f.Truncate(info.Size())
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	l.changes++
+	return nil
+}
+
+// compact replaces the file by one holding the content s only.
+func (l *fileLog) compact(s *memoryState) error {
+	data, err := encodeChange(s.snapshot())
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return err
+	}
+	l.changes = 0
+	return nil
+}
+
+// encodeChange returns the change prefixed by its length and checksum.
+func encodeChange(change storeChange) ([]byte, error) {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(change); err != nil {
+		return nil, err
+	}
+	data := make([]byte, 8, 8+payload.Len())
+	binary.BigEndian.PutUint32(data[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(data[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	return append(data, payload.Bytes()...), nil
+}
+
+// readChange reads the next change written by encodeChange. It returns io.EOF if there is
+// none left.
+func readChange(r io.Reader) (change storeChange, err error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err == io.ErrUnexpectedEOF {
+		return change, errIncompleteChange
+	} else if err != nil {
+		return change, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := io.ReadFull(r, payload); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return change, errIncompleteChange
+	} else if err != nil {
+		return change, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return change, errIncompleteChange
+	}
+	err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&change)
+	return change, err
+}
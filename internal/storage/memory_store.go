@@ -0,0 +1,648 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// MemoryStore is a Store keeping everything in memory. It is meant for local development
+// and small deployments which can afford to lose buffered requests on restart, or which
+// persist it with NewFileStore.
+type MemoryStore struct {
+	lock sync.RWMutex
+	memoryState
+
+	// persist is called with the lock held and every change before it takes effect, if
+	// set. The change is discarded if persist fails.
+	persist func(storeChange) error
+}
+
+// memoryState is the content of a MemoryStore.
+type memoryState struct {
+	requests    []Request
+	deadLetters []DeadLetter
+	statistics  map[string]Statistics
+	readiness   []Readiness
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		memoryState: memoryState{statistics: make(map[string]Statistics)},
+	}
+}
+
+// CreateRequest stores a request.
+// It returns ErrDuplicateDelivery if the delivery ID of the request is already stored.
+func (s *MemoryStore) CreateRequest(r *Request) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.checkNewRequest(r); err != nil {
+		return err
+	}
+	return s.commit(storeChange{Requests: []Request{*r}})
+}
+
+// GetRequests gets the requests of a namespace, ordered by the time they were buffered, oldest first.
+func (s *MemoryStore) GetRequests(ns string) (result []Request, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.namespaceRequests(ns), nil
+}
+
+// ClaimRequests leases the requests of a namespace to owner, unless another owner holds an
+// unexpired lease on any of them.
+func (s *MemoryStore) ClaimRequests(ns string, owner string, lease time.Duration) (result []Request, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for _, request := range s.requests {
+		if request.Namespace == ns && request.LeasedByOther(owner, now) {
+			return nil, nil
+		}
+	}
+	expiresAt := now.Add(lease)
+	var change storeChange
+	for _, request := range s.requests {
+		if request.Namespace == ns {
+			request.LeaseOwner = owner
+			request.LeaseExpiresAt = &expiresAt
+			change.Requests = append(change.Requests, request)
+		}
+	}
+	if err := s.commit(change); err != nil {
+		return nil, err
+	}
+	return s.namespaceRequests(ns), nil
+}
+
+// ReleaseRequests ends the lease of owner on the requests of a namespace.
+func (s *MemoryStore) ReleaseRequests(ns string, owner string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var change storeChange
+	for _, request := range s.requests {
+		if request.Namespace == ns && request.LeaseOwner == owner {
+			request.LeaseOwner = ""
+			request.LeaseExpiresAt = nil
+			change.Requests = append(change.Requests, request)
+		}
+	}
+	return s.commit(change)
+}
+
+// GetRequestsPage gets a page of the requests of a namespace, ordered by the time they were buffered.
+func (s *MemoryStore) GetRequestsPage(ns string, offset int, limit int) (result []Request, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	requests := s.namespaceRequests(ns)
+	if offset >= len(requests) {
+		return nil, nil
+	}
+	end := offset + limit
+	if end > len(requests) {
+		end = len(requests)
+	}
+	return requests[offset:end], nil
+}
+
+// GetRequest gets a request by its ID.
+func (s *MemoryStore) GetRequest(id string) (r *Request, notFound bool, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, request := range s.requests {
+		if request.ID.String() == id {
+			found := request
+			return &found, false, nil
+		}
+	}
+	return &Request{}, true, gorm.ErrRecordNotFound
+}
+
+// GetRequestByDeliveryID gets the request of a webhook delivery.
+func (s *MemoryStore) GetRequestByDeliveryID(id string) (r *Request, notFound bool, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, request := range s.requests {
+		if request.DeliveryID != nil && *request.DeliveryID == id {
+			found := request
+			return &found, false, nil
+		}
+	}
+	return &Request{}, true, gorm.ErrRecordNotFound
+}
+
+// IncrementRequestRetry increases the retries of a request and stores its other changes.
+func (s *MemoryStore) IncrementRequestRetry(r *Request) (errs []error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r.Retries++
+	i := s.requestIndex(r.ID.String())
+	if i < 0 {
+		return []error{fmt.Errorf("could not update request for %s (%s): not found", r.ID, r.Namespace)}
+	}
+	if err := s.commit(storeChange{Requests: []Request{*r}}); err != nil {
+		errs = append(errs, err)
+	}
+	return
+}
+
+// ResetNextAttempt clears the next attempt of a request.
+func (s *MemoryStore) ResetNextAttempt(r *Request) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r.NextAttempt = nil
+	i := s.requestIndex(r.ID.String())
+	if i < 0 {
+		return gorm.ErrRecordNotFound
+	}
+	request := s.requests[i]
+	request.NextAttempt = nil
+	return s.commit(storeChange{Requests: []Request{request}})
+}
+
+// GetUsers gets the namespaces with buffered requests.
+func (s *MemoryStore) GetUsers() (result []string, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, request := range s.requests {
+		if !seen[request.Namespace] {
+			seen[request.Namespace] = true
+			result = append(result, request.Namespace)
+		}
+	}
+	return
+}
+
+// GetRequestsCount gets requests count given a namespace.
+func (s *MemoryStore) GetRequestsCount(ns string) (result int, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return len(s.namespaceRequests(ns)), nil
+}
+
+// DeleteRequest deletes a request.
+func (s *MemoryStore) DeleteRequest(r *Request) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.requestIndex(r.ID.String()) < 0 {
+		return nil
+	}
+	return s.commit(storeChange{DeletedRequests: []uuid.UUID{r.ID}})
+}
+
+// DeleteRequests deletes all requests of a namespace.
+func (s *MemoryStore) DeleteRequests(ns string) (deleted int64, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var change storeChange
+	for _, request := range s.requests {
+		if request.Namespace == ns {
+			change.DeletedRequests = append(change.DeletedRequests, request.ID)
+		}
+	}
+	if err := s.commit(change); err != nil {
+		return 0, err
+	}
+	return int64(len(change.DeletedRequests)), nil
+}
+
+// DeleteRequestsBefore deletes the requests buffered before t.
+func (s *MemoryStore) DeleteRequestsBefore(t time.Time) (deleted int64, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var change storeChange
+	for _, request := range s.requests {
+		if request.CreatedAt != nil && request.CreatedAt.Before(t) {
+			change.DeletedRequests = append(change.DeletedRequests, request.ID)
+		}
+	}
+	if err := s.commit(change); err != nil {
+		return 0, err
+	}
+	return int64(len(change.DeletedRequests)), nil
+}
+
+// MoveToDeadLetters replaces a request by its dead letter.
+func (s *MemoryStore) MoveToDeadLetters(r *Request) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	change := storeChange{DeadLetters: []DeadLetter{*NewDeadLetter(*r)}}
+	if s.requestIndex(r.ID.String()) >= 0 {
+		change.DeletedRequests = []uuid.UUID{r.ID}
+	}
+	return s.commit(change)
+}
+
+// GetDeadLetters gets the dead letters of a namespace, most recent first.
+// The dead letters of all namespaces are returned if ns is empty.
+func (s *MemoryStore) GetDeadLetters(ns string) (result []DeadLetter, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, d := range s.deadLetters {
+		if ns == "" || d.Namespace == ns {
+			result = append(result, d)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].DeadAt.After(result[j].DeadAt)
+	})
+	return
+}
+
+// GetDeadLetter gets a dead letter by its ID.
+func (s *MemoryStore) GetDeadLetter(id string) (d *DeadLetter, notFound bool, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if i := s.deadLetterIndex(id); i >= 0 {
+		found := s.deadLetters[i]
+		return &found, false, nil
+	}
+	return &DeadLetter{}, true, gorm.ErrRecordNotFound
+}
+
+// RequeueDeadLetter buffers the request of a dead letter again and deletes the dead letter.
+// It returns ErrDuplicateDelivery if a redelivery of the request is already buffered.
+func (s *MemoryStore) RequeueDeadLetter(d *DeadLetter) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := d.Request()
+	if err := s.checkNewRequest(r); err != nil {
+		return err
+	}
+	change := storeChange{Requests: []Request{*r}}
+	if s.deadLetterIndex(d.ID.String()) >= 0 {
+		change.DeletedDeadLetters = []uuid.UUID{d.ID}
+	}
+	return s.commit(change)
+}
+
+// DeleteDeadLettersBefore deletes the dead letters given up on before t.
+func (s *MemoryStore) DeleteDeadLettersBefore(t time.Time) (deleted int64, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var change storeChange
+	for _, d := range s.deadLetters {
+		if d.DeadAt.Before(t) {
+			change.DeletedDeadLetters = append(change.DeletedDeadLetters, d.ID)
+		}
+	}
+	if err := s.commit(change); err != nil {
+		return 0, err
+	}
+	return int64(len(change.DeletedDeadLetters)), nil
+}
+
+// CreateStatistics creates the statistics of a namespace.
+func (s *MemoryStore) CreateStatistics(o *Statistics) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.statistics[o.Namespace]; ok {
+		return fmt.Errorf("statistics for %s already exist", o.Namespace)
+	}
+	return s.commit(storeChange{Statistics: []Statistics{*o}})
+}
+
+// UpdateStatistics updates the statistics of a namespace.
+func (s *MemoryStore) UpdateStatistics(o *Statistics) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.commit(storeChange{Statistics: []Statistics{*o}})
+}
+
+// GetStatisticsUser gets the statistics of a namespace.
+func (s *MemoryStore) GetStatisticsUser(ns string) (o *Statistics, notFound bool, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	found, ok := s.statistics[ns]
+	if !ok {
+		return &Statistics{}, true, gorm.ErrRecordNotFound
+	}
+	return &found, false, nil
+}
+
+// DeleteStatisticsBefore deletes the statistics of namespaces neither accessed nor buffered to since t.
+func (s *MemoryStore) DeleteStatisticsBefore(t time.Time) (deleted int64, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var change storeChange
+	for ns, o := range s.statistics {
+		if o.LastAccessed < t.Unix() && o.LastBufferedRequest < t.Unix() {
+			change.DeletedStatistics = append(change.DeletedStatistics, ns)
+		}
+	}
+	if err := s.commit(change); err != nil {
+		return 0, err
+	}
+	return int64(len(change.DeletedStatistics)), nil
+}
+
+// StartReadiness stores a readiness measurement, unless one of the same namespace is pending
+// since pendingSince or later. Older pending measurements are deleted.
+func (s *MemoryStore) StartReadiness(r *Readiness, pendingSince time.Time) (started bool, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, m := range s.readiness {
+		if m.Namespace == r.Namespace && m.ReadyAt == nil && !m.UnidledAt.Before(pendingSince) {
+			return false, nil
+		}
+	}
+	change := storeChange{Readiness: []Readiness{*r}}
+	for _, m := range s.readiness {
+		if m.Namespace == r.Namespace && m.ReadyAt == nil {
+			change.DeletedReadiness = append(change.DeletedReadiness, m.ID)
+		}
+	}
+	if err := s.commit(change); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FinishReadiness marks the pending readiness measurement of a namespace ready and deletes
+// all but the last keep measurements of the namespace.
+func (s *MemoryStore) FinishReadiness(ns string, readyAt time.Time, keep int) (r *Readiness, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, m := range s.readiness {
+		if m.Namespace == ns && m.ReadyAt == nil {
+			m.ReadyAt = &readyAt
+			r = &m
+			break
+		}
+	}
+	if r == nil {
+		return nil, nil
+	}
+
+	ready := 1
+	for _, m := range s.readiness {
+		if m.Namespace == ns && m.ReadyAt != nil {
+			ready++
+		}
+	}
+	// measurements are appended as they start, the oldest come first
+	change := storeChange{Readiness: []Readiness{*r}}
+	for _, m := range s.readiness {
+		if m.Namespace == ns && (m.ReadyAt != nil || m.ID == r.ID) && ready > keep {
+			ready--
+			change.DeletedReadiness = append(change.DeletedReadiness, m.ID)
+			if m.ID == r.ID {
+				change.Readiness = nil
+			}
+		}
+	}
+	if err := s.commit(change); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetReadiness gets the readiness measurements of a namespace, most recent first.
+func (s *MemoryStore) GetReadiness(ns string) (result []Readiness, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, m := range s.readiness {
+		if m.Namespace == ns {
+			result = append(result, m)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].UnidledAt.After(result[j].UnidledAt)
+	})
+	return
+}
+
+// LogStats logs number of cached requests and statistics entries count.
+func (s *MemoryStore) LogStats() {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	storeLogger.Infof("Cached requests: %d. Statistic entries count: %d", len(s.requests), len(s.statistics))
+}
+
+// Ping always succeeds, memory is always available.
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryState) checkNewRequest(r *Request) error {
+	for _, request := range s.requests {
+		if request.ID == r.ID {
+			return fmt.Errorf("request %s already exists", r.ID)
+		}
+		if r.DeliveryID != nil && request.DeliveryID != nil && *request.DeliveryID == *r.DeliveryID {
+			return ErrDuplicateDelivery
+		}
+	}
+	return nil
+}
+
+// namespaceRequests returns copies of the requests of a namespace in replay order
+func (s *memoryState) namespaceRequests(ns string) []Request {
+	var result []Request
+	for _, request := range s.requests {
+		if request.Namespace == ns {
+			result = append(result, request)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return createdBefore(result[i].CreatedAt, result[j].CreatedAt)
+	})
+	return result
+}
+
+// createdBefore orders requests without creation time first, like NULLS FIRST does in Postgres
+func createdBefore(a *time.Time, b *time.Time) bool {
+	if a == nil {
+		return b != nil
+	}
+	return b != nil && a.Before(*b)
+}
+
+func (s *memoryState) requestIndex(id string) int {
+	for i, request := range s.requests {
+		if request.ID.String() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *memoryState) deadLetterIndex(id string) int {
+	for i, d := range s.deadLetters {
+		if d.ID.String() == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// commit persists a change and applies it to the content of the store. If the change
+// cannot be persisted, the store is left unchanged.
+func (s *MemoryStore) commit(change storeChange) error {
+	if change.empty() {
+		return nil
+	}
+	if s.persist != nil {
+		if err := s.persist(change); err != nil {
+			return err
+		}
+	}
+	s.apply(change)
+	return nil
+}
+
+// storeChange is a change of the content of a MemoryStore: rows stored or replaced by their
+// ID and IDs of deleted rows. It is what a file store appends to its log.
+type storeChange struct {
+	Requests           []Request
+	DeletedRequests    []uuid.UUID
+	DeadLetters        []DeadLetter
+	DeletedDeadLetters []uuid.UUID
+	Statistics         []Statistics
+	DeletedStatistics  []string
+	Readiness          []Readiness
+	DeletedReadiness   []uuid.UUID
+}
+
+func (c *storeChange) empty() bool {
+	return len(c.Requests) == 0 && len(c.DeletedRequests) == 0 &&
+		len(c.DeadLetters) == 0 && len(c.DeletedDeadLetters) == 0 &&
+		len(c.Statistics) == 0 && len(c.DeletedStatistics) == 0 &&
+		len(c.Readiness) == 0 && len(c.DeletedReadiness) == 0
+}
+
+// apply changes the content in place. Stored rows keep their position, new rows are appended
+// in the order of the change.
+func (s *memoryState) apply(c storeChange) {
+	if len(c.DeletedRequests) > 0 {
+		deleted := idSet(c.DeletedRequests)
+		kept := s.requests[:0]
+		for _, request := range s.requests {
+			if !deleted[request.ID] {
+				kept = append(kept, request)
+			}
+		}
+		s.requests = kept
+	}
+	if len(c.Requests) > 0 {
+		stored := make(map[uuid.UUID]int, len(c.Requests))
+		for i, request := range c.Requests {
+			stored[request.ID] = i
+		}
+		for i := range s.requests {
+			if j, ok := stored[s.requests[i].ID]; ok {
+				s.requests[i] = c.Requests[j]
+				delete(stored, s.requests[i].ID)
+			}
+		}
+		for _, request := range c.Requests {
+			if _, ok := stored[request.ID]; ok {
+				s.requests = append(s.requests, request)
+			}
+		}
+	}
+
+	if len(c.DeletedDeadLetters) > 0 {
+		deleted := idSet(c.DeletedDeadLetters)
+		kept := s.deadLetters[:0]
+		for _, d := range s.deadLetters {
+			if !deleted[d.ID] {
+				kept = append(kept, d)
+			}
+		}
+		s.deadLetters = kept
+	}
+	// dead letters are never changed once stored
+	s.deadLetters = append(s.deadLetters, c.DeadLetters...)
+
+	for _, ns := range c.DeletedStatistics {
+		delete(s.statistics, ns)
+	}
+	for _, o := range c.Statistics {
+		s.statistics[o.Namespace] = o
+	}
+
+	if len(c.DeletedReadiness) > 0 {
+		deleted := idSet(c.DeletedReadiness)
+		kept := s.readiness[:0]
+		for _, m := range s.readiness {
+			if !deleted[m.ID] {
+				kept = append(kept, m)
+			}
+		}
+		s.readiness = kept
+	}
+	if len(c.Readiness) > 0 {
+		stored := make(map[uuid.UUID]int, len(c.Readiness))
+		for i, m := range c.Readiness {
+			stored[m.ID] = i
+		}
+		for i := range s.readiness {
+			if j, ok := stored[s.readiness[i].ID]; ok {
+				s.readiness[i] = c.Readiness[j]
+				delete(stored, s.readiness[i].ID)
+			}
+		}
+		for _, m := range c.Readiness {
+			if _, ok := stored[m.ID]; ok {
+				s.readiness = append(s.readiness, m)
+			}
+		}
+	}
+}
+
+// snapshot returns the change which stores the whole content in an empty store
+func (s *memoryState) snapshot() storeChange {
+	c := storeChange{
+		Requests:    s.requests,
+		DeadLetters: s.deadLetters,
+		Readiness:   s.readiness,
+	}
+	for _, o := range s.statistics {
+		c.Statistics = append(c.Statistics, o)
+	}
+	return c
+}
+
+func idSet(ids []uuid.UUID) map[uuid.UUID]bool {
+	set := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
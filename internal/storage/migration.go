@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// migrationLockID is the key of the Postgres advisory lock held while migrating,
+// so that replicas starting at the same time do not race.
+const migrationLockID = 4207135418
+
+// migration upgrades the schema by one version.
+// Statements are idempotent, so that databases created before schema versions
+// were recorded are upgraded without failing on what they already have.
+type migration struct {
+	description string
+	statements  []string
+}
+
+// migrations are applied in order, the version of a migration is its index plus one.
+// Only ever append to it, released migrations must not change.
+var migrations = []migration{
+	{
+		description: "create requests and statistics",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS requests (id uuid PRIMARY KEY, method text, headers bytea, payload bytea,
+				host text, scheme text, path text, namespace text, retries integer)`,
+			`CREATE TABLE IF NOT EXISTS statistics (namespace text PRIMARY KEY, last_accessed bigint,
+				last_buffered_request bigint)`,
+		},
+	},
+	{
+		description: "record query and request URI of requests",
+		statements: []string{
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS raw_query text`,
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS request_uri text`,
+		},
+	},
+	{
+		description: "record webhook delivery IDs",
+		statements: []string{
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS delivery_id text`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS uix_requests_delivery_id ON requests (delivery_id)`,
+		},
+	},
+	{
+		description: "record when requests were buffered",
+		statements: []string{
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS created_at timestamp with time zone`,
+			// requests buffered before are counted as buffered now, so that retention keeps them for the max age
+			`UPDATE requests SET created_at = now() WHERE created_at IS NULL`,
+		},
+	},
+	{
+		description: "back off failed replays and keep dead letters",
+		statements: []string{
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS next_attempt timestamp with time zone`,
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS last_error text`,
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS last_status integer`,
+			`CREATE TABLE IF NOT EXISTS dead_letters (id uuid PRIMARY KEY, method text, headers bytea, payload bytea,
+				host text, scheme text, path text, raw_query text, request_uri text, delivery_id text, namespace text,
+				retries integer, created_at timestamp with time zone, last_error text, last_status integer,
+				dead_at timestamp with time zone)`,
+		},
+	},
+	{
+		description: "index namespaces",
+		statements: []string{
+			`CREATE INDEX IF NOT EXISTS idx_requests_namespace_created_at ON requests (namespace, created_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_dead_letters_namespace ON dead_letters (namespace)`,
+		},
+	},
+	{
+		description: "record the keys of encrypted requests",
+		statements: []string{
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS key_id text`,
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS data_key bytea`,
+			`ALTER TABLE dead_letters ADD COLUMN IF NOT EXISTS key_id text`,
+			`ALTER TABLE dead_letters ADD COLUMN IF NOT EXISTS data_key bytea`,
+		},
+	},
+	{
+		description: "create cache entries shared by replicas",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS cache_entries (cache text, key text, value bytea,
+				expires_at timestamp with time zone NOT NULL, PRIMARY KEY (cache, key))`,
+			`CREATE INDEX IF NOT EXISTS idx_cache_entries_expires_at ON cache_entries (cache, expires_at)`,
+		},
+	},
+	{
+		description: "lease requests to the replica replaying them",
+		statements: []string{
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS lease_owner text`,
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS lease_expires_at timestamp with time zone`,
+		},
+	},
+	{
+		description: "record the IDs of the requests which buffered webhooks",
+		statements: []string{
+			`ALTER TABLE requests ADD COLUMN IF NOT EXISTS request_id text`,
+			`ALTER TABLE dead_letters ADD COLUMN IF NOT EXISTS request_id text`,
+		},
+	},
+	{
+		description: "measure how long unidled Jenkins takes to be ready",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS readiness (id uuid PRIMARY KEY, namespace text, cluster text, trigger text,
+				unidled_at timestamp with time zone NOT NULL, ready_at timestamp with time zone)`,
+			`CREATE INDEX IF NOT EXISTS idx_readiness_namespace_unidled_at ON readiness (namespace, unidled_at)`,
+		},
+	},
+}
+
+// LatestSchemaVersion is the schema version Migrate upgrades to.
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// Migrate upgrades the schema to the latest version. Migrations run in a single
+// transaction holding an advisory lock, a replica waits until another one is done
+// and then finds nothing left to do. Nothing is applied if a migration fails.
+func Migrate(db *gorm.DB) error {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := migrate(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func migrate(tx *gorm.DB) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+		return err
+	}
+	err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version integer PRIMARY KEY, description text,
+		applied_at timestamp with time zone NOT NULL DEFAULT now())`).Error
+	if err != nil {
+		return err
+	}
+
+	current, err := SchemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		storeLogger.Warnf("Schema version %d is newer than the latest known version %d", current, len(migrations))
+		return nil
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		storeLogger.Infof("Migrating schema to version %d: %s", version, migrations[i].description)
+		for _, statement := range migrations[i].statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		err := tx.Exec("INSERT INTO schema_version (version, description) VALUES (?, ?)", version, migrations[i].description).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersion returns the current schema version, 0 if no migration was applied yet.
+func SchemaVersion(db *gorm.DB) (version int, err error) {
+	if !db.HasTable("schema_version") {
+		return 0, nil
+	}
+	err = db.Raw("SELECT COALESCE(MAX(version), 0) FROM schema_version").Row().Scan(&version)
+	return
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dropSchema drops all tables, leaving an empty schema
+func dropSchema(t *testing.T, db *gorm.DB) {
+	err := db.Exec("DROP TABLE IF EXISTS requests, statistics, dead_letters, cache_entries, readiness, schema_version").Error
+	require.NoError(t, err, "Unexpected error dropping tables.")
+}
+
+func openUnmigrated(t *testing.T) *gorm.DB {
+	db, err := gorm.Open("postgres", PostgresConfigString(&mockConfig))
+	require.NoError(t, err, "Unexpected error connecting.")
+	return db
+}
+
+func Test_migrations_upgrade_empty_schema_to_latest_version(t *testing.T) {
+	db := openUnmigrated(t)
+	defer db.Close()
+	dropSchema(t, db)
+
+	version, err := SchemaVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version, "Empty schema should have no version.")
+
+	require.NoError(t, Migrate(db))
+	version, err = SchemaVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, LatestSchemaVersion(), version)
+
+	for _, table := range []string{"requests", "statistics", "dead_letters", "cache_entries", "readiness"} {
+		assert.True(t, db.HasTable(table), "Table %s should have been created.", table)
+	}
+	for _, column := range []string{"raw_query", "request_uri", "delivery_id", "created_at", "next_attempt", "last_error", "last_status", "key_id", "data_key", "lease_owner", "lease_expires_at", "request_id"} {
+		assert.True(t, db.NewScope(nil).Dialect().HasColumn("requests", column), "Column %s should have been added.", column)
+	}
+	assert.True(t, db.NewScope(nil).Dialect().HasIndex("requests", "idx_requests_namespace_created_at"), "Namespace should be indexed.")
+	assert.True(t, db.NewScope(nil).Dialect().HasIndex("dead_letters", "idx_dead_letters_namespace"), "Namespace should be indexed.")
+
+	// the migrated schema serves every store operation
+	testStoreConformance(t, NewDBStorage(db))
+
+	// migrating again is a no-op
+	require.NoError(t, Migrate(db))
+	var applied int
+	require.NoError(t, db.Raw("SELECT COUNT(*) FROM schema_version").Row().Scan(&applied))
+	assert.Equal(t, LatestSchemaVersion(), applied, "Every migration should have been applied once.")
+}
+
+func Test_migrations_record_creation_time_of_requests_buffered_before(t *testing.T) {
+	db := openUnmigrated(t)
+	defer db.Close()
+	dropSchema(t, db)
+
+	// a request buffered by a version which did not record when requests were buffered
+	for _, statement := range migrations[0].statements {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+	err := db.Exec("INSERT INTO requests (id, namespace) VALUES (?, ?)", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "legacy-ns").Error
+	require.NoError(t, err)
+
+	require.NoError(t, Migrate(db))
+	var undated int
+	require.NoError(t, db.Raw("SELECT COUNT(*) FROM requests WHERE created_at IS NULL").Row().Scan(&undated))
+	assert.Equal(t, 0, undated, "Requests buffered before should be counted as buffered now.")
+
+	deleted, err := NewDBStorage(db).DeleteRequestsBefore(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted, "Requests buffered before should not be expired right away.")
+}
+
+func Test_concurrent_migrations_do_not_race(t *testing.T) {
+	db := openUnmigrated(t)
+	defer db.Close()
+	dropSchema(t, db)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- Migrate(db)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err, "Unexpected error migrating concurrently.")
+	}
+	var applied int
+	require.NoError(t, db.Raw("SELECT COUNT(*) FROM schema_version").Row().Scan(&applied))
+	assert.Equal(t, LatestSchemaVersion(), applied, "Every migration should have been applied once.")
+}
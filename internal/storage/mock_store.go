@@ -1,5 +1,10 @@
 package storage
 
+import (
+	"context"
+	"time"
+)
+
 // Mock is a mock implementation of Store struct.
 // This implementation is meant to be used for testing
 type Mock struct {
@@ -15,6 +20,21 @@ func (s *Mock) GetRequests(ns string) (result []Request, err error) {
 	return
 }
 
+// ClaimRequests leases the requests of a namespace in the database.
+func (s *Mock) ClaimRequests(ns string, owner string, lease time.Duration) (result []Request, err error) {
+	return
+}
+
+// ReleaseRequests ends the lease on the requests of a namespace in the database.
+func (s *Mock) ReleaseRequests(ns string, owner string) error {
+	return nil
+}
+
+// GetRequestByDeliveryID gets the request of a webhook delivery from the database.
+func (s *Mock) GetRequestByDeliveryID(id string) (r *Request, notFound bool, err error) {
+	return nil, true, nil
+}
+
 // IncrementRequestRetry increases retries for a given request in the database.
 func (s *Mock) IncrementRequestRetry(r *Request) (errs []error) {
 	return
@@ -35,6 +55,61 @@ func (s *Mock) DeleteRequest(r *Request) error {
 	return nil
 }
 
+// MoveToDeadLetters replaces a request by its dead letter in the database.
+func (s *Mock) MoveToDeadLetters(r *Request) error {
+	return nil
+}
+
+// GetDeadLetters gets the dead letters of a namespace from the database.
+func (s *Mock) GetDeadLetters(ns string) (result []DeadLetter, err error) {
+	return
+}
+
+// GetDeadLetter gets a dead letter by its ID from the database.
+func (s *Mock) GetDeadLetter(id string) (d *DeadLetter, notFound bool, err error) {
+	return nil, true, nil
+}
+
+// RequeueDeadLetter buffers the request of a dead letter again.
+func (s *Mock) RequeueDeadLetter(d *DeadLetter) error {
+	return nil
+}
+
+// GetRequestsPage gets a page of the requests of a namespace from the database.
+func (s *Mock) GetRequestsPage(ns string, offset int, limit int) (result []Request, err error) {
+	return
+}
+
+// GetRequest gets a request by its ID from the database.
+func (s *Mock) GetRequest(id string) (r *Request, notFound bool, err error) {
+	return nil, true, nil
+}
+
+// ResetNextAttempt clears the next attempt of a request in the database.
+func (s *Mock) ResetNextAttempt(r *Request) error {
+	return nil
+}
+
+// DeleteRequests deletes all requests of a namespace from the database.
+func (s *Mock) DeleteRequests(ns string) (deleted int64, err error) {
+	return
+}
+
+// DeleteRequestsBefore deletes the requests buffered before t from the database.
+func (s *Mock) DeleteRequestsBefore(t time.Time) (deleted int64, err error) {
+	return
+}
+
+// DeleteDeadLettersBefore deletes the dead letters given up on before t from the database.
+func (s *Mock) DeleteDeadLettersBefore(t time.Time) (deleted int64, err error) {
+	return
+}
+
+// DeleteStatisticsBefore deletes the statistics of inactive namespaces from the database.
+func (s *Mock) DeleteStatisticsBefore(t time.Time) (deleted int64, err error) {
+	return
+}
+
 // CreateStatistics creates an entry of Statistics in the database.
 func (s *Mock) CreateStatistics(o *Statistics) error {
 	return nil
@@ -50,7 +125,27 @@ func (s *Mock) GetStatisticsUser(ns string) (o *Statistics, notFound bool, err e
 	return &Statistics{}, false, nil
 }
 
+// StartReadiness stores a readiness measurement in the database.
+func (s *Mock) StartReadiness(r *Readiness, pendingSince time.Time) (started bool, err error) {
+	return true, nil
+}
+
+// FinishReadiness marks the pending readiness measurement of a namespace ready in the database.
+func (s *Mock) FinishReadiness(ns string, readyAt time.Time, keep int) (r *Readiness, err error) {
+	return
+}
+
+// GetReadiness gets the readiness measurements of a namespace from the database.
+func (s *Mock) GetReadiness(ns string) (result []Readiness, err error) {
+	return
+}
+
 // LogStats logs number of cached number of cached requests and statistics entries count.
 func (s *Mock) LogStats() {
 	dbLogger.Info("mock db stats")
 }
+
+// Ping checks that the database can be reached.
+func (s *Mock) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Readiness measures how long Jenkins of a namespace took to be ready after it was
+// unidled. ReadyAt is nil while Jenkins is not ready yet.
+type Readiness struct {
+	ID        uuid.UUID `sql:"type:uuid" gorm:"primary_key" json:"id"`
+	Namespace string    `json:"namespace"`
+	Cluster   string    `json:"cluster"`
+	// Trigger is what unidled Jenkins, e.g. a user opening its UI or a webhook.
+	Trigger   string     `json:"trigger"`
+	UnidledAt time.Time  `json:"unidled_at"`
+	ReadyAt   *time.Time `json:"ready_at,omitempty"`
+}
+
+// NewReadiness starts measuring how long Jenkins of a namespace takes to be ready after it was unidled now.
+func NewReadiness(ns string, cluster string, trigger string) *Readiness {
+	return &Readiness{
+		ID:        uuid.NewV4(),
+		Namespace: ns,
+		Cluster:   cluster,
+		Trigger:   trigger,
+		UnidledAt: time.Now(),
+	}
+}
+
+// TableName for readiness measurements.
+func (r Readiness) TableName() string {
+	return "readiness"
+}
+
+// Duration returns how long Jenkins took to be ready, 0 while it is not ready yet.
+func (r Readiness) Duration() time.Duration {
+	if r.ReadyAt == nil {
+		return 0
+	}
+	return r.ReadyAt.Sub(r.UnidledAt)
+}
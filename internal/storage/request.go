@@ -3,11 +3,15 @@ package storage
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -16,17 +20,51 @@ const (
 	ErrorFailedDelete = "failed to delete request for %s (%s): %s"
 )
 
+// ErrDuplicateDelivery is returned when creating a request whose delivery ID is already stored.
+var ErrDuplicateDelivery = errors.New("webhook delivery is already buffered")
+
 // Request describes an HTTP request.
 type Request struct {
-	ID        uuid.UUID `sql:"type:uuid" gorm:"primary_key"` // This is the ID PK field
-	Method    string
-	Headers   []byte
-	Payload   []byte
-	Host      string
-	Scheme    string
-	Path      string
-	Namespace string
-	Retries   int
+	ID      uuid.UUID `sql:"type:uuid" gorm:"primary_key"` // This is the ID PK field
+	Method  string
+	Headers []byte
+	Payload []byte
+	Host    string
+	Scheme  string
+	Path    string
+	// RawQuery is the encoded query of the request URL, without '?'
+	RawQuery string
+	// RequestURI is the unmodified request target sent by the client.
+	// It is empty for requests buffered before it was recorded.
+	RequestURI string
+	// DeliveryID identifies the webhook delivery, redeliveries share it.
+	// It is nil if the provider did not send one.
+	DeliveryID *string `gorm:"unique_index"`
+	Namespace  string
+	Retries    int
+	// CreatedAt orders the requests of a namespace for replay.
+	// It is nil for requests buffered before it was recorded.
+	CreatedAt *time.Time
+	// NextAttempt is the earliest time the request is replayed again.
+	// It is nil until a replay failed.
+	NextAttempt *time.Time
+	// LastError describes why the last replay failed.
+	LastError string
+	// LastStatus is the status Jenkins answered the last failed replay with,
+	// 0 if it did not answer.
+	LastStatus int
+	// KeyID identifies the key DataKey is wrapped with. Headers and Payload
+	// are encrypted with DataKey, they are plaintext if KeyID is empty.
+	KeyID   string
+	DataKey []byte
+	// RequestID is the ID of the request which buffered the webhook, it is sent
+	// along with every replay. It is empty for requests buffered before it was recorded.
+	RequestID string
+	// LeaseOwner is the replica replaying the requests of the namespace, empty if unclaimed.
+	LeaseOwner string
+	// LeaseExpiresAt is when other replicas may claim the request again, so that
+	// requests claimed by a crashed replica are replayed by another one.
+	LeaseExpiresAt *time.Time
 }
 
 // NewRequest creates a new request for a namespace.
@@ -36,17 +74,41 @@ func NewRequest(r *http.Request, ns string, body []byte) (*Request, error) {
 		return nil, err
 	}
 
-	return &Request{
-		ID:        uuid.NewV4(),
-		Method:    r.Method,
-		Headers:   h,
-		Payload:   body,
-		Host:      r.Host,
-		Scheme:    r.URL.Scheme,
-		Path:      r.URL.Path,
-		Namespace: ns,
-		Retries:   0,
-	}, nil
+	requestURI := r.RequestURI
+	if requestURI == "" {
+		requestURI = r.URL.RequestURI()
+	}
+
+	now := time.Now()
+	request := &Request{
+		ID:         uuid.NewV4(),
+		Method:     r.Method,
+		Headers:    h,
+		Payload:    body,
+		Host:       r.Host,
+		Scheme:     r.URL.Scheme,
+		Path:       r.URL.Path,
+		RawQuery:   r.URL.RawQuery,
+		RequestURI: requestURI,
+		RequestID:  requestid.FromContext(r.Context()),
+		Namespace:  ns,
+		Retries:    0,
+		CreatedAt:  &now,
+	}
+	if err := request.encrypt(); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// Due returns whether the request may be replayed at the given time.
+func (m Request) Due(now time.Time) bool {
+	return m.NextAttempt == nil || !now.Before(*m.NextAttempt)
+}
+
+// LeasedByOther returns whether another owner holds an unexpired lease on the request.
+func (m Request) LeasedByOther(owner string, now time.Time) bool {
+	return m.LeaseOwner != "" && m.LeaseOwner != owner && m.LeaseExpiresAt != nil && now.Before(*m.LeaseExpiresAt)
 }
 
 // TableName for current request.
@@ -54,25 +116,89 @@ func (m Request) TableName() string {
 	return "requests"
 }
 
-// GetHeaders gets headers of the this request.
+// GetHeaders gets headers of the this request, decrypted if needed.
 func (m Request) GetHeaders() (result map[string][]string, err error) {
+	headers, _, err := m.decrypt()
+	if err != nil {
+		return
+	}
 	result = make(map[string][]string)
-	err = json.Unmarshal(m.Headers, &result)
+	err = json.Unmarshal(headers, &result)
 	return
 }
 
+// GetPayload gets the payload of this request, decrypted if needed.
+func (m Request) GetPayload() ([]byte, error) {
+	_, payload, err := m.decrypt()
+	return payload, err
+}
+
 // GetPayloadReader returns an io reader for the request payload.
-func (m Request) GetPayloadReader() io.ReadCloser {
-	return ioutil.NopCloser(bytes.NewReader(m.Payload))
+func (m Request) GetPayloadReader() (io.ReadCloser, error) {
+	payload, err := m.GetPayload()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(payload)), nil
+}
+
+// encrypt encrypts headers and payload if a keyring is set.
+func (m *Request) encrypt() error {
+	k := currentKeyring()
+	if k == nil {
+		return nil
+	}
+
+	keyID, dataKey, ciphertexts, err := k.encrypt(m.Headers, m.Payload)
+	if err != nil {
+		return err
+	}
+	m.KeyID, m.DataKey = keyID, dataKey
+	m.Headers, m.Payload = ciphertexts[0], ciphertexts[1]
+	return nil
+}
+
+// decrypt returns headers and payload in plaintext. Requests buffered without
+// encryption are returned as they are.
+func (m Request) decrypt() (headers []byte, payload []byte, err error) {
+	if m.KeyID == "" {
+		return m.Headers, m.Payload, nil
+	}
+
+	k := currentKeyring()
+	if k == nil {
+		return nil, nil, fmt.Errorf("request %s is encrypted with key %s, but no encryption keys are configured", m.ID, m.KeyID)
+	}
+	plaintexts, err := k.decrypt(m.KeyID, m.DataKey, m.Headers, m.Payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not decrypt request %s: %s", m.ID, err)
+	}
+	return plaintexts[0], plaintexts[1], nil
 }
 
 // GetHTTPRequest wraps an *http.Request from this request.
+// The path and query are taken from RequestURI if it was recorded,
+// so that their original encoding is kept.
 func (m Request) GetHTTPRequest() (r *http.Request, err error) {
 	u := url.URL{}
+	if m.RequestURI != "" {
+		var ru *url.URL
+		ru, err = url.ParseRequestURI(m.RequestURI)
+		if err != nil {
+			return
+		}
+		u = *ru
+	} else {
+		u.Path = m.Path
+		u.RawQuery = m.RawQuery
+	}
 	u.Host = m.Host
 	u.Scheme = m.Scheme
-	u.Path = m.Path
-	r, err = http.NewRequest(m.Method, u.String(), m.GetPayloadReader())
+	body, err := m.GetPayloadReader()
+	if err != nil {
+		return
+	}
+	r, err = http.NewRequest(m.Method, u.String(), body)
 	if err != nil {
 		return
 	}
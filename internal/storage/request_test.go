@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_replayed_request_matches_original(t *testing.T) {
+	var tests = []struct {
+		name string
+		raw  string
+	}{
+		{"plain", "POST /github-webhook/ HTTP/1.1\r\n" +
+			"Host: jenkins-foo.example.com\r\n" +
+			"Content-Length: 16\r\n" +
+			"Content-Type: application/json\r\n" +
+			"User-Agent: GitHub-Hookshot/c494ff1\r\n" +
+			"X-Github-Event: push\r\n" +
+			"\r\n" +
+			`{"ref": "test"}` + "\n"},
+		{"query", "POST /github-webhook/?token=s3cr3t&job=a%20b HTTP/1.1\r\n" +
+			"Host: jenkins-foo.example.com\r\n" +
+			"Content-Length: 2\r\n" +
+			"X-Github-Event: push\r\n" +
+			"\r\n" +
+			"{}"},
+		{"escaped path", "POST /generic-webhook-trigger/invoke%2Fjob?token=abc&token=def HTTP/1.1\r\n" +
+			"Host: jenkins-foo.example.com\r\n" +
+			"Content-Length: 2\r\n" +
+			"\r\n" +
+			"{}"},
+		{"empty query", "POST /project/test? HTTP/1.1\r\n" +
+			"Host: jenkins-foo.example.com\r\n" +
+			"Content-Length: 2\r\n" +
+			"X-Gitlab-Event: Push Hook\r\n" +
+			"\r\n" +
+			"{}"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original, err := http.ReadRequest(bufio.NewReader(bytes.NewBufferString(test.raw)))
+			require.NoError(t, err, "Unexpected error parsing request")
+			body, err := ioutil.ReadAll(original.Body)
+			require.NoError(t, err, "Unexpected error reading body")
+			original.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			expected, err := httputil.DumpRequest(original, true)
+			require.NoError(t, err, "Unexpected error dumping original request")
+
+			buffered, err := NewRequest(original, "foo", body)
+			require.NoError(t, err, "Unexpected error buffering request")
+
+			replayed, err := buffered.GetHTTPRequest()
+			require.NoError(t, err, "Unexpected error replaying request")
+
+			actual, err := httputil.DumpRequest(replayed, true)
+			require.NoError(t, err, "Unexpected error dumping replayed request")
+
+			assert.Equal(t, string(expected), string(actual), "Replayed request differs from original")
+		})
+	}
+}
+
+func Test_replay_of_request_buffered_without_request_uri(t *testing.T) {
+	buffered := Request{
+		Method:  "POST",
+		Headers: []byte(`{"X-Github-Event": ["push"]}`),
+		Host:    "jenkins-foo.example.com",
+		Scheme:  "https",
+		Path:    "/github-webhook/",
+	}
+
+	replayed, err := buffered.GetHTTPRequest()
+	assert.NoError(t, err, "Unexpected error replaying request")
+	assert.Equal(t, "https://jenkins-foo.example.com/github-webhook/", replayed.URL.String())
+
+	buffered.RawQuery = "token=s3cr3t"
+	replayed, err = buffered.GetHTTPRequest()
+	assert.NoError(t, err, "Unexpected error replaying request")
+	assert.Equal(t, "https://jenkins-foo.example.com/github-webhook/?token=s3cr3t", replayed.URL.String())
+}
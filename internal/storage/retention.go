@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+)
+
+// Retention tells how long stored rows are kept. A max age of 0 keeps them forever.
+type Retention struct {
+	// RequestMaxAge applies to buffered requests, by the time they were buffered,
+	// and to dead letters, by the time they were given up on.
+	RequestMaxAge time.Duration
+	// StatisticsMaxAge applies to the statistics of namespaces neither accessed
+	// nor buffered to since.
+	StatisticsMaxAge time.Duration
+}
+
+// PurgeResult tells how many rows a purge deleted.
+type PurgeResult struct {
+	Requests    int64 `json:"requests"`
+	DeadLetters int64 `json:"dead_letters"`
+	Statistics  int64 `json:"statistics"`
+}
+
+// Janitor deletes the rows of a store which outlived their retention.
+type Janitor struct {
+	store     Store
+	retention Retention
+	recorder  metric.Recorder
+}
+
+// NewJanitor creates a Janitor enforcing the given retention on a store and
+// recording the purged rows.
+func NewJanitor(store Store, retention Retention, recorder metric.Recorder) *Janitor {
+	return &Janitor{
+		store:     store,
+		retention: retention,
+		recorder:  recorder,
+	}
+}
+
+// Run purges the store every interval until the context is done.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		select {
+		case <-ctx.Done():
+			storeLogger.Info("Stopping to purge expired rows.")
+			return ctx.Err()
+		case <-time.After(interval):
+			if _, err := j.Purge(); err != nil {
+				storeLogger.WithField("error", err).Error("Failure to purge expired rows")
+			}
+		}
+	}
+}
+
+// Purge deletes the rows which outlived their retention right away.
+func (j *Janitor) Purge() (result PurgeResult, err error) {
+	now := time.Now()
+
+	if j.retention.RequestMaxAge > 0 {
+		before := now.Add(-j.retention.RequestMaxAge)
+		result.Requests, err = j.store.DeleteRequestsBefore(before)
+		j.recorder.RecordRowsPurged("requests", result.Requests)
+		if err != nil {
+			return
+		}
+		result.DeadLetters, err = j.store.DeleteDeadLettersBefore(before)
+		j.recorder.RecordRowsPurged("dead_letters", result.DeadLetters)
+		if err != nil {
+			return
+		}
+	}
+
+	if j.retention.StatisticsMaxAge > 0 {
+		result.Statistics, err = j.store.DeleteStatisticsBefore(now.Add(-j.retention.StatisticsMaxAge))
+		j.recorder.RecordRowsPurged("statistics", result.Statistics)
+		if err != nil {
+			return
+		}
+	}
+
+	if result.Requests > 0 || result.DeadLetters > 0 || result.Statistics > 0 {
+		storeLogger.Infof("Purged %d requests, %d dead letters and %d statistics entries",
+			result.Requests, result.DeadLetters, result.Statistics)
+	}
+	return
+}
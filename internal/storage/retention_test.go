@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bufferAged(t *testing.T, store Store, ns string, age time.Duration) *Request {
+	created := time.Now().Add(-age)
+	request := &Request{ID: uuid.NewV4(), Namespace: ns, CreatedAt: &created}
+	require.NoError(t, store.CreateRequest(request))
+	return request
+}
+
+func Test_janitor_purges_expired_rows(t *testing.T) {
+	store := NewMemoryStore()
+	recorder := metric.NewMock()
+	janitor := NewJanitor(store, Retention{RequestMaxAge: 24 * time.Hour, StatisticsMaxAge: 30 * 24 * time.Hour}, recorder)
+
+	bufferAged(t, store, "gone-ns", 48*time.Hour)
+	undated := &Request{ID: uuid.NewV4(), Namespace: "gone-ns"}
+	require.NoError(t, store.CreateRequest(undated))
+	kept := bufferAged(t, store, "active-ns", time.Hour)
+	dead := bufferAged(t, store, "gone-ns", 72*time.Hour)
+	require.NoError(t, store.MoveToDeadLetters(dead))
+	store.deadLetters[0].DeadAt = time.Now().Add(-48 * time.Hour)
+
+	longAgo := time.Now().Add(-60 * 24 * time.Hour).Unix()
+	require.NoError(t, store.CreateStatistics(NewStatistics("gone-ns", longAgo, longAgo)))
+	require.NoError(t, store.CreateStatistics(NewStatistics("active-ns", longAgo, time.Now().Unix())))
+
+	result, err := janitor.Purge()
+	require.NoError(t, err)
+	assert.Equal(t, PurgeResult{Requests: 1, DeadLetters: 1, Statistics: 1}, result)
+	assert.Equal(t, float64(1), recorder.Value("storage_rows_purged_total", "requests"))
+	assert.Equal(t, float64(1), recorder.Value("storage_rows_purged_total", "dead_letters"))
+	assert.Equal(t, float64(1), recorder.Value("storage_rows_purged_total", "statistics"))
+
+	requests, _ := store.GetRequests("active-ns")
+	require.Len(t, requests, 1)
+	assert.Equal(t, kept.ID, requests[0].ID, "Recent request should be kept.")
+	requests, _ = store.GetRequests("gone-ns")
+	require.Len(t, requests, 1)
+	assert.Equal(t, undated.ID, requests[0].ID, "Request without creation time should be kept.")
+	_, notFound, _ := store.GetStatisticsUser("active-ns")
+	assert.False(t, notFound, "Statistics of active namespace should be kept.")
+}
+
+func Test_janitor_keeps_rows_without_max_age(t *testing.T) {
+	store := NewMemoryStore()
+	janitor := NewJanitor(store, Retention{}, metric.NewMock())
+
+	bufferAged(t, store, "old-ns", 365*24*time.Hour)
+	require.NoError(t, store.CreateStatistics(NewStatistics("old-ns", 0, 0)))
+
+	result, err := janitor.Purge()
+	require.NoError(t, err)
+	assert.Equal(t, PurgeResult{}, result, "Nothing should be purged without max age.")
+	count, _ := store.GetRequestsCount("old-ns")
+	assert.Equal(t, 1, count)
+}
+
+func Test_janitor_stops_with_context(t *testing.T) {
+	store := NewMemoryStore()
+	janitor := NewJanitor(store, Retention{RequestMaxAge: time.Hour}, metric.NewMock())
+	bufferAged(t, store, "old-ns", 2*time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- janitor.Run(ctx, 10*time.Millisecond)
+	}()
+
+	for deadline := time.Now().Add(time.Second); ; {
+		if count, _ := store.GetRequestsCount("old-ns"); count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expired request should have been purged in the background.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("Janitor did not stop.")
+	}
+}
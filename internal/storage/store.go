@@ -19,17 +19,59 @@ var storeLogger = log.WithFields(log.Fields{"component": "store"})
 // Store includes all methods required to interact with the database
 type Store interface {
 	CreateRequest(r *Request) error
+	// GetRequests returns the requests of a namespace in the order they were buffered
 	GetRequests(ns string) (result []Request, err error)
+	GetRequestByDeliveryID(id string) (r *Request, notFound bool, err error)
 	IncrementRequestRetry(r *Request) (errs []error)
 	GetUsers() (result []string, err error)
 	GetRequestsCount(ns string) (result int, err error)
 	DeleteRequest(r *Request) error
+	// ClaimRequests leases the requests of a namespace to owner and returns them in the order
+	// they were buffered. Nothing is returned while another owner holds an unexpired lease on
+	// any of them, so that the requests of a namespace are replayed by one replica at a time.
+	// Claiming again renews the lease of the owner.
+	ClaimRequests(ns string, owner string, lease time.Duration) (result []Request, err error)
+	// ReleaseRequests ends the lease of owner on the requests of a namespace
+	ReleaseRequests(ns string, owner string) error
+	// GetRequestsPage returns at most limit requests of a namespace in the order they were buffered, skipping the first offset
+	GetRequestsPage(ns string, offset int, limit int) (result []Request, err error)
+	GetRequest(id string) (r *Request, notFound bool, err error)
+	// ResetNextAttempt makes a request which is backing off due for replay
+	ResetNextAttempt(r *Request) error
+	// DeleteRequests deletes all requests of a namespace and returns how many were deleted
+	DeleteRequests(ns string) (deleted int64, err error)
+	// DeleteRequestsBefore deletes the requests buffered before t, requests without creation time are kept
+	DeleteRequestsBefore(t time.Time) (deleted int64, err error)
+
+	// MoveToDeadLetters replaces a request which exhausted its retries by its dead letter
+	MoveToDeadLetters(r *Request) error
+	// GetDeadLetters returns the dead letters of a namespace, or of all namespaces if ns is empty
+	GetDeadLetters(ns string) (result []DeadLetter, err error)
+	GetDeadLetter(id string) (d *DeadLetter, notFound bool, err error)
+	// RequeueDeadLetter replaces a dead letter by a buffered request with reset retries
+	RequeueDeadLetter(d *DeadLetter) error
+	// DeleteDeadLettersBefore deletes the dead letters given up on before t
+	DeleteDeadLettersBefore(t time.Time) (deleted int64, err error)
 
 	CreateStatistics(o *Statistics) error
 	UpdateStatistics(o *Statistics) error
 	GetStatisticsUser(ns string) (o *Statistics, notFound bool, err error)
+	// DeleteStatisticsBefore deletes the statistics of namespaces neither accessed nor buffered to since t
+	DeleteStatisticsBefore(t time.Time) (deleted int64, err error)
+
+	// StartReadiness stores a readiness measurement, unless one of the same namespace is pending
+	// since pendingSince or later, so that only the first unidle is measured. Older pending
+	// measurements are replaced, Jenkins never got ready after those. It returns whether r was stored.
+	StartReadiness(r *Readiness, pendingSince time.Time) (started bool, err error)
+	// FinishReadiness marks the pending readiness measurement of a namespace ready at readyAt and
+	// returns it, nil if none is pending. Only the last keep measurements of the namespace are kept.
+	FinishReadiness(ns string, readyAt time.Time, keep int) (r *Readiness, err error)
+	// GetReadiness returns the readiness measurements of a namespace, most recent first
+	GetReadiness(ns string) (result []Readiness, err error)
 
 	LogStats()
+	// Ping returns an error if the store cannot be used, e.g. because its database is unreachable
+	Ping(ctx context.Context) error
 }
 
 // LogStorageStats enables logging of stogare statistics.
@@ -45,6 +87,43 @@ func LogStorageStats(ctx context.Context, store Store, interval time.Duration) e
 	}
 }
 
+// Open creates the store of the storage backend selected in the configuration and sets
+// the keyring of buffered requests.
+// The returned function closes the store.
+func Open(config configuration.Configuration) (Store, func() error, error) {
+	noop := func() error { return nil }
+
+	if config.GetEncryptionKeyID() != "" {
+		k, err := NewKeyring(config.GetEncryptionKeyID(), config.GetEncryptionKeys())
+		if err != nil {
+			return nil, nil, err
+		}
+		SetKeyring(k)
+		storeLogger.Infof("Encrypting buffered requests with key %s", config.GetEncryptionKeyID())
+	} else {
+		storeLogger.Warn("Buffered requests are not encrypted")
+	}
+
+	switch config.GetStorageBackend() {
+	case configuration.StorageMemory:
+		storeLogger.Warn("Storing in memory, buffered requests are lost on restart")
+		return NewMemoryStore(), noop, nil
+	case configuration.StorageFile:
+		storeLogger.Infof("Storing in file %s", config.GetStorageFile())
+		s, err := NewFileStore(config.GetStorageFile())
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, noop, nil
+	default:
+		db, err := Connect(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return NewDBStorage(db), db.Close, nil
+	}
+}
+
 // Connect sets up a database connection by using configuration given as input.
 func Connect(config configuration.Configuration) (*gorm.DB, error) {
 	db, err := gorm.Open("postgres", PostgresConfigString(config))
@@ -66,14 +145,10 @@ func Connect(config configuration.Configuration) (*gorm.DB, error) {
 		db = db.Debug()
 	}
 
-	request := &Request{}
-	if !db.HasTable(request) {
-		db.CreateTable(request)
-	}
-
-	stats := &Statistics{}
-	if !db.HasTable(stats) {
-		db.CreateTable(stats)
+	err = Migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return db, nil
@@ -0,0 +1,456 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStoreConformance checks the behaviour every Store has to provide. Namespaces
+// are unique per run, so that it can run against a store shared with other tests.
+func testStoreConformance(t *testing.T, store Store) {
+	t.Run("store is reachable", func(t *testing.T) {
+		assert.NoError(t, store.Ping(context.Background()))
+	})
+
+	t.Run("requests are returned in buffer order", func(t *testing.T) {
+		ns := uniqueNamespace()
+		ids := createRequests(t, store, ns, 3)
+
+		requests, err := store.GetRequests(ns)
+		require.NoError(t, err)
+		require.Len(t, requests, 3)
+		for i := range ids {
+			assert.Equal(t, ids[i], requests[i].ID, "Requests should be in buffer order.")
+		}
+
+		count, err := store.GetRequestsCount(ns)
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+
+		users, err := store.GetUsers()
+		require.NoError(t, err)
+		assert.Contains(t, users, ns)
+
+		request, notFound, err := store.GetRequest(ids[1].String())
+		require.NoError(t, err)
+		assert.False(t, notFound)
+		assert.Equal(t, ns, request.Namespace)
+
+		_, notFound, _ = store.GetRequest(uuid.NewV4().String())
+		assert.True(t, notFound, "Unknown request should not be found.")
+	})
+
+	t.Run("requests are paged", func(t *testing.T) {
+		ns := uniqueNamespace()
+		ids := createRequests(t, store, ns, 5)
+
+		page, err := store.GetRequestsPage(ns, 1, 3)
+		require.NoError(t, err)
+		require.Len(t, page, 3)
+		assert.Equal(t, ids[1], page[0].ID)
+		assert.Equal(t, ids[3], page[2].ID)
+
+		page, err = store.GetRequestsPage(ns, 4, 3)
+		require.NoError(t, err)
+		assert.Len(t, page, 1, "Last page should be partial.")
+
+		page, err = store.GetRequestsPage(ns, 10, 3)
+		require.NoError(t, err)
+		assert.Len(t, page, 0, "Page behind the last request should be empty.")
+	})
+
+	t.Run("delivery IDs are unique", func(t *testing.T) {
+		ns := uniqueNamespace()
+		deliveryID := uuid.NewV4().String()
+		err := store.CreateRequest(&Request{ID: uuid.NewV4(), Namespace: ns, DeliveryID: &deliveryID})
+		require.NoError(t, err)
+
+		found, notFound, err := store.GetRequestByDeliveryID(deliveryID)
+		require.NoError(t, err)
+		assert.False(t, notFound)
+		assert.Equal(t, deliveryID, *found.DeliveryID)
+
+		err = store.CreateRequest(&Request{ID: uuid.NewV4(), Namespace: ns, DeliveryID: &deliveryID})
+		assert.Equal(t, ErrDuplicateDelivery, err, "Redelivery should have been rejected.")
+
+		_, notFound, _ = store.GetRequestByDeliveryID(uuid.NewV4().String())
+		assert.True(t, notFound, "Unknown delivery ID should not be found.")
+	})
+
+	t.Run("retries and backoff are stored", func(t *testing.T) {
+		ns := uniqueNamespace()
+		ids := createRequests(t, store, ns, 1)
+		request, _, err := store.GetRequest(ids[0].String())
+		require.NoError(t, err)
+
+		next := time.Now().Add(time.Hour)
+		request.NextAttempt = &next
+		request.LastStatus = 503
+		request.LastError = "unavailable"
+		errs := store.IncrementRequestRetry(request)
+		assert.Len(t, errs, 0)
+
+		request, _, err = store.GetRequest(ids[0].String())
+		require.NoError(t, err)
+		assert.Equal(t, 1, request.Retries)
+		assert.Equal(t, 503, request.LastStatus)
+		assert.Equal(t, "unavailable", request.LastError)
+		require.NotNil(t, request.NextAttempt)
+		assert.False(t, request.Due(time.Now()), "Request should be backing off.")
+
+		err = store.ResetNextAttempt(request)
+		require.NoError(t, err)
+		request, _, err = store.GetRequest(ids[0].String())
+		require.NoError(t, err)
+		assert.True(t, request.Due(time.Now()), "Request should be due again.")
+	})
+
+	t.Run("requests are deleted", func(t *testing.T) {
+		ns := uniqueNamespace()
+		other := uniqueNamespace()
+		ids := createRequests(t, store, ns, 3)
+		createRequests(t, store, other, 1)
+
+		err := store.DeleteRequest(&Request{ID: ids[0], Namespace: ns})
+		require.NoError(t, err)
+		count, _ := store.GetRequestsCount(ns)
+		assert.Equal(t, 2, count)
+
+		deleted, err := store.DeleteRequests(ns)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deleted)
+		count, _ = store.GetRequestsCount(ns)
+		assert.Equal(t, 0, count)
+		count, _ = store.GetRequestsCount(other)
+		assert.Equal(t, 1, count, "Requests of other namespaces should be kept.")
+	})
+
+	t.Run("dead letters are moved and requeued", func(t *testing.T) {
+		ns := uniqueNamespace()
+		deliveryID := uuid.NewV4().String()
+		request := &Request{ID: uuid.NewV4(), Namespace: ns, DeliveryID: &deliveryID, Headers: []byte("{}"), Payload: []byte("payload")}
+		require.NoError(t, store.CreateRequest(request))
+
+		request.Retries = 3
+		request.LastError = "gone"
+		require.NoError(t, store.MoveToDeadLetters(request))
+		count, _ := store.GetRequestsCount(ns)
+		assert.Equal(t, 0, count, "Dead request should no longer be buffered.")
+
+		deadLetters, err := store.GetDeadLetters(ns)
+		require.NoError(t, err)
+		require.Len(t, deadLetters, 1)
+		assert.Equal(t, "gone", deadLetters[0].LastError)
+
+		deadLetters, err = store.GetDeadLetters("")
+		require.NoError(t, err)
+		assert.NotEmpty(t, deadLetters, "Dead letters of all namespaces should be listed.")
+
+		d, notFound, err := store.GetDeadLetter(request.ID.String())
+		require.NoError(t, err)
+		assert.False(t, notFound)
+		assert.Equal(t, []byte("payload"), d.Payload)
+
+		// a redelivery buffered in the meantime blocks the requeue
+		redelivery := &Request{ID: uuid.NewV4(), Namespace: ns, DeliveryID: &deliveryID}
+		require.NoError(t, store.CreateRequest(redelivery))
+		assert.Equal(t, ErrDuplicateDelivery, store.RequeueDeadLetter(d))
+		require.NoError(t, store.DeleteRequest(redelivery))
+
+		require.NoError(t, store.RequeueDeadLetter(d))
+		_, notFound, _ = store.GetDeadLetter(request.ID.String())
+		assert.True(t, notFound, "Requeued dead letter should be deleted.")
+
+		requests, err := store.GetRequests(ns)
+		require.NoError(t, err)
+		require.Len(t, requests, 1)
+		assert.Equal(t, 0, requests[0].Retries, "Retries should be reset.")
+		assert.Equal(t, []byte("payload"), requests[0].Payload)
+	})
+
+	t.Run("statistics are stored", func(t *testing.T) {
+		ns := uniqueNamespace()
+		_, notFound, _ := store.GetStatisticsUser(ns)
+		assert.True(t, notFound, "Statistics should not exist yet.")
+
+		require.NoError(t, store.CreateStatistics(NewStatistics(ns, 1, 2)))
+		stats, notFound, err := store.GetStatisticsUser(ns)
+		require.NoError(t, err)
+		assert.False(t, notFound)
+		assert.Equal(t, int64(1), stats.LastAccessed)
+
+		stats.LastBufferedRequest = 3
+		require.NoError(t, store.UpdateStatistics(stats))
+		stats, _, err = store.GetStatisticsUser(ns)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stats.LastBufferedRequest)
+	})
+
+	t.Run("requests are leased to one owner", func(t *testing.T) {
+		ns := uniqueNamespace()
+		ids := createRequests(t, store, ns, 2)
+
+		claimed, err := store.ClaimRequests(ns, "replica-1", time.Minute)
+		require.NoError(t, err)
+		require.Len(t, claimed, 2)
+		assert.Equal(t, ids[0], claimed[0].ID, "Claimed requests should be in buffer order.")
+		assert.Equal(t, "replica-1", claimed[0].LeaseOwner)
+
+		claimed, err = store.ClaimRequests(ns, "replica-2", time.Minute)
+		require.NoError(t, err)
+		assert.Len(t, claimed, 0, "Leased requests should not be claimed by another owner.")
+
+		claimed, err = store.ClaimRequests(ns, "replica-1", time.Minute)
+		require.NoError(t, err)
+		assert.Len(t, claimed, 2, "Owner should renew its lease.")
+
+		require.NoError(t, store.ReleaseRequests(ns, "replica-1"))
+		claimed, err = store.ClaimRequests(ns, "replica-2", time.Millisecond)
+		require.NoError(t, err)
+		assert.Len(t, claimed, 2, "Released requests should be claimed by another owner.")
+
+		time.Sleep(50 * time.Millisecond)
+		claimed, err = store.ClaimRequests(ns, "replica-1", time.Minute)
+		require.NoError(t, err)
+		assert.Len(t, claimed, 2, "Requests should be claimed again once the lease expired.")
+	})
+
+	t.Run("readiness is measured from the first unidle", func(t *testing.T) {
+		ns := uniqueNamespace()
+		first := NewReadiness(ns, "https://api.cluster/", "ui")
+		started, err := store.StartReadiness(first, time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		assert.True(t, started)
+		started, err = store.StartReadiness(NewReadiness(ns, "https://api.cluster/", "webhook"), time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		assert.False(t, started, "Pending measurement should be kept.")
+
+		readyAt := time.Now()
+		finished, err := store.FinishReadiness(ns, readyAt, 2)
+		require.NoError(t, err)
+		require.NotNil(t, finished)
+		assert.Equal(t, first.ID, finished.ID)
+		assert.Equal(t, "ui", finished.Trigger)
+		assert.WithinDuration(t, readyAt, *finished.ReadyAt, time.Millisecond)
+
+		finished, err = store.FinishReadiness(ns, time.Now(), 2)
+		require.NoError(t, err)
+		assert.Nil(t, finished, "Nothing should be pending anymore.")
+
+		stale := NewReadiness(ns, "https://api.cluster/", "ui")
+		stale.UnidledAt = time.Now().Add(-time.Hour)
+		_, err = store.StartReadiness(stale, time.Now().Add(-2*time.Hour))
+		require.NoError(t, err)
+		started, err = store.StartReadiness(NewReadiness(ns, "https://api.cluster/", "webhook"), time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		assert.True(t, started, "Stale pending measurement should be replaced.")
+		for i := 0; i < 2; i++ {
+			_, err = store.FinishReadiness(ns, time.Now(), 2)
+			require.NoError(t, err)
+			_, err = store.StartReadiness(NewReadiness(ns, "https://api.cluster/", "ui"), time.Now().Add(-time.Minute))
+			require.NoError(t, err)
+		}
+
+		measurements, err := store.GetReadiness(ns)
+		require.NoError(t, err)
+		require.Len(t, measurements, 3, "Last 2 measurements and the pending one should be kept.")
+		assert.Nil(t, measurements[0].ReadyAt, "Most recent measurement should come first.")
+		assert.Equal(t, "ui", measurements[1].Trigger)
+		assert.Equal(t, "webhook", measurements[2].Trigger)
+	})
+
+	t.Run("expired rows are deleted", func(t *testing.T) {
+		ns := uniqueNamespace()
+		now := time.Now()
+		old := now.Add(-48 * time.Hour)
+		require.NoError(t, store.CreateRequest(&Request{ID: uuid.NewV4(), Namespace: ns, CreatedAt: &old}))
+		recent := &Request{ID: uuid.NewV4(), Namespace: ns, CreatedAt: &now}
+		require.NoError(t, store.CreateRequest(recent))
+		undated := &Request{ID: uuid.NewV4(), Namespace: ns}
+		require.NoError(t, store.CreateRequest(undated))
+
+		deleted, err := store.DeleteRequestsBefore(now.Add(-24 * time.Hour))
+		require.NoError(t, err)
+		assert.True(t, deleted >= 1, "Old request should have been deleted.")
+		requests, err := store.GetRequests(ns)
+		require.NoError(t, err)
+		require.Len(t, requests, 2)
+		assert.Equal(t, undated.ID, requests[0].ID, "Request without creation time should be kept.")
+		assert.Equal(t, recent.ID, requests[1].ID, "Recent request should be kept.")
+		require.NoError(t, store.DeleteRequest(undated))
+
+		require.NoError(t, store.MoveToDeadLetters(recent))
+		_, err = store.DeleteDeadLettersBefore(now.Add(-time.Hour))
+		require.NoError(t, err)
+		deadLetters, _ := store.GetDeadLetters(ns)
+		assert.Len(t, deadLetters, 1, "Recent dead letter should be kept.")
+		_, err = store.DeleteDeadLettersBefore(time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		deadLetters, _ = store.GetDeadLetters(ns)
+		assert.Len(t, deadLetters, 0, "Expired dead letter should have been deleted.")
+
+		inactive := uniqueNamespace()
+		require.NoError(t, store.CreateStatistics(NewStatistics(inactive, old.Unix(), old.Unix())))
+		require.NoError(t, store.CreateStatistics(NewStatistics(ns, old.Unix(), now.Unix())))
+		_, err = store.DeleteStatisticsBefore(now.Add(-24 * time.Hour))
+		require.NoError(t, err)
+		_, notFound, _ := store.GetStatisticsUser(inactive)
+		assert.True(t, notFound, "Statistics of inactive namespace should have been deleted.")
+		_, notFound, _ = store.GetStatisticsUser(ns)
+		assert.False(t, notFound, "Statistics of namespace buffered to recently should be kept.")
+	})
+}
+
+func uniqueNamespace() string {
+	return "conformance-" + uuid.NewV4().String()
+}
+
+// createRequests buffers n requests one second apart and returns their IDs in buffer order
+func createRequests(t *testing.T, store Store, ns string, n int) []uuid.UUID {
+	var ids []uuid.UUID
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < n; i++ {
+		created := start.Add(time.Duration(i) * time.Second)
+		request := &Request{ID: uuid.NewV4(), Namespace: ns, CreatedAt: &created}
+		require.NoError(t, store.CreateRequest(request))
+		ids = append(ids, request.ID)
+	}
+	return ids
+}
+
+func Test_memory_store_conformance(t *testing.T) {
+	testStoreConformance(t, NewMemoryStore())
+}
+
+func Test_file_store_conformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(filepath.Join(dir, "store.db"))
+	require.NoError(t, err)
+	testStoreConformance(t, store)
+}
+
+func Test_file_store_survives_restart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store.db")
+
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	ids := createRequests(t, store, "restart-ns", 2)
+	require.NoError(t, store.CreateStatistics(NewStatistics("restart-ns", 1, 2)))
+
+	reopened, err := NewFileStore(path)
+	require.NoError(t, err)
+	requests, err := reopened.GetRequests("restart-ns")
+	require.NoError(t, err)
+	require.Len(t, requests, 2, "Requests should have been loaded from the file.")
+	assert.Equal(t, ids[0], requests[0].ID)
+	_, notFound, _ := reopened.GetStatisticsUser("restart-ns")
+	assert.False(t, notFound, "Statistics should have been loaded from the file.")
+}
+
+func Test_file_store_keeps_changes_which_cannot_be_written(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(filepath.Join(dir, "store.db"))
+	require.NoError(t, err)
+	createRequests(t, store, "unwritable-ns", 1)
+
+	// the file cannot be written once its directory is gone
+	require.NoError(t, os.RemoveAll(dir))
+	r := &Request{ID: uuid.NewV4(), Namespace: "unwritable-ns"}
+	assert.Error(t, store.CreateRequest(r), "Change should fail when the file cannot be written.")
+	_, err = store.DeleteRequests("unwritable-ns")
+	assert.Error(t, err, "Change should fail when the file cannot be written.")
+
+	requests, err := store.GetRequests("unwritable-ns")
+	require.NoError(t, err)
+	assert.Len(t, requests, 1, "Failed changes should not have taken effect.")
+}
+
+func Test_file_store_is_compacted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store.db")
+
+	defer func(previous int) { compactFileAfter = previous }(compactFileAfter)
+	compactFileAfter = 5
+
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	kept := createRequests(t, store, "compacted-ns", 1)
+	for i := 0; i < 3*compactFileAfter; i++ {
+		r := &Request{ID: uuid.NewV4(), Namespace: "compacted-ns"}
+		require.NoError(t, store.CreateRequest(r))
+		require.NoError(t, store.DeleteRequest(r))
+	}
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	changes := 0
+	for {
+		_, err := readChange(f)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		changes++
+	}
+	// the content written when compacting and the changes appended since
+	assert.True(t, changes <= compactFileAfter+1, "File should have been compacted, it has %d changes.", changes)
+
+	reopened, err := NewFileStore(path)
+	require.NoError(t, err)
+	requests, err := reopened.GetRequests("compacted-ns")
+	require.NoError(t, err)
+	require.Len(t, requests, 1, "Changes should have been loaded from the compacted file.")
+	assert.Equal(t, kept[0], requests[0].ID)
+}
+
+func Test_file_store_ignores_incomplete_change(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "store.db")
+
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	ids := createRequests(t, store, "incomplete-ns", 2)
+
+	// the proxy stopped while writing the last change
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-1))
+
+	reopened, err := NewFileStore(path)
+	require.NoError(t, err)
+	requests, err := reopened.GetRequests("incomplete-ns")
+	require.NoError(t, err)
+	require.Len(t, requests, 1, "Incomplete change should have been ignored.")
+	assert.Equal(t, ids[0], requests[0].ID)
+
+	r := &Request{ID: uuid.NewV4(), Namespace: "incomplete-ns"}
+	require.NoError(t, reopened.CreateRequest(r))
+	again, err := NewFileStore(path)
+	require.NoError(t, err)
+	count, err := again.GetRequestsCount("incomplete-ns")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "Changes after the incomplete one should be loaded.")
+}
@@ -1,6 +1,7 @@
 package tenant
 
 import (
+	"context"
 	"errors"
 )
 
@@ -9,7 +10,7 @@ type Mock struct {
 }
 
 // GetTenantInfo returns a tenant information based on tenant id.
-func (t Mock) GetTenantInfo(tenantID string) (ti Info, err error) {
+func (t Mock) GetTenantInfo(ctx context.Context, tenantID string) (ti Info, err error) {
 	return Info{
 		Data: InfoData{
 			Attributes: Attributes{
@@ -27,7 +28,7 @@ func (t Mock) GetTenantInfo(tenantID string) (ti Info, err error) {
 }
 
 // GetNamespace mock gets namespace
-func (t Mock) GetNamespace(accessToken string) (namespace Namespace, err error) {
+func (t Mock) GetNamespace(ctx context.Context, accessToken string) (namespace Namespace, err error) {
 	if accessToken == "ValidToken" {
 		return Namespace{
 			ClusterURL: "Valid_OpenShift_API_URL",
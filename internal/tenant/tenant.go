@@ -1,6 +1,7 @@
 package tenant
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -10,7 +11,11 @@ import (
 	"errors"
 
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/auth"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tracing"
 	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/logging"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -19,7 +24,7 @@ func New(tenantServiceURL string, authToken string) Client {
 	logger := log.WithFields(
 		log.Fields{
 			"component": "tenant",
-			"url":       tenantServiceURL,
+			"url":       logging.RedactURLString(tenantServiceURL),
 		},
 	)
 
@@ -31,10 +36,11 @@ func New(tenantServiceURL string, authToken string) Client {
 	}
 }
 
-// Service is contains methods that makes calls to tenant APIs
+// Service is contains methods that makes calls to tenant APIs. Calls are
+// cancelled once the given context is done.
 type Service interface {
-	GetTenantInfo(tenantID string) (Info, error)
-	GetNamespace(accessToken string) (Namespace, error)
+	GetTenantInfo(ctx context.Context, tenantID string) (Info, error)
+	GetNamespace(ctx context.Context, accessToken string) (Namespace, error)
 }
 
 // Client is a simple client for fabric8-tenant.
@@ -89,7 +95,13 @@ type Namespace struct {
 }
 
 // GetTenantInfo returns a tenant information based on tenant id.
-func (t Client) GetTenantInfo(tenantID string) (ti Info, err error) {
+func (t Client) GetTenantInfo(ctx context.Context, tenantID string) (ti Info, err error) {
+	ctx, span := tracing.Start(ctx, "tenant.GetTenantInfo")
+	defer func(start time.Time) {
+		metric.DefaultRecorder().RecordUpstreamLatency(metric.UpstreamTenant, time.Since(start), err)
+		tracing.End(span, err)
+	}(time.Now())
+
 	if len(tenantID) == 0 {
 		err = errors.New("tenant ID cannot be empty string")
 		return
@@ -98,9 +110,12 @@ func (t Client) GetTenantInfo(tenantID string) (ti Info, err error) {
 	if err != nil {
 		return
 	}
+	req = req.WithContext(ctx)
+	requestid.Propagate(req)
+	tracing.Inject(req)
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.authToken))
 
-	t.logger.WithFields(log.Fields{
+	requestid.Logger(ctx, t.logger).WithFields(log.Fields{
 		"type": "id",
 		"id":   tenantID,
 	}).Info("Tenant by id")
@@ -139,17 +154,20 @@ func GetNamespaceByType(ti Info, typ string) (r Namespace, err error) {
 }
 
 // GetNamespace gets namespace given appropriate accessToken
-func (t Client) GetNamespace(accessToken string) (namespace Namespace, err error) {
+func (t Client) GetNamespace(ctx context.Context, accessToken string) (namespace Namespace, err error) {
+	ctx, span := tracing.Start(ctx, "tenant.GetNamespace")
+	defer func() { tracing.End(span, err) }()
+
 	authClient, err := auth.DefaultClient()
 	if err != nil {
 		return namespace, err
 	}
-	uid, err := authClient.UIDFromToken(accessToken)
+	uid, err := authClient.UIDFromToken(ctx, accessToken)
 	if err != nil {
 		return namespace, err
 	}
 
-	ti, err := t.GetTenantInfo(uid)
+	ti, err := t.GetTenantInfo(ctx, uid)
 	if err != nil {
 		return namespace, err
 	}
@@ -158,6 +176,7 @@ func (t Client) GetNamespace(accessToken string) (namespace Namespace, err error
 	if err != nil {
 		return namespace, err
 	}
+	span.SetAttributes(tracing.Namespace(namespace.Name), tracing.Cluster(namespace.ClusterURL))
 
 	return namespace, nil
 }
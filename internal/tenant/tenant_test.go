@@ -1,6 +1,7 @@
 package tenant
 
 import (
+	"context"
 	"strings"
 	"testing"
 
@@ -12,7 +13,7 @@ func TestGetTenant(t *testing.T) {
 	defer ts.Close()
 
 	ct := New(ts.URL, "aaa")
-	ti, err := ct.GetTenantInfo("2e15e957-0366-4802-bf1e-0d6fe3f11bb6")
+	ti, err := ct.GetTenantInfo(context.Background(), "2e15e957-0366-4802-bf1e-0d6fe3f11bb6")
 	if err != nil {
 		t.Error(err)
 	}
@@ -32,7 +33,7 @@ func TestGetError(t *testing.T) {
 	defer ts.Close()
 
 	ct := New(ts.URL, "aaa")
-	ti, err := ct.GetTenantInfo("2e15e957-0366-4802-bf1e-0d6fe3f11bb6")
+	ti, err := ct.GetTenantInfo(context.Background(), "2e15e957-0366-4802-bf1e-0d6fe3f11bb6")
 	if err == nil {
 		t.Error("Expected Errors to be populated in output")
 	}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/configuration"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/version"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// serviceName is the name of the service of all spans
+	serviceName = "fabric8-jenkins-proxy"
+	// instrumentationName is the name of the tracer creating all spans
+	instrumentationName = "github.com/fabric8-services/fabric8-jenkins-proxy"
+
+	// NamespaceKey is the attribute of spans holding the namespace of the Jenkins involved.
+	NamespaceKey = attribute.Key("jenkins.namespace")
+	// ClusterKey is the attribute of spans holding the cluster URL of the Jenkins involved.
+	ClusterKey = attribute.Key("jenkins.cluster")
+)
+
+var logger = log.WithFields(log.Fields{"component": "tracing"})
+
+// Setup installs the global tracer provider exporting spans as configured. The returned
+// function flushes the spans not exported yet and stops exporting.
+func Setup(config configuration.Configuration) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	var err error
+	switch config.GetTracingExporter() {
+	case configuration.TracingNone:
+		return func(context.Context) error { return nil }, nil
+	case configuration.TracingStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case configuration.TracingFile:
+		file, err = os.OpenFile(config.GetTracingFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	case configuration.TracingOTLP:
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(config.GetTracingEndpoint()))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %s", config.GetTracingExporter())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.String("service.version", version.GetVersion()),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	logger.WithField("exporter", config.GetTracingExporter()).Info("Exporting traces")
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span with the given attributes as child of the span in the context.
+// The returned context carries the new span.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends the span, marking it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	Fail(span, err)
+	span.End()
+}
+
+// Fail marks the span as failed with err, unless err is nil.
+func Fail(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Namespace returns the attribute of the given namespace.
+func Namespace(ns string) attribute.KeyValue {
+	return NamespaceKey.String(ns)
+}
+
+// Cluster returns the attribute of the given cluster URL.
+func Cluster(clusterURL string) attribute.KeyValue {
+	return ClusterKey.String(clusterURL)
+}
+
+// Extract returns the context of an incoming request, continuing the trace of the client if it sent one.
+func Extract(r *http.Request) context.Context {
+	return otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
+
+// Inject sets the headers of an outbound request so that its receiver continues the trace
+// of the span carried by the request context.
+func Inject(r *http.Request) {
+	otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(r.Header))
+}
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/configuration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestSpansAreNestedAndAttributed(t *testing.T) {
+	exporter, restore := NewInMemory()
+	defer restore()
+
+	ctx, parent := Start(context.Background(), "parent", Namespace("ns-jenkins"))
+	_, child := Start(ctx, "child", Cluster("https://api.cluster/"))
+	End(child, errors.New("boom"))
+	End(parent, nil)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, []string{"child", "parent"}, SpanNames(exporter))
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID(), "Child should be nested in its parent")
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, codes.Unset, spans[1].Status.Code)
+	assert.Contains(t, spans[1].Attributes, Namespace("ns-jenkins"))
+	assert.Contains(t, spans[0].Attributes, Cluster("https://api.cluster/"))
+}
+
+func TestTraceIsPropagated(t *testing.T) {
+	exporter, restore := NewInMemory()
+	defer restore()
+
+	ctx, span := Start(context.Background(), "client")
+	out := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	Inject(out)
+	assert.NotEmpty(t, out.Header.Get("traceparent"))
+
+	in := httptest.NewRequest("GET", "/", nil)
+	in.Header = out.Header
+	_, server := Start(Extract(in), "server")
+	server.End()
+	span.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, spans[0].SpanContext.TraceID(), spans[1].SpanContext.TraceID(), "Server should continue the trace of the client")
+}
+
+func TestSetupFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "traces.json")
+
+	_, restore := NewInMemory()
+	defer restore()
+
+	config := configuration.NewMock()
+	config.TracingExporter = configuration.TracingFile
+	config.TracingFile = file
+	shutdown, err := Setup(&config)
+	require.NoError(t, err)
+	_, span := Start(context.Background(), "exported", Namespace("ns-jenkins"))
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "exported")
+	assert.Contains(t, string(data), "ns-jenkins")
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	config := configuration.NewMock()
+	config.TracingExporter = "zipkin"
+	_, err := Setup(&config)
+	assert.Error(t, err)
+}
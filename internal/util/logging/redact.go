@@ -0,0 +1,217 @@
+package logging
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces the values of denied headers, cookies and query parameters in logs.
+const Redacted = "REDACTED"
+
+var (
+	// DefaultRedactedHeaders are the headers whose values are redacted unless configured otherwise.
+	DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Set-Cookie", "X-Hub-Signature", "X-Gitlab-Token"}
+
+	// DefaultRedactedCookies are the cookies whose values are redacted unless configured otherwise.
+	DefaultRedactedCookies = []string{"JSESSIONID*", "JenkinsIdled", "remember-me"}
+
+	// DefaultRedactedQueryParams are the query parameters whose values are redacted unless configured otherwise.
+	DefaultRedactedQueryParams = []string{"token_json", "access_token", "refresh_token", "token"}
+)
+
+var (
+	redactorLock sync.RWMutex
+	redactor     = NewRedactor(DefaultRedactedHeaders, DefaultRedactedCookies, DefaultRedactedQueryParams)
+)
+
+// Redactor removes secrets from values before they are logged. Values of denied headers,
+// cookies and query parameters are replaced by Redacted, the names are kept so that the
+// log still tells what was sent.
+type Redactor struct {
+	headers     map[string]bool
+	cookies     []string
+	queryParams map[string]bool
+}
+
+// NewRedactor creates a redactor with the given deny-lists. Header names are matched case
+// insensitively, cookie names may end in * to match all cookies starting with the prefix.
+// The values of the Cookie header are redacted cookie by cookie, unless the header is denied.
+func NewRedactor(headers, cookies, queryParams []string) *Redactor {
+	r := &Redactor{
+		headers:     make(map[string]bool),
+		queryParams: make(map[string]bool),
+	}
+	for _, name := range headers {
+		if name = strings.TrimSpace(name); name != "" {
+			r.headers[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	for _, name := range cookies {
+		if name = strings.TrimSpace(name); name != "" {
+			r.cookies = append(r.cookies, name)
+		}
+	}
+	for _, name := range queryParams {
+		if name = strings.TrimSpace(name); name != "" {
+			r.queryParams[name] = true
+		}
+	}
+	return r
+}
+
+// SetRedactor sets the redactor used by the functions of this package.
+func SetRedactor(r *Redactor) {
+	redactorLock.Lock()
+	defer redactorLock.Unlock()
+	redactor = r
+}
+
+func currentRedactor() *Redactor {
+	redactorLock.RLock()
+	defer redactorLock.RUnlock()
+	return redactor
+}
+
+// Header returns the value of the given header as it may be logged.
+func (r *Redactor) Header(name, value string) string {
+	name = http.CanonicalHeaderKey(name)
+	if r.headers[name] {
+		return Redacted
+	}
+	if name == "Cookie" {
+		return r.cookieHeader(value)
+	}
+	return value
+}
+
+// Cookie returns the value of the given cookie as it may be logged.
+func (r *Redactor) Cookie(name, value string) string {
+	for _, denied := range r.cookies {
+		if denied == name || strings.HasSuffix(denied, "*") && strings.HasPrefix(name, strings.TrimSuffix(denied, "*")) {
+			return Redacted
+		}
+	}
+	return value
+}
+
+// cookieHeader redacts the values of denied cookies in a Cookie header.
+func (r *Redactor) cookieHeader(value string) string {
+	var cookies []string
+	for _, cookie := range strings.Split(value, ";") {
+		cookie = strings.TrimSpace(cookie)
+		if i := strings.Index(cookie, "="); i >= 0 {
+			cookie = cookie[:i+1] + r.Cookie(cookie[:i], cookie[i+1:])
+		}
+		cookies = append(cookies, cookie)
+	}
+	return strings.Join(cookies, "; ")
+}
+
+// Headers returns a copy of the given headers with the values of denied headers and cookies redacted.
+func (r *Redactor) Headers(headers map[string][]string) map[string][]string {
+	redacted := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		for _, value := range values {
+			redacted[name] = append(redacted[name], r.Header(name, value))
+		}
+	}
+	return redacted
+}
+
+// Query returns the given raw query with the values of denied parameters redacted.
+// Parameters keep their order and encoding.
+func (r *Redactor) Query(rawQuery string) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		name := param
+		if j := strings.Index(param, "="); j >= 0 {
+			name = param[:j]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if r.queryParams[name] {
+			params[i] = strings.SplitN(param, "=", 2)[0] + "=" + Redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// RequestURI returns the given request target with the values of denied query parameters redacted.
+func (r *Redactor) RequestURI(requestURI string) string {
+	i := strings.Index(requestURI, "?")
+	if i < 0 {
+		return requestURI
+	}
+	return requestURI[:i+1] + r.Query(requestURI[i+1:])
+}
+
+// URL returns the given URL as it may be logged, without password and with the values
+// of denied query parameters redacted.
+func (r *Redactor) URL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			redacted.User = url.UserPassword(u.User.Username(), Redacted)
+		}
+	}
+	redacted.RawQuery = r.Query(u.RawQuery)
+	return redacted.String()
+}
+
+// URLString returns the given URL as it may be logged. Unparsable URLs are redacted as a whole.
+func (r *Redactor) URLString(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Redacted
+	}
+	return r.URL(u)
+}
+
+// Form returns the encoded form with the values of denied parameters redacted.
+func (r *Redactor) Form(form url.Values) string {
+	return r.Query(form.Encode())
+}
+
+// RedactHeader returns the value of the given header as it may be logged.
+func RedactHeader(name, value string) string {
+	return currentRedactor().Header(name, value)
+}
+
+// RedactHeaders returns a copy of the given headers as they may be logged.
+func RedactHeaders(headers map[string][]string) map[string][]string {
+	return currentRedactor().Headers(headers)
+}
+
+// RedactCookie returns the value of the given cookie as it may be logged.
+func RedactCookie(name, value string) string {
+	return currentRedactor().Cookie(name, value)
+}
+
+// RedactURL returns the given URL as it may be logged.
+func RedactURL(u *url.URL) string {
+	return currentRedactor().URL(u)
+}
+
+// RedactURLString returns the given URL as it may be logged.
+func RedactURLString(rawURL string) string {
+	return currentRedactor().URLString(rawURL)
+}
+
+// RedactQuery returns the given raw query as it may be logged.
+func RedactQuery(rawQuery string) string {
+	return currentRedactor().Query(rawQuery)
+}
+
+// RedactRequestURI returns the given request target as it may be logged.
+func RedactRequestURI(requestURI string) string {
+	return currentRedactor().RequestURI(requestURI)
+}
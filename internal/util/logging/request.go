@@ -8,45 +8,50 @@ import (
 )
 
 // FormatHTTPRequestWithSeparator returns a formatted and readable string containing information of given HTTP request, separated by given separated.
+// Secrets are redacted.
 func FormatHTTPRequestWithSeparator(r *http.Request, separator string) string {
+	redactor := currentRedactor()
 	var request []string
 
-	url := fmt.Sprintf("%v %v", r.Method, r.URL)
+	url := fmt.Sprintf("%v %v", r.Method, redactor.URL(r.URL))
 	request = append(request, url)
 	request = append(request, fmt.Sprintf("Host: %v", r.Host))
 
 	for name, headers := range r.Header {
-		name = strings.ToLower(name)
 		for _, h := range headers {
-			request = append(request, fmt.Sprintf("%v: %v", name, h))
+			request = append(request, fmt.Sprintf("%v: %v", strings.ToLower(name), redactor.Header(name, h)))
 		}
 	}
 
 	if r.Method == "POST" {
 		r.ParseForm()
 		request = append(request, " ")
-		request = append(request, r.Form.Encode())
+		request = append(request, redactor.Form(r.Form))
 	}
 
 	return strings.Join(request, separator)
 }
 
 // FormatHTTPRequest returns a formatted and readable string containing information of given HTTP request.
+// Secrets are redacted.
 func FormatHTTPRequest(r *http.Request) string {
 	return FormatHTTPRequestWithSeparator(r, "\n")
 }
 
 // RequestMethodAndURL return string containing method(GET, POST, PATCH etc) and string given an HTTP request.
+// Secrets are redacted.
 func RequestMethodAndURL(r *http.Request) string {
-	return fmt.Sprintf("%v %v", r.Method, r.URL)
+	return fmt.Sprintf("%v %v", r.Method, RedactURL(r.URL))
 }
 
 // RequestHeaders returns a string containing request header for the given HTTP request.
+// Secrets are redacted.
 func RequestHeaders(r *http.Request) string {
+	redactor := currentRedactor()
 	var result []string
 	for name, headers := range r.Header {
 		for _, h := range headers {
-			result = append(result, fmt.Sprintf("-H %v: %v", name, h))
+			result = append(result, fmt.Sprintf("-H %v: %v", name, redactor.Header(name, h)))
 		}
 	}
 
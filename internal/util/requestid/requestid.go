@@ -0,0 +1,94 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Header carries the ID of a request to and from other services.
+	Header = "X-Request-ID"
+
+	// LogField is the field of log entries holding the request ID.
+	LogField = "request-id"
+
+	// maxLength is the longest request ID accepted from clients.
+	maxLength = 128
+)
+
+type contextKey struct{}
+
+// New generates a request ID.
+func New() string {
+	return uuid.NewV4().String()
+}
+
+// NewContext returns a copy of the context carrying the given request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by the context, empty if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Valid returns whether an ID sent by a client may be used. It must not be longer
+// than 128 characters and only consist of letters, digits and -_.:, so that it
+// cannot forge log entries or headers.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Accept takes the ID of an incoming request from its header, or generates one if the
+// client sent no valid ID. The ID is returned in the response header and is carried by
+// the context of the returned request, whose header is set to it so that it is forwarded.
+func Accept(w http.ResponseWriter, r *http.Request) (*http.Request, string) {
+	id := r.Header.Get(Header)
+	if !Valid(id) {
+		id = New()
+	}
+	r = r.WithContext(NewContext(r.Context(), id))
+	r.Header.Set(Header, id)
+	w.Header().Set(Header, id)
+	return r, id
+}
+
+// Handler accepts the ID of every request before passing it to h.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, _ = Accept(w, r)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Propagate sets the header of an outbound request to the ID carried by its context.
+// A request without ID is left unchanged.
+func Propagate(r *http.Request) {
+	if id := FromContext(r.Context()); id != "" {
+		r.Header.Set(Header, id)
+	}
+}
+
+// Logger returns the logger with the request ID carried by the context as field.
+func Logger(ctx context.Context, logger *log.Entry) *log.Entry {
+	if id := FromContext(ctx); id != "" {
+		return logger.WithField(LogField, id)
+	}
+	return logger
+}
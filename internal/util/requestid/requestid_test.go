@@ -0,0 +1,55 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerAcceptsValidID(t *testing.T) {
+	var seen string
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+		assert.Equal(t, seen, r.Header.Get(Header), "ID should be forwarded")
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(Header, "support-1234")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	assert.Equal(t, "support-1234", seen)
+	assert.Equal(t, "support-1234", w.Header().Get(Header), "ID should be returned")
+}
+
+func TestHandlerReplacesInvalidID(t *testing.T) {
+	for _, id := range []string{"", "with space", "new\nline", strings.Repeat("a", maxLength+1)} {
+		var seen string
+		h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = FromContext(r.Context())
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(Header, id)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		assert.NotEqual(t, id, seen, "Invalid ID %q should have been replaced", id)
+		assert.True(t, Valid(seen), "Generated ID should be valid")
+		assert.Equal(t, seen, w.Header().Get(Header))
+	}
+}
+
+func TestPropagate(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	Propagate(req)
+	assert.Empty(t, req.Header.Get(Header), "Request without ID should be left unchanged")
+
+	req = req.WithContext(NewContext(context.Background(), "abc"))
+	Propagate(req)
+	assert.Equal(t, "abc", req.Header.Get(Header))
+}
@@ -11,3 +11,20 @@ func EnsureSuffix(s string, suffix string) string {
 	}
 	return s + suffix
 }
+
+// ParseKeyValueList parses a comma separated list of key=value pairs into a map.
+// Surrounding whitespace of keys and values is trimmed and empty entries are skipped.
+func ParseKeyValueList(s string) map[string]string {
+	result := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return result
+}
@@ -20,3 +20,20 @@ func Test_Ensure_Suffix(t *testing.T) {
 		assert.Equal(t, test.expectedString, actualString, "Unexpected suffix string")
 	}
 }
+
+func Test_Parse_Key_Value_List(t *testing.T) {
+	var tests = []struct {
+		s        string
+		expected map[string]string
+	}{
+		{"", map[string]string{}},
+		{"a=b", map[string]string{"a": "b"}},
+		{" a = b , c=d=e,", map[string]string{"a": "b", "c": "d=e"}},
+		{"https://github.com/foo/bar.git=s3cr3t", map[string]string{"https://github.com/foo/bar.git": "s3cr3t"}},
+		{"invalid", map[string]string{}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, ParseKeyValueList(test.s), "Unexpected key value map")
+	}
+}
@@ -69,3 +69,32 @@ func IsDuration(value interface{}, key string) error {
 	}
 	return nil
 }
+
+// IsPositiveDuration checks if value stored at a given key is a time duration greater than zero.
+func IsPositiveDuration(value interface{}, key string) error {
+	d, err := time.ParseDuration(value.(string))
+	if err != nil || d <= 0 {
+		return fmt.Errorf("value for %s needs to be a positive time duration", key)
+	}
+	return nil
+}
+
+// IsKeyValueList checks if value stored at a given key is a comma separated list of key=value pairs.
+// An empty list is valid.
+func IsKeyValueList(value interface{}, key string) error {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("value for %s needs to be a string", key)
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			return fmt.Errorf("value for %s needs to be a comma separated list of key=value pairs", key)
+		}
+	}
+	return nil
+}
@@ -89,3 +89,55 @@ func Test_IsDuration(t *testing.T) {
 		})
 	}
 }
+
+func Test_IsPositiveDuration(t *testing.T) {
+	var tt = []struct {
+		name   string
+		value  string
+		errors []string
+	}{
+		{"second", "10s", []string{}},
+		{"zero", "0s", []string{"value for interval needs to be a positive time duration"}},
+		{"negative", "-1m", []string{"value for interval needs to be a positive time duration"}},
+		{"invalid", "invalid", []string{"value for interval needs to be a positive time duration"}},
+	}
+
+	for _, testcase := range tt {
+		t.Run(testcase.name, func(t *testing.T) {
+			t.Parallel()
+			err := IsPositiveDuration(testcase.value, "interval")
+			errors := []string{}
+			if err != nil {
+				errors = strings.Split(err.Error(), "\n")
+			}
+
+			assert.Equal(t, testcase.errors, errors, fmt.Sprintf("Unexpected error for %s", testcase.value))
+		})
+	}
+}
+
+func Test_IsKeyValueList(t *testing.T) {
+	var tt = []struct {
+		name   string
+		value  string
+		errors []string
+	}{
+		{"empty", "", []string{}},
+		{"single", "foo=bar", []string{}},
+		{"multiple", "foo=bar,baz=", []string{}},
+		{"missing separator", "foo", []string{"value for list needs to be a comma separated list of key=value pairs"}},
+		{"missing key", "=bar", []string{"value for list needs to be a comma separated list of key=value pairs"}},
+	}
+
+	for _, testcase := range tt {
+		t.Run(testcase.name, func(t *testing.T) {
+			err := IsKeyValueList(testcase.value, "list")
+			errors := []string{}
+			if err != nil {
+				errors = strings.Split(err.Error(), "\n")
+			}
+
+			assert.Equal(t, testcase.errors, errors, fmt.Sprintf("Unexpected error for %s", testcase.value))
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package wit
 
+import "context"
+
 // DefaultMockOwner is a mock owner value to be used by tests
 const DefaultMockOwner = "mockTenantID"
 
@@ -9,7 +11,7 @@ type Mock struct {
 }
 
 // SearchCodebase is a mock method
-func (w *Mock) SearchCodebase(repo string) (*Info, error) {
+func (w *Mock) SearchCodebase(ctx context.Context, repo string) (*Info, error) {
 	return &Info{
 		OwnedBy: w.OwnedBy,
 	}, nil
@@ -1,17 +1,23 @@
 package wit
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/metric"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/tracing"
+	"github.com/fabric8-services/fabric8-jenkins-proxy/internal/util/requestid"
 	log "github.com/sirupsen/logrus"
 )
 
-// Service describes work item tracker service of OSIO.
+// Service describes work item tracker service of OSIO. Calls are cancelled
+// once the given context is done.
 type Service interface {
-	SearchCodebase(repo string) (*Info, error)
+	SearchCodebase(ctx context.Context, repo string) (*Info, error)
 }
 
 // Client is a client that interacts with Work Item Tracker service
@@ -85,24 +91,33 @@ func (wi *Info) UnmarshalJSON(b []byte) (err error) {
 }
 
 // SearchCodebase finds and returns owner of a given repository based on URL.
-func (w *Client) SearchCodebase(repo string) (*Info, error) {
+func (w *Client) SearchCodebase(ctx context.Context, repo string) (wi *Info, err error) {
+	ctx, span := tracing.Start(ctx, "wit.SearchCodebase")
+	defer func(start time.Time) {
+		metric.DefaultRecorder().RecordUpstreamLatency(metric.UpstreamWIT, time.Since(start), err)
+		tracing.End(span, err)
+	}(time.Now())
+
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/search/codebases", w.witURL), nil)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
+	requestid.Propagate(req)
+	tracing.Inject(req)
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", w.authToken))
 
 	q := req.URL.Query()
 	q.Add("url", repo)
 	req.URL.RawQuery = q.Encode()
 
-	log.Infof("WIT Client: %s", req.URL)
+	requestid.Logger(ctx, log.NewEntry(log.StandardLogger())).Infof("WIT Client: %s", req.URL)
 	resp, err := w.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
-	wi := &Info{}
+	wi = &Info{}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	err = json.Unmarshal(body, wi)
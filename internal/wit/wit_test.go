@@ -1,6 +1,7 @@
 package wit
 
 import (
+	"context"
 	"testing"
 
 	tu "github.com/fabric8-services/fabric8-jenkins-proxy/internal/testutils"
@@ -12,7 +13,7 @@ func TestWIT(t *testing.T) {
 	defer ts.Close()
 
 	wit := New(ts.URL, "xxx")
-	wi, err := wit.SearchCodebase("github.com/vpavlin/vpavlin-prod-prev-test.git")
+	wi, err := wit.SearchCodebase(context.Background(), "github.com/vpavlin/vpavlin-prod-prev-test.git")
 	if err != nil {
 		t.Error(err)
 	}